@@ -20,8 +20,16 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// EventStreamType are the types of event stream supported
-// +kubebuilder:validation:Enum=Kafka;RabbitMQ
+const (
+	// KeepReplacedReleasesAnnotation keeps the releases of the backing
+	// services an application no longer uses, when set to "true", instead of
+	// uninstalling them. They are uninstalled once the annotation is removed,
+	// or when the application is deleted.
+	KeepReplacedReleasesAnnotation = "cloudship.toucansoft.io/keep-replaced-releases"
+)
+
+// EventStreamType are the types of event stream supported. Types other than
+// the built-in ones are declared with a BackingServiceClass.
 type EventStreamType string
 
 const (
@@ -35,10 +43,12 @@ const (
 type EventStreamSpec struct {
 	// Type is the type of the cache
 	Type EventStreamType `json:"type,omitempty"`
+
+	HelmValues `json:",inline"`
 }
 
-// CacheType are the types of cache supported
-// +kubebuilder:validation:Enum=Redis;Memcached
+// CacheType are the types of cache supported. Types other than the built-in
+// ones are declared with a BackingServiceClass.
 type CacheType string
 
 const (
@@ -52,15 +62,52 @@ const (
 type CacheSpec struct {
 	// Type is the type of the cache
 	Type CacheType `json:"type,omitempty"`
+
+	HelmValues `json:",inline"`
 }
 
 // CacheStatus is the status of the cache
 type CacheStatus struct {
-	// Hostname is the hostname of the database
-	Hostname string `json:"hostname"`
+	ConnectionDetails `json:",inline"`
+}
+
+// EventStreamStatus is the status of the event stream
+type EventStreamStatus struct {
+	// Type is the type of the event stream
+	Type EventStreamType `json:"type"`
+
+	ConnectionDetails `json:",inline"`
 
-	// Port is the port of the database
-	Port string `json:"port"`
+	// Brokers are the addresses, as host:port, workloads bootstrap their
+	// connection to the event stream with
+	// +optional
+	Brokers []string `json:"brokers,omitempty"`
+}
+
+// DatabaseServerStatus is the status of a database server shared by the
+// services of an application
+type DatabaseServerStatus struct {
+	// Type is the type of the database server
+	Type DatabaseType `json:"type"`
+
+	// ConnectionDetails are the details the operator connects to the server
+	// with, as its administrator, to create the databases of the services
+	ConnectionDetails `json:",inline"`
+}
+
+// ReleaseStatus is a Helm release installed for a backing service of an
+// application
+type ReleaseStatus struct {
+	// Name is the name of the release
+	Name string `json:"name"`
+	// Category is the category of the backing service of the release
+	Category BackingServiceCategory `json:"category"`
+	// Type is the type of the backing service of the release
+	Type string `json:"type"`
+	// Retained is set when the application no longer uses the release but
+	// keeps it because of the keep-replaced-releases annotation
+	// +optional
+	Retained bool `json:"retained,omitempty"`
 }
 
 // ApplicationSpec defines the desired state of Application
@@ -82,8 +129,30 @@ type ApplicationStatus struct {
 	// Cache is the status of the cache
 	// +optional
 	Cache *CacheStatus `json:"cache,omitempty"`
+	// EventStream is the status of the event stream
+	// +optional
+	EventStream *EventStreamStatus `json:"eventStream,omitempty"`
+	// DatabaseServers are the statuses of the database servers shared by the
+	// services of the application
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	DatabaseServers []DatabaseServerStatus `json:"databaseServers,omitempty"`
 	// Deployment is the status of the deployment of the application
 	Deployment string `json:"description,omitempty"`
+	// Releases are the Helm releases installed for the backing services of
+	// the application
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Releases []ReleaseStatus `json:"releases,omitempty"`
+	// Conditions are the latest observations of the state of the application
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 }
 
 // +kubebuilder:object:root=true
@@ -91,6 +160,8 @@ type ApplicationStatus struct {
 // +genclient:nonNamespaced
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:scope=Cluster,categories=cloudship,shortName=csa
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
 
 // Application is the Schema for the applications API
 type Application struct {
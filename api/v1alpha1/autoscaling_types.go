@@ -0,0 +1,80 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// CustomMetricType is the source of a custom metric
+// +kubebuilder:validation:Enum=Pods;External
+type CustomMetricType string
+
+const (
+	// CustomMetricTypePods is a metric of the pods of the service, averaged
+	// across them
+	CustomMetricTypePods CustomMetricType = "Pods"
+	// CustomMetricTypeExternal is a metric not related to any object of the
+	// cluster, such as the length of a queue
+	CustomMetricTypeExternal CustomMetricType = "External"
+)
+
+// CustomMetric is a metric, other than CPU and memory, the service is scaled
+// on
+type CustomMetric struct {
+	// Type is the source of the metric
+	Type CustomMetricType `json:"type"`
+
+	// Name of the metric
+	Name string `json:"name"`
+
+	// Selector narrows the metric down by its labels
+	// +optional
+	Selector map[string]string `json:"selector,omitempty"`
+
+	// TargetAverageValue is the value of the metric per pod the service is
+	// scaled to
+	TargetAverageValue resource.Quantity `json:"targetAverageValue"`
+}
+
+// Autoscaling scales a service with a HorizontalPodAutoscaler
+type Autoscaling struct {
+	// MinReplicas is the least number of replicas. Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// MaxReplicas is the most number of replicas
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas int32 `json:"maxReplicas"`
+
+	// TargetCPUUtilizationPercentage is the average CPU utilization, relative
+	// to the requested CPU, the service is scaled to
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+
+	// TargetMemoryUtilizationPercentage is the average memory utilization,
+	// relative to the requested memory, the service is scaled to
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TargetMemoryUtilizationPercentage *int32 `json:"targetMemoryUtilizationPercentage,omitempty"`
+
+	// Metrics are custom metrics the service is scaled on
+	// +optional
+	Metrics []CustomMetric `json:"metrics,omitempty"`
+}
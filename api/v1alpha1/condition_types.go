@@ -0,0 +1,58 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// Condition types reported in the status of cloudship resources
+const (
+	// ConditionReady is true when the resource and everything it depends on is up
+	ConditionReady string = "Ready"
+	// ConditionCacheReady is true when the cache of an application is up
+	ConditionCacheReady string = "CacheReady"
+	// ConditionEventStreamReady is true when the event stream of an application is up
+	ConditionEventStreamReady string = "EventStreamReady"
+	// ConditionDatabaseReady is true when the databases of a service, or the
+	// shared database servers of an application, are up
+	ConditionDatabaseReady string = "DatabaseReady"
+	// ConditionIrreconcilable is true when a release could not be reconciled
+	ConditionIrreconcilable string = "Irreconcilable"
+	// ConditionReleaseFailed is true when a release could not be installed or upgraded
+	ConditionReleaseFailed string = "ReleaseFailed"
+)
+
+// Reasons of the conditions reported in the status of cloudship resources
+const (
+	// ReasonReady is the reason of a resource that is up
+	ReasonReady string = "Ready"
+	// ReasonNotReady is the reason of a resource waiting for its dependencies
+	ReasonNotReady string = "NotReady"
+	// ReasonWorkloadsNotReady is the reason of a release whose workloads are not ready
+	ReasonWorkloadsNotReady string = "WorkloadsNotReady"
+	// ReasonInstallSuccessful is the reason of a release that has been installed
+	ReasonInstallSuccessful string = "InstallSuccessful"
+	// ReasonUpgradeSuccessful is the reason of a release that has been upgraded
+	ReasonUpgradeSuccessful string = "UpgradeSuccessful"
+	// ReasonReconcileSuccessful is the reason of a release whose resources match its manifest
+	ReasonReconcileSuccessful string = "ReconcileSuccessful"
+	// ReasonInstallError is the reason of a release that failed to install
+	ReasonInstallError string = "InstallError"
+	// ReasonUpgradeError is the reason of a release that failed to upgrade
+	ReasonUpgradeError string = "UpgradeError"
+	// ReasonReconcileError is the reason of a resource that failed to reconcile
+	ReasonReconcileError string = "ReconcileError"
+	// ReasonUninstallError is the reason of a release that failed to uninstall
+	ReasonUninstallError string = "UninstallError"
+)
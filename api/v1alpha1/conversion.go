@@ -0,0 +1,420 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+)
+
+const (
+	// backingServicesAnnotation keeps the caches, event streams and databases
+	// of a v1beta1 object that do not fit in v1alpha1, which has a single
+	// unnamed one of each, so that converting back to v1beta1 restores them
+	backingServicesAnnotation = "cloudship.toucansoft.io/v1beta1-backing-services"
+)
+
+// hubBackingServices are the lists of backing services of a v1beta1 object
+// kept in the backingServicesAnnotation. Only the lists the v1alpha1 fields
+// cannot represent are set. Their first item is the one in the v1alpha1
+// fields, which take precedence over it.
+type hubBackingServices struct {
+	Caches              []v1beta1.CacheSpec         `json:"caches,omitempty"`
+	CacheStatuses       []v1beta1.CacheStatus       `json:"cacheStatuses,omitempty"`
+	EventStreams        []v1beta1.EventStreamSpec   `json:"eventStreams,omitempty"`
+	EventStreamStatuses []v1beta1.EventStreamStatus `json:"eventStreamStatuses,omitempty"`
+	Databases           []v1beta1.DatabaseSpec      `json:"databases,omitempty"`
+	DatabaseStatuses    []v1beta1.DatabaseStatus    `json:"databaseStatuses,omitempty"`
+}
+
+// convert copies the fields of in to the fields with the same JSON name of
+// out. The parts of the schema that did not change between versions are
+// converted with it.
+func convert(in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// instanceName is the v1beta1 name of the backing service of a type in
+// v1alpha1.
+func instanceName(serviceType string) string {
+	return strings.ToLower(serviceType)
+}
+
+// legacyReleaseName is the name of the release v1alpha1 installed for the
+// backing service of a type: the built-in event streams and databases had
+// names of their own, the others were named after their category and type.
+// The converted backing service names it as its release, so the operator
+// goes on managing the release and its data instead of installing a new one.
+func legacyReleaseName(category v1beta1.BackingServiceCategory, serviceType string) string {
+	switch {
+	case category == v1beta1.BackingServiceCategoryDatabase && serviceType == string(v1beta1.DatabaseTypePostgreSQL):
+		return "db"
+	case category == v1beta1.BackingServiceCategoryDatabase && serviceType == string(v1beta1.DatabaseTypeMySQL):
+		return "db-mysql"
+	case category == v1beta1.BackingServiceCategoryEventStream &&
+		(serviceType == string(v1beta1.EventStreamTypeKafka) || serviceType == string(v1beta1.EventStreamTypeRabbitMQ)):
+		return "stream-" + strings.ToLower(serviceType)
+	}
+	return strings.ToLower(string(category)) + "-" + strings.ToLower(serviceType)
+}
+
+// popBackingServices reads the backing services kept in the annotation of
+// obj and removes it.
+func popBackingServices(obj *metav1.ObjectMeta) (*hubBackingServices, error) {
+	hub := &hubBackingServices{}
+	data, ok := obj.Annotations[backingServicesAnnotation]
+	if !ok {
+		return hub, nil
+	}
+	if err := json.Unmarshal([]byte(data), hub); err != nil {
+		return nil, err
+	}
+	delete(obj.Annotations, backingServicesAnnotation)
+	if len(obj.Annotations) == 0 {
+		obj.Annotations = nil
+	}
+	return hub, nil
+}
+
+// pushBackingServices keeps the backing services in the annotation of obj,
+// unless there are none to keep.
+func pushBackingServices(obj *metav1.ObjectMeta, hub *hubBackingServices) error {
+	if equality.Semantic.DeepEqual(hub, &hubBackingServices{}) {
+		return nil
+	}
+	data, err := json.Marshal(hub)
+	if err != nil {
+		return err
+	}
+	if obj.Annotations == nil {
+		obj.Annotations = map[string]string{}
+	}
+	obj.Annotations[backingServicesAnnotation] = string(data)
+	return nil
+}
+
+// ConvertTo converts this Application to the Hub version (v1beta1).
+func (src *Application) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.Application)
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	hub, err := popBackingServices(&dst.ObjectMeta)
+	if err != nil {
+		return err
+	}
+
+	dst.Spec.Description = src.Spec.Description
+	dst.Spec.Caches = nil
+	if src.Spec.CacheRef != nil {
+		var cache v1beta1.CacheSpec
+		if err := convert(src.Spec.CacheRef, &cache); err != nil {
+			return err
+		}
+		cache.Name = instanceName(string(cache.Type))
+		cache.ReleaseName = legacyReleaseName(v1beta1.BackingServiceCategoryCache, string(cache.Type))
+		dst.Spec.Caches = []v1beta1.CacheSpec{cache}
+		if len(hub.Caches) > 0 {
+			if hub.Caches[0].Type == cache.Type {
+				dst.Spec.Caches[0].Name = hub.Caches[0].Name
+				dst.Spec.Caches[0].ReleaseName = hub.Caches[0].ReleaseName
+			}
+			dst.Spec.Caches = append(dst.Spec.Caches, hub.Caches[1:]...)
+		}
+	}
+	dst.Spec.EventStreams = nil
+	if src.Spec.EventStreamRefs != nil {
+		var eventStream v1beta1.EventStreamSpec
+		if err := convert(src.Spec.EventStreamRefs, &eventStream); err != nil {
+			return err
+		}
+		eventStream.Name = instanceName(string(eventStream.Type))
+		eventStream.ReleaseName = legacyReleaseName(v1beta1.BackingServiceCategoryEventStream, string(eventStream.Type))
+		dst.Spec.EventStreams = []v1beta1.EventStreamSpec{eventStream}
+		if len(hub.EventStreams) > 0 {
+			if hub.EventStreams[0].Type == eventStream.Type {
+				dst.Spec.EventStreams[0].Name = hub.EventStreams[0].Name
+				dst.Spec.EventStreams[0].ReleaseName = hub.EventStreams[0].ReleaseName
+			}
+			dst.Spec.EventStreams = append(dst.Spec.EventStreams, hub.EventStreams[1:]...)
+		}
+	}
+
+	dst.Status.Caches = nil
+	if src.Status.Cache != nil {
+		var cache v1beta1.CacheStatus
+		if err := convert(src.Status.Cache, &cache); err != nil {
+			return err
+		}
+		if len(dst.Spec.Caches) > 0 {
+			cache.Name, cache.Type = dst.Spec.Caches[0].Name, dst.Spec.Caches[0].Type
+		}
+		dst.Status.Caches = []v1beta1.CacheStatus{cache}
+		if len(hub.CacheStatuses) > 0 {
+			dst.Status.Caches[0].Name, dst.Status.Caches[0].Type = hub.CacheStatuses[0].Name, hub.CacheStatuses[0].Type
+			dst.Status.Caches = append(dst.Status.Caches, hub.CacheStatuses[1:]...)
+		}
+	}
+	dst.Status.EventStreams = nil
+	if src.Status.EventStream != nil {
+		var eventStream v1beta1.EventStreamStatus
+		if err := convert(src.Status.EventStream, &eventStream); err != nil {
+			return err
+		}
+		eventStream.Name = instanceName(string(eventStream.Type))
+		if len(dst.Spec.EventStreams) > 0 && dst.Spec.EventStreams[0].Type == eventStream.Type {
+			eventStream.Name = dst.Spec.EventStreams[0].Name
+		}
+		dst.Status.EventStreams = []v1beta1.EventStreamStatus{eventStream}
+		if len(hub.EventStreamStatuses) > 0 {
+			dst.Status.EventStreams[0].Name = hub.EventStreamStatuses[0].Name
+			dst.Status.EventStreams = append(dst.Status.EventStreams, hub.EventStreamStatuses[1:]...)
+		}
+	}
+	dst.Status.DatabaseServers = nil
+	if err := convert(src.Status.DatabaseServers, &dst.Status.DatabaseServers); err != nil {
+		return err
+	}
+	dst.Status.Deployment = src.Status.Deployment
+	dst.Status.Releases = nil
+	if err := convert(src.Status.Releases, &dst.Status.Releases); err != nil {
+		return err
+	}
+	dst.Status.Conditions = src.Status.Conditions
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version. Only
+// the first cache and event stream fit in v1alpha1, the others, the names and
+// the release names are kept in an annotation when they cannot be derived
+// from the types.
+func (dst *Application) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.Application)
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	delete(dst.Annotations, backingServicesAnnotation)
+
+	dst.Spec.Description = src.Spec.Description
+	dst.Spec.CacheRef = nil
+	if len(src.Spec.Caches) > 0 {
+		dst.Spec.CacheRef = &CacheSpec{}
+		if err := convert(&src.Spec.Caches[0], dst.Spec.CacheRef); err != nil {
+			return err
+		}
+	}
+	dst.Spec.EventStreamRefs = nil
+	if len(src.Spec.EventStreams) > 0 {
+		dst.Spec.EventStreamRefs = &EventStreamSpec{}
+		if err := convert(&src.Spec.EventStreams[0], dst.Spec.EventStreamRefs); err != nil {
+			return err
+		}
+	}
+
+	dst.Status.Cache = nil
+	if len(src.Status.Caches) > 0 {
+		dst.Status.Cache = &CacheStatus{}
+		if err := convert(&src.Status.Caches[0], dst.Status.Cache); err != nil {
+			return err
+		}
+	}
+	dst.Status.EventStream = nil
+	if len(src.Status.EventStreams) > 0 {
+		dst.Status.EventStream = &EventStreamStatus{}
+		if err := convert(&src.Status.EventStreams[0], dst.Status.EventStream); err != nil {
+			return err
+		}
+	}
+	dst.Status.DatabaseServers = nil
+	if err := convert(src.Status.DatabaseServers, &dst.Status.DatabaseServers); err != nil {
+		return err
+	}
+	dst.Status.Deployment = src.Status.Deployment
+	dst.Status.Releases = nil
+	if err := convert(src.Status.Releases, &dst.Status.Releases); err != nil {
+		return err
+	}
+	dst.Status.Conditions = src.Status.Conditions
+
+	// keep what converting back would not restore
+	derived := &v1beta1.Application{}
+	if err := dst.ConvertTo(derived); err != nil {
+		return err
+	}
+	hub := &hubBackingServices{}
+	if !equality.Semantic.DeepEqual(derived.Spec.Caches, src.Spec.Caches) ||
+		!equality.Semantic.DeepEqual(derived.Status.Caches, src.Status.Caches) {
+		hub.Caches, hub.CacheStatuses = src.Spec.Caches, src.Status.Caches
+	}
+	if !equality.Semantic.DeepEqual(derived.Spec.EventStreams, src.Spec.EventStreams) ||
+		!equality.Semantic.DeepEqual(derived.Status.EventStreams, src.Status.EventStreams) {
+		hub.EventStreams, hub.EventStreamStatuses = src.Spec.EventStreams, src.Status.EventStreams
+	}
+	return pushBackingServices(&dst.ObjectMeta, hub)
+}
+
+// ConvertTo converts this AppService to the Hub version (v1beta1).
+func (src *AppService) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.AppService)
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = v1beta1.AppServiceSpec{}
+	if err := convert(&src.Spec, &dst.Spec); err != nil {
+		return err
+	}
+	// the port number is serialized as portNumber in v1alpha1
+	for i, c := range src.Spec.Containers {
+		for j, p := range c.Ports {
+			dst.Spec.Containers[i].Ports[j].Port = p.Port
+		}
+	}
+	dst.Status = v1beta1.AppServiceStatus{}
+	if err := convert(&src.Status, &dst.Status); err != nil {
+		return err
+	}
+
+	hub, err := popBackingServices(&dst.ObjectMeta)
+	if err != nil {
+		return err
+	}
+	if src.Spec.DatabaseRef != nil {
+		var database v1beta1.DatabaseSpec
+		if err := convert(src.Spec.DatabaseRef, &database); err != nil {
+			return err
+		}
+		database.Name = instanceName(string(database.Type))
+		database.ReleaseName = legacyReleaseName(v1beta1.BackingServiceCategoryDatabase, string(database.Type))
+		dst.Spec.Databases = []v1beta1.DatabaseSpec{database}
+		if len(hub.Databases) > 0 {
+			if hub.Databases[0].Type == database.Type {
+				dst.Spec.Databases[0].Name = hub.Databases[0].Name
+				dst.Spec.Databases[0].Isolation = hub.Databases[0].Isolation
+				dst.Spec.Databases[0].ReleaseName = hub.Databases[0].ReleaseName
+			}
+			dst.Spec.Databases = append(dst.Spec.Databases, hub.Databases[1:]...)
+		}
+	}
+	if src.Status.DatabaseStatusRef != nil {
+		var database v1beta1.DatabaseStatus
+		if err := convert(src.Status.DatabaseStatusRef, &database); err != nil {
+			return err
+		}
+		if len(dst.Spec.Databases) > 0 {
+			database.Name, database.Type = dst.Spec.Databases[0].Name, dst.Spec.Databases[0].Type
+		}
+		dst.Status.Databases = []v1beta1.DatabaseStatus{database}
+		if len(hub.DatabaseStatuses) > 0 {
+			dst.Status.Databases[0].Name, dst.Status.Databases[0].Type = hub.DatabaseStatuses[0].Name, hub.DatabaseStatuses[0].Type
+			dst.Status.Databases = append(dst.Status.Databases, hub.DatabaseStatuses[1:]...)
+		}
+	}
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version. Only
+// the first database fits in v1alpha1, the others, the names, the isolation
+// and the release names are kept in an annotation when they cannot be derived
+// from the types.
+func (dst *AppService) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.AppService)
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = AppServiceSpec{}
+	if err := convert(&src.Spec, &dst.Spec); err != nil {
+		return err
+	}
+	for i, c := range src.Spec.Containers {
+		for j, p := range c.Ports {
+			dst.Spec.Containers[i].Ports[j].Port = p.Port
+		}
+	}
+	dst.Status = AppServiceStatus{}
+	if err := convert(&src.Status, &dst.Status); err != nil {
+		return err
+	}
+
+	delete(dst.Annotations, backingServicesAnnotation)
+	if len(src.Spec.Databases) > 0 {
+		dst.Spec.DatabaseRef = &DatabaseSpec{}
+		if err := convert(&src.Spec.Databases[0], dst.Spec.DatabaseRef); err != nil {
+			return err
+		}
+	}
+	if len(src.Status.Databases) > 0 {
+		dst.Status.DatabaseStatusRef = &DatabaseStatus{}
+		if err := convert(&src.Status.Databases[0], dst.Status.DatabaseStatusRef); err != nil {
+			return err
+		}
+	}
+
+	// keep what converting back would not restore
+	derived := &v1beta1.AppService{}
+	if err := dst.ConvertTo(derived); err != nil {
+		return err
+	}
+	hub := &hubBackingServices{}
+	if !equality.Semantic.DeepEqual(derived.Spec.Databases, src.Spec.Databases) ||
+		!equality.Semantic.DeepEqual(derived.Status.Databases, src.Status.Databases) {
+		hub.Databases, hub.DatabaseStatuses = src.Spec.Databases, src.Status.Databases
+	}
+	return pushBackingServices(&dst.ObjectMeta, hub)
+}
+
+// ConvertTo converts this AppResource to the Hub version (v1beta1).
+func (src *AppResource) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.AppResource)
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = v1beta1.AppResourceSpec{}
+	if err := convert(&src.Spec, &dst.Spec); err != nil {
+		return err
+	}
+	dst.Status = v1beta1.AppResourceStatus{}
+	return convert(&src.Status, &dst.Status)
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version.
+func (dst *AppResource) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.AppResource)
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = AppResourceSpec{}
+	if err := convert(&src.Spec, &dst.Spec); err != nil {
+		return err
+	}
+	dst.Status = AppResourceStatus{}
+	return convert(&src.Status, &dst.Status)
+}
+
+// ConvertTo converts this BackingServiceClass to the Hub version (v1beta1).
+// ReleaseName has no v1beta1 counterpart, the CRD rejects classes setting it.
+func (src *BackingServiceClass) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.BackingServiceClass)
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = v1beta1.BackingServiceClassSpec{}
+	return convert(&src.Spec, &dst.Spec)
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version.
+func (dst *BackingServiceClass) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.BackingServiceClass)
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = BackingServiceClassSpec{}
+	return convert(&src.Spec, &dst.Spec)
+}
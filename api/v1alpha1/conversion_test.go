@@ -0,0 +1,337 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/diff"
+
+	"github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+)
+
+func testConditions() []metav1.Condition {
+	return []metav1.Condition{{
+		Type:               ConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonReady,
+		Message:            "ready",
+		LastTransitionTime: metav1.Unix(1600000000, 0),
+		ObservedGeneration: 2,
+	}}
+}
+
+func testApplication() *Application {
+	return &Application{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "shop",
+			Annotations: map[string]string{KeepReplacedReleasesAnnotation: "true"},
+		},
+		Spec: ApplicationSpec{
+			Description: "Online shop",
+			CacheRef: &CacheSpec{
+				Type: CacheTypeRedis,
+				HelmValues: HelmValues{
+					Values:     &runtime.RawExtension{Raw: []byte(`{"master":{"persistence":{"enabled":false}}}`)},
+					ValuesFrom: []ValuesReference{{Kind: ValuesSourceKindSecret, Name: "redis", TargetPath: "password"}},
+				},
+			},
+			EventStreamRefs: &EventStreamSpec{Type: EventStreamTypeKafka},
+		},
+		Status: ApplicationStatus{
+			Cache: &CacheStatus{ConnectionDetails: ConnectionDetails{
+				Hostname: "cache-redis-master.shop",
+				Port:     "6379",
+				PasswordSecretRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "cache-redis-credentials"},
+					Key:                  "redis-password",
+				},
+			}},
+			EventStream: &EventStreamStatus{
+				Type:              EventStreamTypeKafka,
+				ConnectionDetails: ConnectionDetails{Hostname: "stream-kafka.shop", Port: "9092"},
+				Brokers:           []string{"stream-kafka-0.shop:9092"},
+			},
+			DatabaseServers: []DatabaseServerStatus{{
+				Type:              DatabaseTypePostgreSQL,
+				ConnectionDetails: ConnectionDetails{Hostname: "db-shared-postgresql.shop", Port: "5432", Username: "postgres"},
+			}},
+			Deployment: "deployed",
+			Releases: []ReleaseStatus{
+				{Name: "cache-redis", Category: BackingServiceCategoryCache, Type: string(CacheTypeRedis)},
+				{Name: "stream-rabbitmq", Category: BackingServiceCategoryEventStream, Type: string(EventStreamTypeRabbitMQ), Retained: true},
+			},
+			Conditions: testConditions(),
+		},
+	}
+}
+
+func testAppService() *AppService {
+	protocol := TransportProtocolUDP
+	limit := resource.MustParse("256Mi")
+	replicas := int32(3)
+	return &AppService{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop", Generation: 2},
+		Spec: AppServiceSpec{
+			Containers: []Container{{
+				Name:      "web",
+				Image:     "nginx:1.19",
+				Command:   []string{"nginx"},
+				Arguments: []string{"-g", "daemon off;"},
+				Environment: []ContainerEnvVar{
+					{Name: "LOG_LEVEL", FromConfigMap: &ConfigMapKeySelector{Name: "web", Key: "log-level"}},
+				},
+				Resources: &ContainerResources{
+					Memory: &ResourceQuantity{Required: resource.MustParse("128Mi"), Limit: &limit},
+				},
+				ReadinessProbe: &ContainerHealthProbe{HTTPGet: &HTTPGetProbe{Path: "/", Port: 80}},
+				VolumeMounts:   []VolumeMount{{Name: "config", MountPath: "/etc/nginx/conf.d", ReadOnly: true}},
+				Ports: []Service{
+					{Name: "http", Port: 80},
+					{Name: "dns", Port: 53, Protocol: &protocol},
+				},
+			}},
+			WorkloadType: WorkloadTypeStatefulSet,
+			VolumeClaimTemplates: []VolumeClaimTemplate{
+				{Name: "data", MountPath: "/data", Size: resource.MustParse("1Gi")},
+			},
+			Volumes: []Volume{
+				{Name: "config", ConfigMap: &FilesVolume{Name: "web", Items: []KeyToPath{{Key: "default.conf", Path: "default.conf"}}}},
+			},
+			ServiceType: ServiceTypeLoadBalancer,
+			Replicas:    &replicas,
+			Expose:      &Expose{Hosts: []string{"shop.example.com"}, Port: 80, TLS: &ExposeTLS{Issuer: "letsencrypt"}},
+			DatabaseRef: &DatabaseSpec{Type: DatabaseTypePostgreSQL},
+		},
+		Status: AppServiceStatus{
+			DatabaseStatusRef: &DatabaseStatus{ConnectionDetails{Hostname: "db-web-postgresql.shop", Port: "5432", Database: "web"}},
+			Releases: []ReleaseStatus{
+				{Name: "db-web-postgresql", Category: BackingServiceCategoryDatabase, Type: string(DatabaseTypePostgreSQL)},
+			},
+			SharedDatabases: []SharedDatabaseStatus{
+				{Name: "reports", Type: DatabaseTypeMySQL, Database: "web_reports", Username: "web_reports", Retained: true},
+			},
+			URL:        "https://shop.example.com",
+			Conditions: testConditions(),
+		},
+	}
+}
+
+func assertEqual(t *testing.T, expected, actual interface{}) {
+	t.Helper()
+	if !equality.Semantic.DeepEqual(expected, actual) {
+		t.Fatalf("round trip changed the object:\n%s", diff.ObjectReflectDiff(expected, actual))
+	}
+}
+
+func TestApplicationRoundTrip(t *testing.T) {
+	src := testApplication()
+	hub := &v1beta1.Application{}
+	if err := src.ConvertTo(hub); err != nil {
+		t.Fatal(err)
+	}
+	if len(hub.Spec.EventStreams) != 1 || hub.Spec.EventStreams[0].Type != v1beta1.EventStreamTypeKafka {
+		t.Fatalf("expected the event stream in the list of event streams, got %v", hub.Spec.EventStreams)
+	}
+	if len(hub.Spec.Caches) != 1 || hub.Spec.Caches[0].Name != "redis" {
+		t.Fatalf("expected the cache to be named after its type, got %v", hub.Spec.Caches)
+	}
+	if hub.Spec.Caches[0].ReleaseName != "cache-redis" || hub.Spec.EventStreams[0].ReleaseName != "stream-kafka" {
+		t.Fatalf("expected the cache and event stream to keep their v1alpha1 releases, got %q and %q",
+			hub.Spec.Caches[0].ReleaseName, hub.Spec.EventStreams[0].ReleaseName)
+	}
+	if hub.Status.Deployment != "deployed" {
+		t.Fatalf("expected the deployment status to be converted, got %q", hub.Status.Deployment)
+	}
+
+	dst := &Application{}
+	if err := dst.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, src, dst)
+}
+
+func TestApplicationHubRoundTrip(t *testing.T) {
+	src := &v1beta1.Application{}
+	if err := testApplication().ConvertTo(src); err != nil {
+		t.Fatal(err)
+	}
+	src.Spec.Caches = append(src.Spec.Caches, v1beta1.CacheSpec{Name: "pages", Type: v1beta1.CacheTypeMemcached})
+	src.Spec.EventStreams[0].Name = "events"
+	src.Status.EventStreams[0].Name = "events"
+	src.Spec.EventStreams = append(src.Spec.EventStreams, v1beta1.EventStreamSpec{Name: "jobs", Type: v1beta1.EventStreamTypeRabbitMQ})
+	src.Status.EventStreams = append(src.Status.EventStreams, v1beta1.EventStreamStatus{
+		Name:              "jobs",
+		Type:              v1beta1.EventStreamTypeRabbitMQ,
+		ConnectionDetails: v1beta1.ConnectionDetails{Hostname: "stream-rabbitmq.shop", Port: "5672"},
+	})
+
+	spoke := &Application{}
+	if err := spoke.ConvertFrom(src); err != nil {
+		t.Fatal(err)
+	}
+	if spoke.Spec.EventStreamRefs == nil || spoke.Spec.EventStreamRefs.Type != EventStreamTypeKafka {
+		t.Fatalf("expected the first event stream, got %v", spoke.Spec.EventStreamRefs)
+	}
+	if _, ok := spoke.Annotations[backingServicesAnnotation]; !ok {
+		t.Fatal("expected the other caches and event streams to be kept in an annotation")
+	}
+
+	dst := &v1beta1.Application{}
+	if err := spoke.ConvertTo(dst); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, src, dst)
+}
+
+func TestAppServiceRoundTrip(t *testing.T) {
+	src := testAppService()
+	hub := &v1beta1.AppService{}
+	if err := src.ConvertTo(hub); err != nil {
+		t.Fatal(err)
+	}
+	if port := hub.Spec.Containers[0].Ports[1].Port; port != 53 {
+		t.Fatalf("expected port 53, got %d", port)
+	}
+	if releaseName := hub.Spec.Databases[0].ReleaseName; releaseName != "db" {
+		t.Fatalf("expected the database to keep its v1alpha1 release, got %q", releaseName)
+	}
+
+	dst := &AppService{}
+	if err := dst.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, src, dst)
+
+	again := &v1beta1.AppService{}
+	if err := dst.ConvertTo(again); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, hub, again)
+}
+
+func TestAppServiceHubRoundTrip(t *testing.T) {
+	src := &v1beta1.AppService{}
+	if err := testAppService().ConvertTo(src); err != nil {
+		t.Fatal(err)
+	}
+	src.Spec.Databases[0].Isolation = v1beta1.DatabaseIsolationShared
+	src.Spec.Databases[0].ReleaseName = ""
+	src.Spec.Databases = append(src.Spec.Databases, v1beta1.DatabaseSpec{
+		Name:      "reports",
+		Type:      v1beta1.DatabaseTypeMySQL,
+		Isolation: v1beta1.DatabaseIsolationDedicated,
+	})
+	src.Status.Databases = append(src.Status.Databases, v1beta1.DatabaseStatus{
+		Name:              "reports",
+		Type:              v1beta1.DatabaseTypeMySQL,
+		ConnectionDetails: v1beta1.ConnectionDetails{Hostname: "db-web-reports-mysql.shop", Port: "3306"},
+	})
+
+	spoke := &AppService{}
+	if err := spoke.ConvertFrom(src); err != nil {
+		t.Fatal(err)
+	}
+	if spoke.Spec.DatabaseRef == nil || spoke.Spec.DatabaseRef.Type != DatabaseTypePostgreSQL {
+		t.Fatalf("expected the first database, got %v", spoke.Spec.DatabaseRef)
+	}
+
+	dst := &v1beta1.AppService{}
+	if err := spoke.ConvertTo(dst); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, src, dst)
+}
+
+func TestLegacyReleaseNames(t *testing.T) {
+	tests := []struct {
+		category    v1beta1.BackingServiceCategory
+		serviceType string
+		expected    string
+	}{
+		{v1beta1.BackingServiceCategoryCache, "Redis", "cache-redis"},
+		{v1beta1.BackingServiceCategoryCache, "Memcached", "cache-memcached"},
+		{v1beta1.BackingServiceCategoryEventStream, "Kafka", "stream-kafka"},
+		{v1beta1.BackingServiceCategoryEventStream, "RabbitMQ", "stream-rabbitmq"},
+		{v1beta1.BackingServiceCategoryEventStream, "NATS", "eventstream-nats"},
+		{v1beta1.BackingServiceCategoryDatabase, "PostgreSQL", "db"},
+		{v1beta1.BackingServiceCategoryDatabase, "MySQL", "db-mysql"},
+		{v1beta1.BackingServiceCategoryDatabase, "MongoDB", "database-mongodb"},
+	}
+	for _, tt := range tests {
+		if actual := legacyReleaseName(tt.category, tt.serviceType); actual != tt.expected {
+			t.Errorf("expected release %s for %s %s, got %s", tt.expected, tt.category, tt.serviceType, actual)
+		}
+	}
+}
+
+func TestAppResourceRoundTrip(t *testing.T) {
+	src := &AppResource{
+		ObjectMeta: metav1.ObjectMeta{Name: "bucket", Namespace: "shop"},
+		Spec: AppResourceSpec{
+			Category:   BackingServiceCategoryObjectStorage,
+			Type:       "MinIO",
+			Parameters: map[string]string{"defaultBuckets": "uploads"},
+			HelmValues: HelmValues{Values: &runtime.RawExtension{Raw: []byte(`{"mode":"standalone"}`)}},
+		},
+		Status: AppResourceStatus{
+			ReleaseName: "bucket",
+			Connection:  &ConnectionDetails{Hostname: "bucket-minio.shop", Port: "9000"},
+			Conditions:  testConditions(),
+		},
+	}
+	hub := &v1beta1.AppResource{}
+	if err := src.ConvertTo(hub); err != nil {
+		t.Fatal(err)
+	}
+	dst := &AppResource{}
+	if err := dst.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, src, dst)
+}
+
+func TestBackingServiceClassRoundTrip(t *testing.T) {
+	src := &BackingServiceClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "minio"},
+		Spec: BackingServiceClassSpec{
+			Category: BackingServiceCategoryObjectStorage,
+			Type:     "MinIO",
+			Chart:    ChartReference{Source: "https://charts.bitnami.com/bitnami", Name: "minio", Version: "6.7.2"},
+			Values:   &runtime.RawExtension{Raw: []byte(`{"mode":"standalone"}`)},
+			Connection: ConnectionMapping{
+				ServicePort: "minio",
+				Username:    "admin",
+				URL:         "http://{{ .ReleaseName }}-minio.{{ .Namespace }}:9000",
+			},
+		},
+	}
+	hub := &v1beta1.BackingServiceClass{}
+	if err := src.ConvertTo(hub); err != nil {
+		t.Fatal(err)
+	}
+	dst := &BackingServiceClass{}
+	if err := dst.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, src, dst)
+}
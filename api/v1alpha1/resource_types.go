@@ -20,20 +20,50 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// AppResourceSpec defines the desired state of AppResource
+// AppResourceSpec defines the desired state of AppResource, an instance of
+// a backing service installed in the namespace of an application
 type AppResourceSpec struct {
+	// Category is the category of the backing service
+	Category BackingServiceCategory `json:"category"`
+
+	// Type is the type of the backing service, a built-in one or one
+	// declared by a BackingServiceClass of the category. The category and
+	// type cannot change.
+	Type string `json:"type"`
+
+	// Parameters are Helm values of the release set by path, e.g.
+	// auth.database: orders. They take precedence over values.
+	// +optional
+	Parameters map[string]string `json:"parameters,omitempty"`
+
+	HelmValues `json:",inline"`
 }
 
 // AppResourceStatus defines the observed state of AppResource
 type AppResourceStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// ReleaseName is the name of the Helm release of the resource
+	// +optional
+	ReleaseName string `json:"releaseName,omitempty"`
+	// Connection are the details workloads use to connect to the resource
+	// +optional
+	Connection *ConnectionDetails `json:"connection,omitempty"`
+	// Conditions are the latest observations of the state of the resource
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +genclient
 // +kubebuilder:resource:path=resources,scope=Namespaced,singular=resource,shortName=csr,categories=cloudship
+// +kubebuilder:printcolumn:name="Category",type=string,JSONPath=`.spec.category`
+// +kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.type`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
 
 // AppResource is the Schema for the application resources API
 type AppResource struct {
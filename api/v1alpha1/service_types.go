@@ -17,11 +17,13 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// DatabaseType are the types of database supported
-// +kubebuilder:validation:Enum=MySQL;PostgreSQL
+// DatabaseType are the types of database supported. Types other than the
+// built-in ones are declared with a BackingServiceClass.
 type DatabaseType string
 
 const (
@@ -35,14 +37,88 @@ const (
 type DatabaseSpec struct {
 	// Type is the type of the database
 	Type DatabaseType `json:"type,omitempty"`
+
+	HelmValues `json:",inline"`
+}
+
+// WorkloadType is the kind of workload running the containers of an
+// AppService
+// +kubebuilder:validation:Enum=Deployment;StatefulSet;Job;CronJob
+type WorkloadType string
+
+const (
+	// WorkloadTypeDeployment runs the containers as a Deployment
+	WorkloadTypeDeployment WorkloadType = "Deployment"
+	// WorkloadTypeStatefulSet runs the containers as a StatefulSet, with a
+	// stable network identity and storage per replica
+	WorkloadTypeStatefulSet WorkloadType = "StatefulSet"
+	// WorkloadTypeJob runs the containers to completion once
+	WorkloadTypeJob WorkloadType = "Job"
+	// WorkloadTypeCronJob runs the containers to completion on a schedule
+	WorkloadTypeCronJob WorkloadType = "CronJob"
+)
+
+// VolumeClaimTemplate is a PersistentVolumeClaim created for every replica of
+// a StatefulSet and mounted in all of its containers
+type VolumeClaimTemplate struct {
+	// Name of the claim
+	Name string `json:"name"`
+
+	// MountPath is where the volume is mounted in the containers
+	MountPath string `json:"mountPath"`
+
+	// Size of the volume
+	Size resource.Quantity `json:"size"`
+
+	// StorageClassName is the storage class of the volume. Defaults to the
+	// default storage class of the cluster.
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+
+	// AccessModes of the volume. Defaults to ReadWriteOnce.
+	// +optional
+	AccessModes []corev1.PersistentVolumeAccessMode `json:"accessModes,omitempty"`
 }
 
+// TransportProtocol is the transport protocol of a port
+// +kubebuilder:validation:Enum=TCP;UDP;SCTP
+type TransportProtocol string
+
+const (
+	// TransportProtocolTCP is the TCP protocol
+	TransportProtocolTCP TransportProtocol = "TCP"
+	// TransportProtocolUDP is the UDP protocol
+	TransportProtocolUDP TransportProtocol = "UDP"
+	// TransportProtocolSCTP is the SCTP protocol
+	TransportProtocolSCTP TransportProtocol = "SCTP"
+)
+
+// ServiceType is the type of the Kubernetes Service exposing the ports of an
+// AppService
+// +kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer;Headless
+type ServiceType string
+
+const (
+	// ServiceTypeClusterIP exposes the ports inside the cluster
+	ServiceTypeClusterIP ServiceType = "ClusterIP"
+	// ServiceTypeNodePort exposes the ports on every node of the cluster
+	ServiceTypeNodePort ServiceType = "NodePort"
+	// ServiceTypeLoadBalancer exposes the ports through a load balancer
+	ServiceTypeLoadBalancer ServiceType = "LoadBalancer"
+	// ServiceTypeHeadless publishes the addresses of the pods in DNS,
+	// without a cluster IP
+	ServiceTypeHeadless ServiceType = "Headless"
+)
+
 // Service defines an Application Service
 type Service struct {
 	// Name of this service. Must be unique within its service.
 	Name string `json:"name"`
 	// Port is the number of the port
 	Port int32 `json:"portNumber"`
+	// Protocol is the transport protocol of the port. Defaults to TCP.
+	// +optional
+	Protocol *TransportProtocol `json:"protocol,omitempty"`
 }
 
 // Container defines a OCI container
@@ -55,6 +131,40 @@ type Container struct {
 	// and should be suffixed with a tag.
 	Image string `json:"image"`
 
+	// ImagePullSecret is the name of the Secret with the credentials of the
+	// registry of the image
+	// +optional
+	ImagePullSecret *string `json:"imagePullSecret,omitempty"`
+
+	// Command to be run by this container, instead of the entrypoint of the
+	// image
+	// +optional
+	Command []string `json:"command,omitempty"`
+
+	// Arguments to be passed to the command run by this container
+	// +optional
+	Arguments []string `json:"args,omitempty"`
+
+	// Environment variables of this container
+	// +optional
+	Environment []ContainerEnvVar `json:"env,omitempty"`
+
+	// Resources required by this container
+	// +optional
+	Resources *ContainerResources `json:"resources,omitempty"`
+
+	// LivenessProbe restarts this container when it fails
+	// +optional
+	LivenessProbe *ContainerHealthProbe `json:"livenessProbe,omitempty"`
+
+	// ReadinessProbe stops routing traffic to this container while it fails
+	// +optional
+	ReadinessProbe *ContainerHealthProbe `json:"readinessProbe,omitempty"`
+
+	// VolumeMounts are the volumes of the service mounted in this container
+	// +optional
+	VolumeMounts []VolumeMount `json:"volumeMounts,omitempty"`
+
 	// Ports are the ports that this container exposes
 	Ports []Service `json:"ports"`
 }
@@ -64,23 +174,71 @@ type AppServiceSpec struct {
 	// Containers of which this service consists.
 	Containers []Container `json:"containers"`
 
+	// WorkloadType is the kind of workload running the containers. Defaults
+	// to Deployment.
+	// +optional
+	WorkloadType WorkloadType `json:"workloadType,omitempty"`
+
+	// Schedule of a CronJob, in cron format
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+
+	// VolumeClaimTemplates are the volumes of every replica of a StatefulSet
+	// +optional
+	VolumeClaimTemplates []VolumeClaimTemplate `json:"volumeClaimTemplates,omitempty"`
+
+	// Volumes of the service, mounted by its containers
+	// +optional
+	Volumes []Volume `json:"volumes,omitempty"`
+
+	// ServiceType is the type of the Service exposing the ports of the
+	// containers. Defaults to ClusterIP.
+	// +optional
+	ServiceType ServiceType `json:"serviceType,omitempty"`
+
+	// Replicas is the number of replicas of the service. Ignored when
+	// autoscaling is set.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Autoscaling scales the service with a HorizontalPodAutoscaler
+	// +optional
+	Autoscaling *Autoscaling `json:"autoscaling,omitempty"`
+
+	// Expose makes the service reachable from outside the cluster
+	// +optional
+	Expose *Expose `json:"expose,omitempty"`
+
 	// DatabaseRef is the reference to database for the service
 	// +optional
 	DatabaseRef *DatabaseSpec `json:"databaseRef,omitempty"`
 }
 
+// DatabaseStatus is the status of the database
 type DatabaseStatus struct {
-	// Name is the name of the database
+	ConnectionDetails `json:",inline"`
+}
+
+// SharedDatabaseStatus is a database, and the user owning it, created for a
+// service on the shared database server of its type
+type SharedDatabaseStatus struct {
+	// Name is the name of the database in the service
 	Name string `json:"name"`
 
-	// Hostname is the hostname of the database
-	Hostname string `json:"hostname"`
+	// Type is the type of the database server
+	Type DatabaseType `json:"type"`
 
-	// Port is the port of the database
-	Port string `json:"port"`
+	// Database is the name of the database on the server
+	Database string `json:"database"`
 
-	// Username is the username to connecto to the database
+	// Username is the name of the user owning the database
 	Username string `json:"username"`
+
+	// Retained is set when the service no longer uses the database but keeps
+	// it because of the keep-replaced-releases annotation of the application
+	// +optional
+	Retained bool `json:"retained,omitempty"`
 }
 
 // AppServiceStatus defines the observed state of AppService
@@ -88,12 +246,38 @@ type AppServiceStatus struct {
 	// DatabaseStatusRef is the status of database
 	// +optional
 	DatabaseStatusRef *DatabaseStatus `json:"databaseStatusRef,omitempty"`
+	// Releases are the Helm releases installed for the database of the
+	// service
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Releases []ReleaseStatus `json:"releases,omitempty"`
+	// SharedDatabases are the databases created for the service on the
+	// shared database servers of the application
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	// +listMapKey=type
+	SharedDatabases []SharedDatabaseStatus `json:"sharedDatabases,omitempty"`
+	// URL is the public URL of the service, when it is exposed
+	// +optional
+	URL string `json:"url,omitempty"`
+	// Conditions are the latest observations of the state of the service
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +genclient
 // +kubebuilder:resource:path=services,scope=Namespaced,singular=service,shortName=css,categories=cloudship
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+// +kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.status.url`
 
 // AppService is the Schema for the application services API
 type AppService struct {
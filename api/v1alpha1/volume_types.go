@@ -0,0 +1,117 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// PersistentVolumeClaimVolume is a PersistentVolumeClaim created for the
+// service and shared by all of its replicas
+type PersistentVolumeClaimVolume struct {
+	// Size of the volume
+	Size resource.Quantity `json:"size"`
+
+	// StorageClassName is the storage class of the volume. Defaults to the
+	// default storage class of the cluster.
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+
+	// AccessModes of the volume. Defaults to ReadWriteOnce.
+	// +optional
+	AccessModes []corev1.PersistentVolumeAccessMode `json:"accessModes,omitempty"`
+}
+
+// KeyToPath projects a key of a ConfigMap or Secret to a file
+type KeyToPath struct {
+	// Key to project
+	Key string `json:"key"`
+	// Path of the file, relative to the mount path
+	Path string `json:"path"`
+}
+
+// FilesVolume mounts the keys of a ConfigMap or Secret in the namespace of
+// the service as files
+type FilesVolume struct {
+	// Name of the ConfigMap or Secret
+	Name string `json:"name"`
+
+	// Items are the keys projected to files. Every key is projected to a
+	// file named after it when empty.
+	// +optional
+	Items []KeyToPath `json:"items,omitempty"`
+
+	// DefaultMode are the permission bits of the files. Defaults to 0644.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=511
+	// +optional
+	DefaultMode *int32 `json:"defaultMode,omitempty"`
+}
+
+// EmptyDirVolume is a scratch directory living as long as the pod
+type EmptyDirVolume struct {
+	// InMemory backs the directory with memory instead of the disk of the
+	// node
+	// +optional
+	InMemory bool `json:"inMemory,omitempty"`
+
+	// SizeLimit is the most the directory may hold
+	// +optional
+	SizeLimit *resource.Quantity `json:"sizeLimit,omitempty"`
+}
+
+// Volume is a volume of a service, mounted by its containers. Exactly one of
+// persistentVolumeClaim, configMap, secret and emptyDir should be set.
+type Volume struct {
+	// Name of the volume. Must be unique within its service.
+	Name string `json:"name"`
+
+	// PersistentVolumeClaim is a claim created for the service, named
+	// <service>-<volume>
+	// +optional
+	PersistentVolumeClaim *PersistentVolumeClaimVolume `json:"persistentVolumeClaim,omitempty"`
+
+	// ConfigMap mounts the keys of a ConfigMap as files
+	// +optional
+	ConfigMap *FilesVolume `json:"configMap,omitempty"`
+
+	// Secret mounts the keys of a Secret as files
+	// +optional
+	Secret *FilesVolume `json:"secret,omitempty"`
+
+	// EmptyDir is a scratch directory
+	// +optional
+	EmptyDir *EmptyDirVolume `json:"emptyDir,omitempty"`
+}
+
+// VolumeMount mounts a volume in a container
+type VolumeMount struct {
+	// Name of the volume, or of a volume claim template of a StatefulSet
+	Name string `json:"name"`
+
+	// MountPath is where the volume is mounted in the container
+	MountPath string `json:"mountPath"`
+
+	// SubPath of the volume to mount instead of its root
+	// +optional
+	SubPath string `json:"subPath,omitempty"`
+
+	// ReadOnly mounts the volume read-only
+	// +optional
+	ReadOnly bool `json:"readOnly,omitempty"`
+}
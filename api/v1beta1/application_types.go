@@ -0,0 +1,233 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// KeepReplacedReleasesAnnotation keeps the releases of the backing
+	// services an application no longer uses, when set to "true", instead of
+	// uninstalling them. They are uninstalled once the annotation is removed,
+	// or when the application is deleted.
+	KeepReplacedReleasesAnnotation = "cloudship.toucansoft.io/keep-replaced-releases"
+)
+
+// EventStreamType are the types of event stream supported. Types other than
+// the built-in ones are declared with a BackingServiceClass.
+type EventStreamType string
+
+const (
+	// EventStreamTypeKafka use Kafka for Event Stream
+	EventStreamTypeKafka EventStreamType = "Kafka"
+	// EventStreamTypeRabbitMQ use RabbitMQ for Event Stream
+	EventStreamTypeRabbitMQ EventStreamType = "RabbitMQ"
+)
+
+// EventStreamSpec is the definition for Event Stream support for and applicaction
+type EventStreamSpec struct {
+	// Name is the name of the event stream, unique in the application. The name of its
+	// release and the prefix of its environment variables derive from it.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=32
+	Name string `json:"name"`
+
+	// Type is the type of the event stream
+	Type EventStreamType `json:"type"`
+
+	// ReleaseName is the name of the release of the event stream. Defaults to
+	// stream-<name>-<type>. Event streams converted from v1alpha1 keep the
+	// release they were installed with.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=53
+	// +optional
+	ReleaseName string `json:"releaseName,omitempty"`
+
+	HelmValues `json:",inline"`
+}
+
+// CacheType are the types of cache supported. Types other than the built-in
+// ones are declared with a BackingServiceClass.
+type CacheType string
+
+const (
+	// CacheTypeRedis use Redis for Cache
+	CacheTypeRedis CacheType = "Redis"
+	// CacheTypeMemcached use Memcached for Cache
+	CacheTypeMemcached CacheType = "Memcached"
+)
+
+// CacheSpec is the definition for Cache support for and applicaction
+type CacheSpec struct {
+	// Name is the name of the cache, unique in the application. The name of its
+	// release and the prefix of its environment variables derive from it.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=32
+	Name string `json:"name"`
+
+	// Type is the type of the cache
+	Type CacheType `json:"type"`
+
+	// ReleaseName is the name of the release of the cache. Defaults to
+	// cache-<name>-<type>. Caches converted from v1alpha1 keep the release
+	// they were installed with.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=53
+	// +optional
+	ReleaseName string `json:"releaseName,omitempty"`
+
+	HelmValues `json:",inline"`
+}
+
+// CacheStatus is the status of a cache
+type CacheStatus struct {
+	// Name is the name of the cache
+	Name string `json:"name"`
+
+	// Type is the type of the cache
+	Type CacheType `json:"type"`
+
+	ConnectionDetails `json:",inline"`
+}
+
+// EventStreamStatus is the status of an event stream
+type EventStreamStatus struct {
+	// Name is the name of the event stream
+	Name string `json:"name"`
+
+	// Type is the type of the event stream
+	Type EventStreamType `json:"type"`
+
+	ConnectionDetails `json:",inline"`
+
+	// Brokers are the addresses, as host:port, workloads bootstrap their
+	// connection to the event stream with
+	// +optional
+	Brokers []string `json:"brokers,omitempty"`
+}
+
+// DatabaseServerStatus is the status of a database server shared by the
+// services of an application
+type DatabaseServerStatus struct {
+	// Type is the type of the database server
+	Type DatabaseType `json:"type"`
+
+	// ConnectionDetails are the details the operator connects to the server
+	// with, as its administrator, to create the databases of the services
+	ConnectionDetails `json:",inline"`
+}
+
+// ReleaseStatus is a Helm release installed for a backing service of an
+// application or a service
+type ReleaseStatus struct {
+	// Name is the name of the release
+	Name string `json:"name"`
+	// Category is the category of the backing service of the release
+	Category BackingServiceCategory `json:"category"`
+	// Type is the type of the backing service of the release
+	Type string `json:"type"`
+	// Retained is set when the application no longer uses the release but
+	// keeps it because of the keep-replaced-releases annotation
+	// +optional
+	Retained bool `json:"retained,omitempty"`
+}
+
+// ApplicationSpec defines the desired state of Application
+type ApplicationSpec struct {
+	// Description is the name of the application
+	Description string `json:"description,omitempty"`
+
+	// Caches are the caches of the application
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Caches []CacheSpec `json:"caches,omitempty"`
+
+	// EventStreams are the event streams of the application
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	EventStreams []EventStreamSpec `json:"eventStreams,omitempty"`
+}
+
+// ApplicationStatus defines the observed state of Application
+type ApplicationStatus struct {
+	// Caches are the statuses of the caches
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Caches []CacheStatus `json:"caches,omitempty"`
+	// EventStreams are the statuses of the event streams
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	EventStreams []EventStreamStatus `json:"eventStreams,omitempty"`
+	// DatabaseServers are the statuses of the database servers shared by the
+	// services of the application
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	DatabaseServers []DatabaseServerStatus `json:"databaseServers,omitempty"`
+	// Deployment is the status of the deployment of the application
+	// +optional
+	Deployment string `json:"deployment,omitempty"`
+	// Releases are the Helm releases installed for the backing services of
+	// the application
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Releases []ReleaseStatus `json:"releases,omitempty"`
+	// Conditions are the latest observations of the state of the application
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// +kubebuilder:object:root=true
+// +genclient
+// +genclient:nonNamespaced
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+// +kubebuilder:resource:scope=Cluster,categories=cloudship,shortName=csa
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+
+// Application is the Schema for the applications API
+type Application struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ApplicationSpec   `json:"spec,omitempty"`
+	Status ApplicationStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ApplicationList contains a list of Application
+type ApplicationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Application `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Application{}, &ApplicationList{})
+}
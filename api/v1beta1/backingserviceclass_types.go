@@ -0,0 +1,137 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// BackingServiceCategory are the categories of backing services
+// +kubebuilder:validation:Enum=Cache;EventStream;Database;ObjectStorage
+type BackingServiceCategory string
+
+const (
+	// BackingServiceCategoryCache are backing services used as Cache
+	BackingServiceCategoryCache BackingServiceCategory = "Cache"
+	// BackingServiceCategoryEventStream are backing services used as Event Stream
+	BackingServiceCategoryEventStream BackingServiceCategory = "EventStream"
+	// BackingServiceCategoryDatabase are backing services used as Database
+	BackingServiceCategoryDatabase BackingServiceCategory = "Database"
+	// BackingServiceCategoryObjectStorage are backing services used as
+	// Object Storage. They are only provided by BackingServiceClasses.
+	BackingServiceCategoryObjectStorage BackingServiceCategory = "ObjectStorage"
+)
+
+// ChartReference is the reference to the Helm Chart of a backing service
+type ChartReference struct {
+	// Source is the location of the chart: a directory of chart archives, the
+	// URL of a chart repository, or an oci:// URL of a registry. The source
+	// configured for the operator is used if empty.
+	// +optional
+	Source string `json:"source,omitempty"`
+
+	// Name is the name of the chart
+	Name string `json:"name"`
+
+	// Version is the version of the chart
+	Version string `json:"version"`
+}
+
+// ConnectionMapping describes how workloads connect to a backing service.
+// Every field but ServicePort is a Go template rendered with .ReleaseName,
+// .Namespace, .Type and .Category.
+type ConnectionMapping struct {
+	// ServicePort is the name of the port of the Service rendered by the chart
+	// workloads connect to. The hostname and port are taken from that Service
+	// when they are not set.
+	// +optional
+	ServicePort string `json:"servicePort,omitempty"`
+
+	// Hostname is the hostname of the backing service
+	// +optional
+	Hostname string `json:"hostname,omitempty"`
+
+	// Port is the port of the backing service
+	// +optional
+	Port string `json:"port,omitempty"`
+
+	// Username is the username to connect to the backing service
+	// +optional
+	Username string `json:"username,omitempty"`
+
+	// Database is the name of the database, only used by databases
+	// +optional
+	Database string `json:"database,omitempty"`
+
+	// URL is the URL of the backing service, without the password
+	// +optional
+	URL string `json:"url,omitempty"`
+}
+
+// BackingServiceClassSpec defines the desired state of BackingServiceClass
+type BackingServiceClassSpec struct {
+	// Category is the category of the backing service
+	Category BackingServiceCategory `json:"category"`
+
+	// Type is the type of the backing service, as used by the type field of
+	// the cache, event stream and database references
+	Type string `json:"type"`
+
+	// Chart is the Helm Chart installed for the backing service
+	Chart ChartReference `json:"chart"`
+
+	// Values are the default values of the release
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	Values *runtime.RawExtension `json:"values,omitempty"`
+
+	// Connection describes how workloads connect to the backing service
+	Connection ConnectionMapping `json:"connection"`
+}
+
+// +kubebuilder:object:root=true
+// +genclient
+// +genclient:nonNamespaced
+// +kubebuilder:storageversion
+// +kubebuilder:resource:scope=Cluster,categories=cloudship,shortName=csbsc
+// +kubebuilder:printcolumn:name="Category",type=string,JSONPath=`.spec.category`
+// +kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.type`
+// +kubebuilder:printcolumn:name="Chart",type=string,JSONPath=`.spec.chart.name`
+// +kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.spec.chart.version`
+
+// BackingServiceClass is the Schema for the backing service classes API. It
+// declares a backing service offering that applications can request by type.
+type BackingServiceClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec BackingServiceClassSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// BackingServiceClassList contains a list of BackingServiceClass
+type BackingServiceClassList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []BackingServiceClass `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&BackingServiceClass{}, &BackingServiceClassList{})
+}
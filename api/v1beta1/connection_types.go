@@ -0,0 +1,51 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ConnectionDetails are the details workloads use to connect to a backing
+// service
+type ConnectionDetails struct {
+	// Hostname is the hostname of the backing service
+	Hostname string `json:"hostname"`
+
+	// Port is the port of the backing service
+	Port string `json:"port"`
+
+	// Username is the username to connect to the backing service
+	// +optional
+	Username string `json:"username,omitempty"`
+
+	// Database is the name of the database, only set for databases
+	// +optional
+	Database string `json:"database,omitempty"`
+
+	// PasswordSecretRef is the reference to the password of the user
+	// +optional
+	PasswordSecretRef *corev1.SecretKeySelector `json:"passwordSecretRef,omitempty"`
+
+	// TLS is true when connections to the backing service use TLS
+	// +optional
+	TLS bool `json:"tls,omitempty"`
+
+	// URL is the URL of the backing service, without the password
+	// +optional
+	URL string `json:"url,omitempty"`
+}
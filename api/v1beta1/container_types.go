@@ -0,0 +1,150 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// SecretKeySelector selects a key of a Secret in the namespace of the service
+type SecretKeySelector struct {
+	// Name of the Secret
+	Name string `json:"name"`
+	// Key of the Secret to select
+	Key string `json:"key"`
+}
+
+// ConfigMapKeySelector selects a key of a ConfigMap in the namespace of the
+// service
+type ConfigMapKeySelector struct {
+	// Name of the ConfigMap
+	Name string `json:"name"`
+	// Key of the ConfigMap to select
+	Key string `json:"key"`
+}
+
+// ContainerEnvVar is an environment variable of a container. Exactly one of
+// value, fromSecret and fromConfigMap should be set.
+type ContainerEnvVar struct {
+	// Name of the environment variable. Must be composed of valid Unicode
+	// letter and number characters, as well as _ and -.
+	// +kubebuilder:validation:Pattern=^[-_a-zA-Z0-9]+$
+	Name string `json:"name"`
+
+	// Value of the environment variable
+	// +optional
+	Value *string `json:"value,omitempty"`
+
+	// FromSecret is a key of a Secret the value is read from
+	// +optional
+	FromSecret *SecretKeySelector `json:"fromSecret,omitempty"`
+
+	// FromConfigMap is a key of a ConfigMap the value is read from
+	// +optional
+	FromConfigMap *ConfigMapKeySelector `json:"fromConfigMap,omitempty"`
+}
+
+// ResourceQuantity is the amount of a compute resource a container requires
+// and the most it may use.
+type ResourceQuantity struct {
+	// Required is the amount of the resource requested for the container
+	Required resource.Quantity `json:"required"`
+
+	// Limit is the most of the resource the container may use
+	// +optional
+	Limit *resource.Quantity `json:"limit,omitempty"`
+}
+
+// ContainerResources are the compute resources of a container
+type ContainerResources struct {
+	// CPU required by the container
+	// +optional
+	CPU *ResourceQuantity `json:"cpu,omitempty"`
+
+	// Memory required by the container
+	// +optional
+	Memory *ResourceQuantity `json:"memory,omitempty"`
+}
+
+// ExecProbe runs a command in the container
+type ExecProbe struct {
+	// Command to be run. Exiting with 0 is healthy.
+	Command []string `json:"command"`
+}
+
+// HTTPHeader is a header sent by an HTTP probe
+type HTTPHeader struct {
+	// Name of the header
+	Name string `json:"name"`
+	// Value of the header
+	Value string `json:"value"`
+}
+
+// HTTPGetProbe sends an HTTP GET request to the container
+type HTTPGetProbe struct {
+	// Path to request
+	Path string `json:"path"`
+	// Port to request
+	Port int32 `json:"port"`
+	// HTTPHeaders to send with the request
+	// +optional
+	HTTPHeaders []HTTPHeader `json:"httpHeaders,omitempty"`
+}
+
+// TCPSocketProbe opens a TCP connection to the container
+type TCPSocketProbe struct {
+	// Port to connect to
+	Port int32 `json:"port"`
+}
+
+// ContainerHealthProbe checks the health of a container. Exactly one of exec,
+// httpGet and tcpSocket should be set.
+type ContainerHealthProbe struct {
+	// Exec probes a container by running a command in it
+	// +optional
+	Exec *ExecProbe `json:"exec,omitempty"`
+
+	// HTTPGet probes a container by sending an HTTP GET request to it
+	// +optional
+	HTTPGet *HTTPGetProbe `json:"httpGet,omitempty"`
+
+	// TCPSocket probes a container by opening a TCP connection to it
+	// +optional
+	TCPSocket *TCPSocketProbe `json:"tcpSocket,omitempty"`
+
+	// InitialDelaySeconds after the container starts before the first probe
+	// +optional
+	InitialDelaySeconds *int32 `json:"initialDelaySeconds,omitempty"`
+
+	// TimeoutSeconds after which the probe times out
+	// +optional
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+
+	// PeriodSeconds between probes
+	// +optional
+	PeriodSeconds *int32 `json:"periodSeconds,omitempty"`
+
+	// SuccessThreshold is the number of consecutive successes for the probe
+	// to be considered successful after having failed
+	// +optional
+	SuccessThreshold *int32 `json:"successThreshold,omitempty"`
+
+	// FailureThreshold is the number of consecutive failures for the probe
+	// to be considered failed after having succeeded
+	// +optional
+	FailureThreshold *int32 `json:"failureThreshold,omitempty"`
+}
@@ -0,0 +1,30 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+// Hub marks Application as the version v1alpha1 is converted to and from.
+func (*Application) Hub() {}
+
+// Hub marks AppService as the version v1alpha1 is converted to and from.
+func (*AppService) Hub() {}
+
+// Hub marks AppResource as the version v1alpha1 is converted to and from.
+func (*AppResource) Hub() {}
+
+// Hub marks BackingServiceClass as the version v1alpha1 is converted to and
+// from.
+func (*BackingServiceClass) Hub() {}
@@ -0,0 +1,85 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+// IssuerKind is the kind of the cert-manager issuer of a certificate
+// +kubebuilder:validation:Enum=Issuer;ClusterIssuer
+type IssuerKind string
+
+const (
+	// IssuerKindIssuer is an issuer in the namespace of the service
+	IssuerKindIssuer IssuerKind = "Issuer"
+	// IssuerKindClusterIssuer is an issuer of the cluster
+	IssuerKindClusterIssuer IssuerKind = "ClusterIssuer"
+)
+
+// ExposeTLS is the TLS configuration of an exposed service. The certificate
+// is either read from SecretName or issued by cert-manager with Issuer.
+type ExposeTLS struct {
+	// SecretName is the name of the Secret with the certificate. Defaults to
+	// the name of the service followed by -tls when an issuer is set.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+
+	// Issuer is the name of the cert-manager issuer of the certificate
+	// +optional
+	Issuer string `json:"issuer,omitempty"`
+
+	// IssuerKind is the kind of the issuer. Defaults to ClusterIssuer.
+	// +optional
+	IssuerKind IssuerKind `json:"issuerKind,omitempty"`
+}
+
+// GatewayReference references the Gateway an HTTPRoute attaches to
+type GatewayReference struct {
+	// Name of the Gateway
+	Name string `json:"name"`
+
+	// Namespace of the Gateway. Defaults to the namespace of the service.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// Expose makes a service reachable from outside the cluster
+type Expose struct {
+	// Hosts the service is reachable at
+	// +kubebuilder:validation:MinItems=1
+	Hosts []string `json:"hosts"`
+
+	// Paths routed to the service, as prefixes. Defaults to /.
+	// +optional
+	Paths []string `json:"paths,omitempty"`
+
+	// Port is the port of the service traffic is routed to. Defaults to the
+	// first port of the service.
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// TLS serves the hosts over HTTPS
+	// +optional
+	TLS *ExposeTLS `json:"tls,omitempty"`
+
+	// IngressClassName is the class of the Ingress exposing the service
+	// +optional
+	IngressClassName *string `json:"ingressClassName,omitempty"`
+
+	// Gateway is the Gateway the service is attached to with an HTTPRoute,
+	// when the Gateway API is installed in the cluster. An Ingress is used
+	// otherwise.
+	// +optional
+	Gateway *GatewayReference `json:"gateway,omitempty"`
+}
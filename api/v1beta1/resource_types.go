@@ -0,0 +1,89 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AppResourceSpec defines the desired state of AppResource, an instance of
+// a backing service installed in the namespace of an application
+type AppResourceSpec struct {
+	// Category is the category of the backing service
+	Category BackingServiceCategory `json:"category"`
+
+	// Type is the type of the backing service, a built-in one or one
+	// declared by a BackingServiceClass of the category. The category and
+	// type cannot change.
+	Type string `json:"type"`
+
+	// Parameters are Helm values of the release set by path, e.g.
+	// auth.database: orders. They take precedence over values.
+	// +optional
+	Parameters map[string]string `json:"parameters,omitempty"`
+
+	HelmValues `json:",inline"`
+}
+
+// AppResourceStatus defines the observed state of AppResource
+type AppResourceStatus struct {
+	// ReleaseName is the name of the Helm release of the resource
+	// +optional
+	ReleaseName string `json:"releaseName,omitempty"`
+	// Connection are the details workloads use to connect to the resource
+	// +optional
+	Connection *ConnectionDetails `json:"connection,omitempty"`
+	// Conditions are the latest observations of the state of the resource
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+// +genclient
+// +kubebuilder:resource:path=resources,scope=Namespaced,singular=resource,shortName=csr,categories=cloudship
+// +kubebuilder:printcolumn:name="Category",type=string,JSONPath=`.spec.category`
+// +kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.type`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+
+// AppResource is the Schema for the application resources API
+type AppResource struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AppResourceSpec   `json:"spec,omitempty"`
+	Status AppResourceStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// AppResourceList contains a list of AppResource
+type AppResourceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AppResource `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AppResource{}, &AppResourceList{})
+}
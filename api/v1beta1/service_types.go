@@ -0,0 +1,348 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DatabaseType are the types of database supported. Types other than the
+// built-in ones are declared with a BackingServiceClass.
+type DatabaseType string
+
+const (
+	// DatabaseTypeMySQL use MySQL for Database
+	DatabaseTypeMySQL DatabaseType = "MySQL"
+	// DatabaseTypePostgreSQL use PostgreSQL for Database
+	DatabaseTypePostgreSQL DatabaseType = "PostgreSQL"
+)
+
+// DatabaseIsolation is how the database of a service is isolated from the
+// databases of the other services of the application
+// +kubebuilder:validation:Enum=Dedicated;Shared
+type DatabaseIsolation string
+
+const (
+	// DatabaseIsolationDedicated installs a database server for the database
+	DatabaseIsolationDedicated DatabaseIsolation = "Dedicated"
+	// DatabaseIsolationShared creates the database, and a user owning it, on
+	// a server of its type shared by the services of the application. Only
+	// the built-in types can be shared.
+	DatabaseIsolationShared DatabaseIsolation = "Shared"
+)
+
+// DatabaseSpec is the definition for Database support for the service
+type DatabaseSpec struct {
+	// Name is the name of the database, unique in the service. The name of its
+	// release and the prefix of its environment variables derive from it.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=32
+	Name string `json:"name"`
+
+	// Type is the type of the database
+	Type DatabaseType `json:"type"`
+
+	// Isolation is how the database is isolated from the databases of the
+	// other services. Defaults to Dedicated.
+	// +optional
+	Isolation DatabaseIsolation `json:"isolation,omitempty"`
+
+	// ReleaseName is the name of the release of a dedicated database.
+	// Defaults to db-<service>-<name>-<type>. Databases converted from
+	// v1alpha1 keep the release they were installed with.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=53
+	// +optional
+	ReleaseName string `json:"releaseName,omitempty"`
+
+	// HelmValues are the values of the release of a dedicated database. The
+	// shared servers are installed with the default values.
+	HelmValues `json:",inline"`
+}
+
+// WorkloadType is the kind of workload running the containers of an
+// AppService
+// +kubebuilder:validation:Enum=Deployment;StatefulSet;Job;CronJob
+type WorkloadType string
+
+const (
+	// WorkloadTypeDeployment runs the containers as a Deployment
+	WorkloadTypeDeployment WorkloadType = "Deployment"
+	// WorkloadTypeStatefulSet runs the containers as a StatefulSet, with a
+	// stable network identity and storage per replica
+	WorkloadTypeStatefulSet WorkloadType = "StatefulSet"
+	// WorkloadTypeJob runs the containers to completion once
+	WorkloadTypeJob WorkloadType = "Job"
+	// WorkloadTypeCronJob runs the containers to completion on a schedule
+	WorkloadTypeCronJob WorkloadType = "CronJob"
+)
+
+// VolumeClaimTemplate is a PersistentVolumeClaim created for every replica of
+// a StatefulSet and mounted in all of its containers
+type VolumeClaimTemplate struct {
+	// Name of the claim
+	Name string `json:"name"`
+
+	// MountPath is where the volume is mounted in the containers
+	MountPath string `json:"mountPath"`
+
+	// Size of the volume
+	Size resource.Quantity `json:"size"`
+
+	// StorageClassName is the storage class of the volume. Defaults to the
+	// default storage class of the cluster.
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+
+	// AccessModes of the volume. Defaults to ReadWriteOnce.
+	// +optional
+	AccessModes []corev1.PersistentVolumeAccessMode `json:"accessModes,omitempty"`
+}
+
+// TransportProtocol is the transport protocol of a port
+// +kubebuilder:validation:Enum=TCP;UDP;SCTP
+type TransportProtocol string
+
+const (
+	// TransportProtocolTCP is the TCP protocol
+	TransportProtocolTCP TransportProtocol = "TCP"
+	// TransportProtocolUDP is the UDP protocol
+	TransportProtocolUDP TransportProtocol = "UDP"
+	// TransportProtocolSCTP is the SCTP protocol
+	TransportProtocolSCTP TransportProtocol = "SCTP"
+)
+
+// ServiceType is the type of the Kubernetes Service exposing the ports of an
+// AppService
+// +kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer;Headless
+type ServiceType string
+
+const (
+	// ServiceTypeClusterIP exposes the ports inside the cluster
+	ServiceTypeClusterIP ServiceType = "ClusterIP"
+	// ServiceTypeNodePort exposes the ports on every node of the cluster
+	ServiceTypeNodePort ServiceType = "NodePort"
+	// ServiceTypeLoadBalancer exposes the ports through a load balancer
+	ServiceTypeLoadBalancer ServiceType = "LoadBalancer"
+	// ServiceTypeHeadless publishes the addresses of the pods in DNS,
+	// without a cluster IP
+	ServiceTypeHeadless ServiceType = "Headless"
+)
+
+// Service defines an Application Service
+type Service struct {
+	// Name of this service. Must be unique within its service.
+	Name string `json:"name"`
+	// Port is the number of the port
+	Port int32 `json:"port"`
+	// Protocol is the transport protocol of the port. Defaults to TCP.
+	// +optional
+	Protocol *TransportProtocol `json:"protocol,omitempty"`
+}
+
+// Container defines a OCI container
+type Container struct {
+	// Name of this container. Must be unique within its service.
+	Name string `json:"name"`
+
+	// Image this container should run. Must be a path-like or URI-like
+	// representation of an OCI image. May be prefixed with a registry address
+	// and should be suffixed with a tag.
+	Image string `json:"image"`
+
+	// ImagePullSecret is the name of the Secret with the credentials of the
+	// registry of the image
+	// +optional
+	ImagePullSecret *string `json:"imagePullSecret,omitempty"`
+
+	// Command to be run by this container, instead of the entrypoint of the
+	// image
+	// +optional
+	Command []string `json:"command,omitempty"`
+
+	// Arguments to be passed to the command run by this container
+	// +optional
+	Arguments []string `json:"args,omitempty"`
+
+	// Environment variables of this container
+	// +optional
+	Environment []ContainerEnvVar `json:"env,omitempty"`
+
+	// Resources required by this container
+	// +optional
+	Resources *ContainerResources `json:"resources,omitempty"`
+
+	// LivenessProbe restarts this container when it fails
+	// +optional
+	LivenessProbe *ContainerHealthProbe `json:"livenessProbe,omitempty"`
+
+	// ReadinessProbe stops routing traffic to this container while it fails
+	// +optional
+	ReadinessProbe *ContainerHealthProbe `json:"readinessProbe,omitempty"`
+
+	// VolumeMounts are the volumes of the service mounted in this container
+	// +optional
+	VolumeMounts []VolumeMount `json:"volumeMounts,omitempty"`
+
+	// Ports are the ports that this container exposes
+	Ports []Service `json:"ports"`
+}
+
+// AppServiceSpec defines the desired state of AppService
+type AppServiceSpec struct {
+	// Containers of which this service consists.
+	Containers []Container `json:"containers"`
+
+	// WorkloadType is the kind of workload running the containers. Defaults
+	// to Deployment.
+	// +optional
+	WorkloadType WorkloadType `json:"workloadType,omitempty"`
+
+	// Schedule of a CronJob, in cron format
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+
+	// VolumeClaimTemplates are the volumes of every replica of a StatefulSet
+	// +optional
+	VolumeClaimTemplates []VolumeClaimTemplate `json:"volumeClaimTemplates,omitempty"`
+
+	// Volumes of the service, mounted by its containers
+	// +optional
+	Volumes []Volume `json:"volumes,omitempty"`
+
+	// ServiceType is the type of the Service exposing the ports of the
+	// containers. Defaults to ClusterIP.
+	// +optional
+	ServiceType ServiceType `json:"serviceType,omitempty"`
+
+	// Replicas is the number of replicas of the service. Ignored when
+	// autoscaling is set.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Autoscaling scales the service with a HorizontalPodAutoscaler
+	// +optional
+	Autoscaling *Autoscaling `json:"autoscaling,omitempty"`
+
+	// Expose makes the service reachable from outside the cluster
+	// +optional
+	Expose *Expose `json:"expose,omitempty"`
+
+	// Databases are the databases of the service
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Databases []DatabaseSpec `json:"databases,omitempty"`
+}
+
+// DatabaseStatus is the status of a database
+type DatabaseStatus struct {
+	// Name is the name of the database
+	Name string `json:"name"`
+
+	// Type is the type of the database
+	Type DatabaseType `json:"type"`
+
+	ConnectionDetails `json:",inline"`
+}
+
+// SharedDatabaseStatus is a database, and the user owning it, created for a
+// service on the shared database server of its type
+type SharedDatabaseStatus struct {
+	// Name is the name of the database in the service
+	Name string `json:"name"`
+
+	// Type is the type of the database server
+	Type DatabaseType `json:"type"`
+
+	// Database is the name of the database on the server
+	Database string `json:"database"`
+
+	// Username is the name of the user owning the database
+	Username string `json:"username"`
+
+	// Retained is set when the service no longer uses the database but keeps
+	// it because of the keep-replaced-releases annotation of the application
+	// +optional
+	Retained bool `json:"retained,omitempty"`
+}
+
+// AppServiceStatus defines the observed state of AppService
+type AppServiceStatus struct {
+	// Databases are the statuses of the databases
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Databases []DatabaseStatus `json:"databases,omitempty"`
+	// Releases are the Helm releases installed for the databases of the
+	// service
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Releases []ReleaseStatus `json:"releases,omitempty"`
+	// SharedDatabases are the databases created for the service on the
+	// shared database servers of the application
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	// +listMapKey=type
+	SharedDatabases []SharedDatabaseStatus `json:"sharedDatabases,omitempty"`
+	// URL is the public URL of the service, when it is exposed
+	// +optional
+	URL string `json:"url,omitempty"`
+	// Conditions are the latest observations of the state of the service
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+// +genclient
+// +kubebuilder:resource:path=services,scope=Namespaced,singular=service,shortName=css,categories=cloudship
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+// +kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.status.url`
+
+// AppService is the Schema for the application services API
+type AppService struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AppServiceSpec   `json:"spec,omitempty"`
+	Status AppServiceStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// AppServiceList contains a list of AppService
+type AppServiceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AppService `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AppService{}, &AppServiceList{})
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ValuesSourceKind are the kinds of objects Helm values can be read from
+// +kubebuilder:validation:Enum=ConfigMap;Secret
+type ValuesSourceKind string
+
+const (
+	// ValuesSourceKindConfigMap reads the values from a ConfigMap
+	ValuesSourceKindConfigMap ValuesSourceKind = "ConfigMap"
+	// ValuesSourceKindSecret reads the values from a Secret
+	ValuesSourceKindSecret ValuesSourceKind = "Secret"
+)
+
+// ValuesReference is a reference to Helm values stored in a ConfigMap or a
+// Secret in the namespace of the backing service
+type ValuesReference struct {
+	// Kind is the kind of the referenced object
+	Kind ValuesSourceKind `json:"kind"`
+
+	// Name is the name of the referenced object
+	Name string `json:"name"`
+
+	// ValuesKey is the data key of the values. Defaults to values.yaml
+	// +optional
+	ValuesKey string `json:"valuesKey,omitempty"`
+
+	// TargetPath is the dot separated path of the value set with the content
+	// of the key, e.g. auth.password. When empty the content of the key is
+	// a YAML document merged at the root of the values.
+	// +optional
+	TargetPath string `json:"targetPath,omitempty"`
+
+	// Optional marks the reference as optional, a missing object or key is
+	// ignored
+	// +optional
+	Optional bool `json:"optional,omitempty"`
+}
+
+// HelmValues are the values a backing service release is installed with.
+// They are merged over the defaults of the backing service: first the
+// references in ValuesFrom, in order, and then Values.
+type HelmValues struct {
+	// Values are Helm values of the release
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	Values *runtime.RawExtension `json:"values,omitempty"`
+
+	// ValuesFrom are references to ConfigMaps and Secrets with Helm values of
+	// the release
+	// +optional
+	ValuesFrom []ValuesReference `json:"valuesFrom,omitempty"`
+}
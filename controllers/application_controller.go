@@ -18,47 +18,55 @@ package controllers
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"net"
+	"sort"
+	"strings"
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
-	"helm.sh/helm/v3/pkg/storage/driver"
-
-	cloudshipv1alpha1 "github.com/ToucanSoftware/cloudship-operator/api/v1alpha1"
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
 	"github.com/ToucanSoftware/cloudship-operator/pkg/helm/release"
+	"github.com/ToucanSoftware/cloudship-operator/pkg/types"
 )
 
 const (
 	// uninstallFinalizer is added to CRs so they are cleaned up after uninstalling a release.
-	uninstallFinalizer = "cloudship.toucansfot.io/uninstall-application"
+	uninstallFinalizer = "cloudship.toucansoft.io/uninstall-application"
 )
 
 // ApplicationReconciler reconciles a Application object
 type ApplicationReconciler struct {
 	client.Client
-	Log                      logr.Logger
-	Scheme                   *runtime.Scheme
-	MemecachedManagerFactory release.ManagerFactory
-	RedisManagerFactory      release.ManagerFactory
-	RabbitMQManagerFactory   release.ManagerFactory
-	KafkaManagerFactory      release.ManagerFactory
-	EventRecorder            record.EventRecorder
+	Log           logr.Logger
+	Scheme        *runtime.Scheme
+	Catalog       release.Catalog
+	EventRecorder record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=cloudship.toucansoft.io,resources=applications,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=cloudship.toucansoft.io,resources=applications/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=cloudship.toucansoft.io,resources=applications/finalizers,verbs=update
 // +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=cloudship.toucansoft.io,resources=backingserviceclasses,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -69,7 +77,7 @@ func (r *ApplicationReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	log := r.Log.WithValues("application", req.NamespacedName)
 	log.Info(fmt.Sprintf("Reconcilate Application: %s", req.Name))
 
-	var app cloudshipv1alpha1.Application
+	var app cloudshipv1beta1.Application
 
 	if err := r.Get(ctx, req.NamespacedName, &app); err != nil {
 		if apierrors.IsNotFound(err) {
@@ -78,7 +86,18 @@ func (r *ApplicationReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	//status := types.StatusFor(&app)
+	if app.GetDeletionTimestamp() != nil {
+		return r.finalizeApplication(ctx, log, &app)
+	}
+	if !controllerutil.ContainsFinalizer(&app, uninstallFinalizer) {
+		controllerutil.AddFinalizer(&app, uninstallFinalizer)
+		if err := r.Update(ctx, &app); err != nil {
+			log.Error(err, "Failed to add uninstall finalizer")
+			return ctrl.Result{}, err
+		}
+	}
+
+	status := types.StatusFor(&app)
 
 	// Reder Namespace base on the application name
 	namespace := r.renderNamespace(&app)
@@ -86,40 +105,207 @@ func (r *ApplicationReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	ctrl.SetControllerReference(&app, namespace, r.Scheme)
 	// server side apply, only the fields we set are touched
 	applyOpts := []client.PatchOption{client.ForceOwnership, client.FieldOwner(app.GetUID())}
+	created := apierrors.IsNotFound(r.Get(ctx, client.ObjectKeyFromObject(namespace), &corev1.Namespace{}))
 	if err := r.Patch(ctx, namespace, client.Apply, applyOpts...); err != nil {
 		log.Error(err, "Failed to apply to a Namespace")
-		//r.record.Event(eventObj, event.Warning(errApplyDeployment, err))
-		return ReconcileWaitResult, client.IgnoreNotFound(err)
+		r.EventRecorder.Eventf(&app, corev1.EventTypeWarning, eventApplyNamespaceFailed, errApplyNamespace, namespace.GetName(), err)
+		return ctrl.Result{}, r.failReconcile(ctx, log, &app, status, err)
+	}
+	if created {
+		r.EventRecorder.Eventf(&app, corev1.EventTypeNormal, eventNamespaceCreated, "Created namespace %s", namespace.GetName())
 	}
 
-	err = r.reconcileCache(ctx, log, namespace, &app)
+	cacheReady, err := r.reconcileCaches(ctx, log, namespace, &app, status)
 	if err != nil {
-		return ctrl.Result{}, client.IgnoreNotFound(err)
+		return ctrl.Result{}, r.failReconcile(ctx, log, &app, status, err)
 	}
 	log.Info(fmt.Sprintf("Application %s: Cache Reconcilated", req.Name))
 
-	err = r.processEventStream(ctx, log, namespace, &app)
+	eventStreamReady, err := r.processEventStreams(ctx, log, namespace, &app, status)
 	if err != nil {
-		return ctrl.Result{}, client.IgnoreNotFound(err)
+		return ctrl.Result{}, r.failReconcile(ctx, log, &app, status, err)
 	}
 	log.Info(fmt.Sprintf("Application %s: Event Stream Reconcilated", req.Name))
+
+	databaseServerReady, sharedTypes, err := r.reconcileDatabaseServers(ctx, log, namespace, &app, status)
+	if err != nil {
+		return ctrl.Result{}, r.failReconcile(ctx, log, &app, status, err)
+	}
+	log.Info(fmt.Sprintf("Application %s: Database Servers Reconcilated", req.Name))
+
+	// replaced releases go once the services can move to their replacement
+	result := ctrl.Result{}
+	ready := cacheReady && eventStreamReady && databaseServerReady
+	if ready {
+		keep := app.GetAnnotations()[cloudshipv1beta1.KeepReplacedReleasesAnnotation] == "true"
+		uninstalled, err := uninstallReplacedReleases(ctx, log, r.EventRecorder, &app, &status.Releases, keep,
+			func(rel cloudshipv1beta1.ReleaseStatus) bool { return releaseWanted(&app, sharedTypes, rel) },
+			func(rel cloudshipv1beta1.ReleaseStatus) (release.Manager, error) {
+				return r.releaseManager(ctx, log, app.GetName(), &app, rel)
+			})
+		if err != nil {
+			return ctrl.Result{}, r.failReconcile(ctx, log, &app, status, err)
+		}
+		if !uninstalled {
+			result = uninstallWaitResult
+		}
+	}
 	log.Info(fmt.Sprintf("Application %s: Reconcilated", req.Name))
 
-	if err := r.Status().Update(ctx, &app); err != nil {
-		return ReconcileWaitResult, err
+	if ready {
+		types.SetCondition(&status.Conditions, &app, cloudshipv1beta1.ConditionReady, metav1.ConditionTrue,
+			cloudshipv1beta1.ReasonReady, "The backing services of the application are ready")
+	} else {
+		types.SetCondition(&status.Conditions, &app, cloudshipv1beta1.ConditionReady, metav1.ConditionFalse,
+			cloudshipv1beta1.ReasonNotReady, "Waiting for the backing services of the application to be ready")
+	}
+	if err := r.updateResourceStatus(ctx, &app, status); err != nil {
+		log.Error(err, "Failed to update application status")
+		return ctrl.Result{}, err
 	}
-	return ReconcileWaitResult, nil
+	return result, nil
 }
 
-// SetupWithManager sets up the controller with the Manager.
+// failReconcile marks the application as not ready because of err and
+// returns err.
+func (r *ApplicationReconciler) failReconcile(ctx context.Context, log logr.Logger,
+	app *cloudshipv1beta1.Application, status *cloudshipv1beta1.ApplicationStatus, err error) error {
+	types.SetCondition(&status.Conditions, app, cloudshipv1beta1.ConditionReady, metav1.ConditionFalse,
+		cloudshipv1beta1.ReasonReconcileError, err.Error())
+	if err := r.updateResourceStatus(ctx, app, status); err != nil {
+		log.Error(err, "Failed to update application status")
+	}
+	return err
+}
+
+// finalizeApplication uninstalls the backing services of a deleted
+// application in dependency order: the services of the application and their
+// databases along with its resources first, then the shared database
+// servers, the event streams and last the caches. The finalizer is removed,
+// letting the application and its namespace go, only after every release and
+// its resources are gone.
+func (r *ApplicationReconciler) finalizeApplication(ctx context.Context, log logr.Logger, app *cloudshipv1beta1.Application) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(app, uninstallFinalizer) {
+		log.Info("Resource is terminated, skipping reconciliation")
+		return ctrl.Result{}, nil
+	}
+
+	var appServices cloudshipv1beta1.AppServiceList
+	if err := r.List(ctx, &appServices, client.InNamespace(app.GetName())); err != nil {
+		return ctrl.Result{}, err
+	}
+	for i := range appServices.Items {
+		appService := &appServices.Items[i]
+		if appService.GetDeletionTimestamp() != nil {
+			continue
+		}
+		if err := r.Delete(ctx, appService); client.IgnoreNotFound(err) != nil {
+			log.Error(err, fmt.Sprintf("Failed to delete service %s", appService.GetName()))
+			return ctrl.Result{}, err
+		}
+	}
+	var appResources cloudshipv1beta1.AppResourceList
+	if err := r.List(ctx, &appResources, client.InNamespace(app.GetName())); err != nil {
+		return ctrl.Result{}, err
+	}
+	for i := range appResources.Items {
+		appResource := &appResources.Items[i]
+		if appResource.GetDeletionTimestamp() != nil {
+			continue
+		}
+		if err := r.Delete(ctx, appResource); client.IgnoreNotFound(err) != nil {
+			log.Error(err, fmt.Sprintf("Failed to delete resource %s", appResource.GetName()))
+			return ctrl.Result{}, err
+		}
+	}
+	if len(appServices.Items) > 0 || len(appResources.Items) > 0 {
+		log.Info(fmt.Sprintf("Waiting for %d services and %d resources of application %s to be deleted",
+			len(appServices.Items), len(appResources.Items), app.GetName()))
+		return uninstallWaitResult, nil
+	}
+
+	// releases replaced by the application go along with the ones in use.
+	// The services are gone, so are the shared database servers they used.
+	var replaced []func(context.Context, logr.Logger, string, *cloudshipv1beta1.Application) (release.Manager, error)
+	for _, category := range []cloudshipv1beta1.BackingServiceCategory{
+		cloudshipv1beta1.BackingServiceCategoryDatabase,
+		cloudshipv1beta1.BackingServiceCategoryEventStream,
+		cloudshipv1beta1.BackingServiceCategoryCache,
+	} {
+		for _, rel := range app.Status.Releases {
+			if rel.Category != category || releaseWanted(app, nil, rel) {
+				continue
+			}
+			rel := rel
+			replaced = append(replaced, func(ctx context.Context, log logr.Logger, namespace string, app *cloudshipv1beta1.Application) (release.Manager, error) {
+				return r.releaseManager(ctx, log, namespace, app, rel)
+			})
+		}
+	}
+
+	var inUse []func(context.Context, logr.Logger, string, *cloudshipv1beta1.Application) (release.Manager, error)
+	for i := range app.Spec.EventStreams {
+		eventStream := &app.Spec.EventStreams[i]
+		inUse = append(inUse, func(ctx context.Context, log logr.Logger, namespace string, app *cloudshipv1beta1.Application) (release.Manager, error) {
+			return r.eventStreamManager(ctx, log, namespace, app, eventStream)
+		})
+	}
+	for i := range app.Spec.Caches {
+		cache := &app.Spec.Caches[i]
+		inUse = append(inUse, func(ctx context.Context, log logr.Logger, namespace string, app *cloudshipv1beta1.Application) (release.Manager, error) {
+			return r.cacheManager(ctx, log, namespace, app, cache)
+		})
+	}
+
+	for _, newManager := range append(replaced, inUse...) {
+		manager, err := newManager(ctx, log, app.GetName(), app)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		uninstalled, err := uninstallRelease(ctx, log, r.EventRecorder, manager, app)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !uninstalled {
+			return uninstallWaitResult, nil
+		}
+	}
+
+	controllerutil.RemoveFinalizer(app, uninstallFinalizer)
+	if err := r.Update(ctx, app); err != nil {
+		log.Error(err, "Failed to remove uninstall finalizer")
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	log.Info(fmt.Sprintf("Application %s: Uninstalled", app.GetName()))
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager. Applications are
+// reconciled when their namespace, the workloads of their backing services or
+// the specs of the services in their namespace change.
 func (r *ApplicationReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&cloudshipv1alpha1.Application{}).
-		Complete(r)
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&cloudshipv1beta1.Application{}).
+		Owns(&corev1.Namespace{}).
+		Watches(&source.Kind{Type: &cloudshipv1beta1.AppService{}},
+			handler.EnqueueRequestsFromMapFunc(applicationForObject),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}))
+	for _, workload := range releaseWorkloads() {
+		b = b.Watches(&source.Kind{Type: workload},
+			handler.EnqueueRequestsFromMapFunc(applicationForObject),
+			builder.WithPredicates(helmManaged))
+	}
+	return b.Complete(r)
+}
+
+// applicationForObject maps an object to the application owning its
+// namespace.
+func applicationForObject(obj client.Object) []reconcile.Request {
+	return []reconcile.Request{{NamespacedName: k8stypes.NamespacedName{Name: obj.GetNamespace()}}}
 }
 
 // SetupWithManager sets up the controller with the Manager.
-func (r *ApplicationReconciler) renderNamespace(app *cloudshipv1alpha1.Application) *corev1.Namespace {
+func (r *ApplicationReconciler) renderNamespace(app *cloudshipv1beta1.Application) *corev1.Namespace {
 	return &corev1.Namespace{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       namespaceKind,
@@ -131,131 +317,366 @@ func (r *ApplicationReconciler) renderNamespace(app *cloudshipv1alpha1.Applicati
 	}
 }
 
-func (r *ApplicationReconciler) reconcileCache(ctx context.Context, log logr.Logger, namespace *corev1.Namespace, app *cloudshipv1alpha1.Application) error {
-	if app.Spec.CacheRef == nil {
+// reconcileCaches reconciles the caches of the application and reports
+// whether they are all ready. An application without caches is always ready.
+func (r *ApplicationReconciler) reconcileCaches(ctx context.Context, log logr.Logger, namespace *corev1.Namespace,
+	app *cloudshipv1beta1.Application, status *cloudshipv1beta1.ApplicationStatus) (bool, error) {
+	if len(app.Spec.Caches) == 0 {
 		log.Info(fmt.Sprintf("No cache for application %s", app.GetName()))
-		return nil
+		status.Caches = nil
+		meta.RemoveStatusCondition(&status.Conditions, cloudshipv1beta1.ConditionCacheReady)
+		return true, nil
 	}
-	log.Info(fmt.Sprintf("Reconcile cache for application %s", app.GetName()))
 
-	var overrideValues map[string]string
-	var cacheManagerFactory release.ManagerFactory
+	var statuses []cloudshipv1beta1.CacheStatus
+	var notReady []string
+	for i := range app.Spec.Caches {
+		cache := &app.Spec.Caches[i]
+		log.Info(fmt.Sprintf("Reconcile cache %s for application %s", cache.Name, app.GetName()))
+
+		manager, err := r.cacheManager(ctx, log, namespace.GetName(), app, cache)
+		if err != nil {
+			types.SetCondition(&status.Conditions, app, cloudshipv1beta1.ConditionCacheReady, metav1.ConditionFalse,
+				cloudshipv1beta1.ReasonReconcileError, err.Error())
+			return false, err
+		}
+		recordRelease(&status.Releases, manager.ReleaseName(), cloudshipv1beta1.BackingServiceCategoryCache, string(cache.Type))
+		ready, err := reconcileRelease(ctx, log, r.EventRecorder, manager, app, &status.Conditions, cloudshipv1beta1.ConditionCacheReady)
+		if err != nil {
+			return false, err
+		}
+		if !ready {
+			notReady = append(notReady, manager.ReleaseName())
+		}
 
-	switch app.Spec.CacheRef.Type {
-	case cloudshipv1alpha1.CacheTypeMemcached:
-		log.Info(fmt.Sprintf("Reconcile Memcached for application %s", app.GetName()))
-		cacheManagerFactory = r.MemecachedManagerFactory
-	case cloudshipv1alpha1.CacheTypeRedis:
-		log.Info(fmt.Sprintf("Reconcile Redis for application %s", app.GetName()))
-		cacheManagerFactory = r.RedisManagerFactory
-	default:
-		return fmt.Errorf("No Manager Factory for %v", app.Spec.CacheRef.Type)
+		details, err := manager.ConnectionDetails()
+		if err != nil {
+			log.Error(err, "Failed to get cache connection details")
+			return false, err
+		}
+		if previous := cacheStatus(status.Caches, cache.Name); previous != nil {
+			recordConnectionChange(r.EventRecorder, app, fmt.Sprintf("cache %s", cache.Name), &previous.ConnectionDetails, details)
+		}
+		statuses = append(statuses, cloudshipv1beta1.CacheStatus{
+			Name:              cache.Name,
+			Type:              cache.Type,
+			ConnectionDetails: *details,
+		})
+	}
+	status.Caches = statuses
+
+	// the condition holds the outcome of the last release, unless another
+	// one is not ready
+	if len(notReady) > 0 {
+		types.SetCondition(&status.Conditions, app, cloudshipv1beta1.ConditionCacheReady, metav1.ConditionFalse,
+			cloudshipv1beta1.ReasonWorkloadsNotReady, fmt.Sprintf("Releases %s are not ready", strings.Join(notReady, ", ")))
+		return false, nil
 	}
+	return true, nil
+}
 
-	if err := r.Status().Update(ctx, app); err != nil {
-		return err
+// cacheStatus returns the status of the cache named name, or nil if there is
+// none.
+func cacheStatus(statuses []cloudshipv1beta1.CacheStatus, name string) *cloudshipv1beta1.CacheStatus {
+	for i := range statuses {
+		if statuses[i].Name == name {
+			return &statuses[i]
+		}
 	}
+	return nil
+}
+
+// processEventStreams reconciles the event streams of the application and
+// reports whether they are all ready. An application without event streams
+// is always ready.
+func (r *ApplicationReconciler) processEventStreams(ctx context.Context, log logr.Logger, namespace *corev1.Namespace,
+	app *cloudshipv1beta1.Application, status *cloudshipv1beta1.ApplicationStatus) (bool, error) {
+	if len(app.Spec.EventStreams) == 0 {
+		log.Info(fmt.Sprintf("No event stream for application %s", app.GetName()))
+		status.EventStreams = nil
+		meta.RemoveStatusCondition(&status.Conditions, cloudshipv1beta1.ConditionEventStreamReady)
+		return true, nil
+	}
+
+	var statuses []cloudshipv1beta1.EventStreamStatus
+	var notReady []string
+	for i := range app.Spec.EventStreams {
+		eventStream := &app.Spec.EventStreams[i]
+		log.Info(fmt.Sprintf("Processing event stream %s for application %s", eventStream.Name, app.GetName()))
 
-	manager, err := cacheManagerFactory.NewManager(namespace.GetName(), overrideValues)
+		manager, err := r.eventStreamManager(ctx, log, namespace.GetName(), app, eventStream)
+		if err != nil {
+			types.SetCondition(&status.Conditions, app, cloudshipv1beta1.ConditionEventStreamReady, metav1.ConditionFalse,
+				cloudshipv1beta1.ReasonReconcileError, err.Error())
+			return false, err
+		}
+		recordRelease(&status.Releases, manager.ReleaseName(), cloudshipv1beta1.BackingServiceCategoryEventStream, string(eventStream.Type))
+		ready, err := reconcileRelease(ctx, log, r.EventRecorder, manager, app, &status.Conditions, cloudshipv1beta1.ConditionEventStreamReady)
+		if err != nil {
+			return false, err
+		}
+		if !ready {
+			notReady = append(notReady, manager.ReleaseName())
+		}
+
+		details, err := manager.ConnectionDetails()
+		if err != nil {
+			log.Error(err, "Failed to get event stream connection details")
+			return false, err
+		}
+		if previous := eventStreamStatus(status.EventStreams, eventStream.Name); previous != nil {
+			recordConnectionChange(r.EventRecorder, app, fmt.Sprintf("event stream %s", eventStream.Name), &previous.ConnectionDetails, details)
+		}
+		statuses = append(statuses, cloudshipv1beta1.EventStreamStatus{
+			Name:              eventStream.Name,
+			Type:              eventStream.Type,
+			ConnectionDetails: *details,
+			Brokers:           []string{net.JoinHostPort(details.Hostname, details.Port)},
+		})
+	}
+	status.EventStreams = statuses
+
+	// the condition holds the outcome of the last release, unless another
+	// one is not ready
+	if len(notReady) > 0 {
+		types.SetCondition(&status.Conditions, app, cloudshipv1beta1.ConditionEventStreamReady, metav1.ConditionFalse,
+			cloudshipv1beta1.ReasonWorkloadsNotReady, fmt.Sprintf("Releases %s are not ready", strings.Join(notReady, ", ")))
+		return false, nil
+	}
+	return true, nil
+}
+
+// eventStreamStatus returns the status of the event stream named name, or
+// nil if there is none.
+func eventStreamStatus(statuses []cloudshipv1beta1.EventStreamStatus, name string) *cloudshipv1beta1.EventStreamStatus {
+	for i := range statuses {
+		if statuses[i].Name == name {
+			return &statuses[i]
+		}
+	}
+	return nil
+}
+
+// reconcileDatabaseServers reconciles the database servers shared by the
+// services of the application, one for each type of their shared databases,
+// and reports whether they are all ready along with their types. Only the
+// ready servers are published in the status, the services create their
+// databases on them.
+func (r *ApplicationReconciler) reconcileDatabaseServers(ctx context.Context, log logr.Logger, namespace *corev1.Namespace,
+	app *cloudshipv1beta1.Application, status *cloudshipv1beta1.ApplicationStatus) (bool, []cloudshipv1beta1.DatabaseType, error) {
+	sharedTypes, err := r.sharedDatabaseTypes(ctx, namespace.GetName())
 	if err != nil {
-		log.Error(err, "Failed to get release manager")
-		return err
+		log.Error(err, "Failed to list the shared databases of the services")
+		return false, nil, err
 	}
+	if len(sharedTypes) == 0 {
+		status.DatabaseServers = nil
+		meta.RemoveStatusCondition(&status.Conditions, cloudshipv1beta1.ConditionDatabaseReady)
+		return true, nil, nil
+	}
+
+	var statuses []cloudshipv1beta1.DatabaseServerStatus
+	var notReady []string
+	for _, databaseType := range sharedTypes {
+		manager, err := r.databaseServerManager(ctx, log, namespace.GetName(), app, databaseType)
+		if err != nil {
+			types.SetCondition(&status.Conditions, app, cloudshipv1beta1.ConditionDatabaseReady, metav1.ConditionFalse,
+				cloudshipv1beta1.ReasonReconcileError, err.Error())
+			return false, sharedTypes, err
+		}
+		recordRelease(&status.Releases, manager.ReleaseName(), cloudshipv1beta1.BackingServiceCategoryDatabase, string(databaseType))
+		ready, err := reconcileRelease(ctx, log, r.EventRecorder, manager, app, &status.Conditions, cloudshipv1beta1.ConditionDatabaseReady)
+		if err != nil {
+			return false, sharedTypes, err
+		}
+		if !ready {
+			notReady = append(notReady, manager.ReleaseName())
+			continue
+		}
 
-	app.Status.Cache = &cloudshipv1alpha1.CacheStatus{
-		Hostname: manager.Hostname(app),
-		Port:     manager.Port(),
+		details, err := manager.AdminConnectionDetails()
+		if err != nil {
+			log.Error(err, "Failed to get database server connection details")
+			return false, sharedTypes, err
+		}
+		if previous := databaseServerStatus(status.DatabaseServers, databaseType); previous != nil {
+			recordConnectionChange(r.EventRecorder, app, fmt.Sprintf("shared %s server", databaseType), &previous.ConnectionDetails, details)
+		}
+		statuses = append(statuses, cloudshipv1beta1.DatabaseServerStatus{
+			Type:              databaseType,
+			ConnectionDetails: *details,
+		})
+	}
+	status.DatabaseServers = statuses
+
+	// the condition holds the outcome of the last release, unless another
+	// one is not ready
+	if len(notReady) > 0 {
+		types.SetCondition(&status.Conditions, app, cloudshipv1beta1.ConditionDatabaseReady, metav1.ConditionFalse,
+			cloudshipv1beta1.ReasonWorkloadsNotReady, fmt.Sprintf("Releases %s are not ready", strings.Join(notReady, ", ")))
+		return false, sharedTypes, nil
 	}
+	return true, sharedTypes, nil
+}
 
-	return r.reconcileFromManager(ctx, log, manager, app)
+// sharedDatabaseTypes returns the sorted types of the shared databases of the
+// services in the namespace of an application.
+func (r *ApplicationReconciler) sharedDatabaseTypes(ctx context.Context, namespace string) ([]cloudshipv1beta1.DatabaseType, error) {
+	var appServices cloudshipv1beta1.AppServiceList
+	if err := r.List(ctx, &appServices, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	seen := map[cloudshipv1beta1.DatabaseType]bool{}
+	var sharedTypes []cloudshipv1beta1.DatabaseType
+	for _, appService := range appServices.Items {
+		for _, database := range appService.Spec.Databases {
+			if database.Isolation != cloudshipv1beta1.DatabaseIsolationShared || seen[database.Type] {
+				continue
+			}
+			seen[database.Type] = true
+			sharedTypes = append(sharedTypes, database.Type)
+		}
+	}
+	sort.Slice(sharedTypes, func(i, j int) bool { return sharedTypes[i] < sharedTypes[j] })
+	return sharedTypes, nil
 }
 
-func (r *ApplicationReconciler) processEventStream(ctx context.Context, log logr.Logger, namespace *corev1.Namespace, app *cloudshipv1alpha1.Application) error {
-	if app.Spec.EventStreamRefs == nil {
-		log.Info(fmt.Sprintf("No event stream for application %s", app.GetName()))
-		return nil
+// databaseServerStatus returns the status of the shared database server of a
+// type, or nil if there is none.
+func databaseServerStatus(statuses []cloudshipv1beta1.DatabaseServerStatus, databaseType cloudshipv1beta1.DatabaseType) *cloudshipv1beta1.DatabaseServerStatus {
+	for i := range statuses {
+		if statuses[i].Type == databaseType {
+			return &statuses[i]
+		}
 	}
-	log.Info(fmt.Sprintf("Processing event stream for application %s", app.GetName()))
+	return nil
+}
 
-	var overrideValues map[string]string
-	var eventStreamManagerFactory release.ManagerFactory
-
-	switch app.Spec.EventStreamRefs.Type {
-	case cloudshipv1alpha1.EventStreamTypeRabbitMQ:
-		log.Info(fmt.Sprintf("Reconcile RabbitMQ for application %s", app.GetName()))
-		eventStreamManagerFactory = r.RabbitMQManagerFactory
-		//app.Status.EventStream = "Ra"
-	case cloudshipv1alpha1.EventStreamTypeKafka:
-		log.Info(fmt.Sprintf("Reconcile Kafka for application %s", app.GetName()))
-		eventStreamManagerFactory = r.KafkaManagerFactory
-	// 	app.Status.Cache = "Redis"
-	default:
-		return fmt.Errorf("No Manager Factory for %v", app.Spec.EventStreamRefs.Type)
-	}
-	manager, err := eventStreamManagerFactory.NewManager(namespace.GetName(), overrideValues)
+// releaseWanted reports whether the application still uses the backing
+// service of a release recorded in its status. sharedTypes are the types of
+// the database servers its services share.
+func releaseWanted(app *cloudshipv1beta1.Application, sharedTypes []cloudshipv1beta1.DatabaseType,
+	rel cloudshipv1beta1.ReleaseStatus) bool {
+	switch rel.Category {
+	case cloudshipv1beta1.BackingServiceCategoryCache:
+		for i := range app.Spec.Caches {
+			cache := &app.Spec.Caches[i]
+			if release.CacheReleaseName(cache) == rel.Name && string(cache.Type) == rel.Type {
+				return true
+			}
+		}
+	case cloudshipv1beta1.BackingServiceCategoryEventStream:
+		for i := range app.Spec.EventStreams {
+			eventStream := &app.Spec.EventStreams[i]
+			if release.EventStreamReleaseName(eventStream) == rel.Name && string(eventStream.Type) == rel.Type {
+				return true
+			}
+		}
+	case cloudshipv1beta1.BackingServiceCategoryDatabase:
+		for _, databaseType := range sharedTypes {
+			if release.SharedDatabaseReleaseName(string(databaseType)) == rel.Name && string(databaseType) == rel.Type {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// releaseManager returns the release manager of a release recorded in the
+// status of the application.
+func (r *ApplicationReconciler) releaseManager(ctx context.Context, log logr.Logger, namespace string,
+	app *cloudshipv1beta1.Application, rel cloudshipv1beta1.ReleaseStatus) (release.Manager, error) {
+	factory, err := r.Catalog.ManagerFactory(ctx, rel.Category, rel.Type)
+	if err != nil {
+		return nil, err
+	}
+	manager, err := factory.ForRelease(rel.Name).NewManager(ctx, app, namespace, nil, nil)
 	if err != nil {
 		log.Error(err, "Failed to get release manager")
-		return err
+		return nil, err
 	}
-	return r.reconcileFromManager(ctx, log, manager, app)
+	return manager, nil
 }
 
-func (r *ApplicationReconciler) reconcileFromManager(ctx context.Context, log logr.Logger, manager release.Manager, app *cloudshipv1alpha1.Application) error {
-	// Check if the application has been delete
-	if app.GetDeletionTimestamp() != nil {
-		// Check for finalizer
-		if !controllerutil.ContainsFinalizer(app, uninstallFinalizer) {
-			log.Info("Resource is terminated, skipping reconciliation")
-			return nil
-		}
-
-		_, err := manager.UninstallRelease(ctx)
-		if err != nil && !errors.Is(err, driver.ErrReleaseNotFound) {
-			log.Error(err, "Failed to uninstall release")
-			// status.SetCondition(types.HelmAppCondition{
-			// 	Type:    types.ConditionReleaseFailed,
-			// 	Status:  types.StatusTrue,
-			// 	Reason:  types.ReasonUninstallError,
-			// 	Message: err.Error(),
-			// })
-			// if err := r.updateResourceStatus(ctx, o, status); err != nil {
-			// 	log.Error(err, "Failed to update status after uninstall release failure")
-			// }
-			return err
-		}
+// cacheManager returns the release manager of a cache of the application.
+func (r *ApplicationReconciler) cacheManager(ctx context.Context, log logr.Logger, namespace string,
+	app *cloudshipv1beta1.Application, cache *cloudshipv1beta1.CacheSpec) (release.Manager, error) {
+	var overrideValues map[string]string
+
+	cacheManagerFactory, err := r.Catalog.ManagerFactory(ctx, cloudshipv1beta1.BackingServiceCategoryCache, string(cache.Type))
+	if err != nil {
+		return nil, err
 	}
+	log.Info(fmt.Sprintf("Reconcile %s cache %s for application %s", cache.Type, cache.Name, app.GetName()))
 
-	if err := manager.Sync(ctx); err != nil {
-		log.Error(err, "Failed to sync release")
-		// status.SetCondition(types.HelmAppCondition{
-		// 	Type:    types.ConditionIrreconcilable,
-		// 	Status:  types.StatusTrue,
-		// 	Reason:  types.ReasonReconcileError,
-		// 	Message: err.Error(),
-		// })
-		// if err := r.updateResourceStatus(ctx, o, status); err != nil {
-		// 	log.Error(err, "Failed to update status after sync release failure")
-		// }
-		return err
+	values, err := release.ResolveValues(ctx, r.Client, namespace, cache.HelmValues)
+	if err != nil {
+		log.Error(err, "Failed to resolve cache values")
+		return nil, err
+	}
+	releaseName := release.CacheReleaseName(cache)
+	manager, err := cacheManagerFactory.ForRelease(releaseName).NewManager(ctx, app, namespace, values, overrideValues)
+	if err != nil {
+		log.Error(err, "Failed to get release manager")
+		return nil, err
 	}
-	//	status.RemoveCondition(types.ConditionIrreconcilable)
+	return manager, nil
+}
 
-	if !manager.IsInstalled() {
-		log.Info(fmt.Sprintf("Installing Cache Release %s", app.GetName()))
-		rel, err := manager.InstallRelease(ctx)
-		if err != nil {
-			log.Error(err, "Release failed")
-			return err
-		}
-		//status := types.StatusFor(o)
-		log.Info(fmt.Sprintf("Cache with name %s for application %s installed", rel.Name, app.GetName()))
+// eventStreamManager returns the release manager of an event stream of the
+// application.
+func (r *ApplicationReconciler) eventStreamManager(ctx context.Context, log logr.Logger, namespace string,
+	app *cloudshipv1beta1.Application, eventStream *cloudshipv1beta1.EventStreamSpec) (release.Manager, error) {
+	var overrideValues map[string]string
+
+	eventStreamManagerFactory, err := r.Catalog.ManagerFactory(ctx, cloudshipv1beta1.BackingServiceCategoryEventStream, string(eventStream.Type))
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	log.Info(fmt.Sprintf("Reconcile %s event stream %s for application %s", eventStream.Type, eventStream.Name, app.GetName()))
+	values, err := release.ResolveValues(ctx, r.Client, namespace, eventStream.HelmValues)
+	if err != nil {
+		log.Error(err, "Failed to resolve event stream values")
+		return nil, err
+	}
+	releaseName := release.EventStreamReleaseName(eventStream)
+	manager, err := eventStreamManagerFactory.ForRelease(releaseName).NewManager(ctx, app, namespace, values, overrideValues)
+	if err != nil {
+		log.Error(err, "Failed to get release manager")
+		return nil, err
+	}
+	return manager, nil
 }
 
-func (r *ApplicationReconciler) updateResourceStatus(ctx context.Context, app *cloudshipv1alpha1.Application, status *cloudshipv1alpha1.ApplicationStatus) error {
+// databaseServerManager returns the release manager of the database server of
+// a type shared by the services of the application. Shared servers are
+// installed with the default values of their type.
+func (r *ApplicationReconciler) databaseServerManager(ctx context.Context, log logr.Logger, namespace string,
+	app *cloudshipv1beta1.Application, databaseType cloudshipv1beta1.DatabaseType) (release.Manager, error) {
+	factory, err := r.Catalog.ManagerFactory(ctx, cloudshipv1beta1.BackingServiceCategoryDatabase, string(databaseType))
+	if err != nil {
+		return nil, err
+	}
+	log.Info(fmt.Sprintf("Reconcile shared %s server for application %s", databaseType, app.GetName()))
+	releaseName := release.SharedDatabaseReleaseName(string(databaseType))
+	manager, err := factory.ForRelease(releaseName).NewManager(ctx, app, namespace, nil, nil)
+	if err != nil {
+		log.Error(err, "Failed to get release manager")
+		return nil, err
+	}
+	return manager, nil
+}
+
+// updateResourceStatus patches the status of the application, retrying on
+// conflicts with the latest version of it.
+func (r *ApplicationReconciler) updateResourceStatus(ctx context.Context, app *cloudshipv1beta1.Application, status *cloudshipv1beta1.ApplicationStatus) error {
 	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
-		app.Status = *status
-		return r.Client.Status().Update(ctx, app)
+		latest := &cloudshipv1beta1.Application{}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(app), latest); err != nil {
+			return err
+		}
+		patch := client.MergeFromWithOptions(latest.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		latest.Status = *status
+		return r.Status().Patch(ctx, latest, patch)
 	})
 }
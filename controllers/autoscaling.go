@@ -0,0 +1,149 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+	"github.com/ToucanSoftware/cloudship-operator/pkg/types"
+)
+
+// +kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+
+var (
+	// hpaGVK is the version of HorizontalPodAutoscaler applied. The
+	// autoscaling/v2beta2 types are rendered as autoscaling/v2, which has
+	// the same schema.
+	hpaGVK = schema.GroupVersionKind{Group: "autoscaling", Version: "v2", Kind: "HorizontalPodAutoscaler"}
+)
+
+// newHPA returns an empty HorizontalPodAutoscaler of the applied version.
+func newHPA() *unstructured.Unstructured {
+	hpa := &unstructured.Unstructured{}
+	hpa.SetGroupVersionKind(hpaGVK)
+	return hpa
+}
+
+// hpaServed reports whether the cluster serves the applied version of
+// HorizontalPodAutoscaler.
+func hpaServed(mapper meta.RESTMapper) bool {
+	_, err := mapper.RESTMapping(hpaGVK.GroupKind(), hpaGVK.Version)
+	return err == nil
+}
+
+// reconcileAutoscaling applies the HorizontalPodAutoscaler of the service
+// scaling its Deployment or StatefulSet, or deletes it when the service is not autoscaled.
+func (r *AppServiceReconciler) reconcileAutoscaling(ctx context.Context, appService *cloudshipv1beta1.AppService,
+	workload types.Object, opts ...client.PatchOption) error {
+	served := hpaServed(r.RESTMapper())
+	if appService.Spec.Autoscaling == nil {
+		if !served {
+			return nil
+		}
+		return r.deleteOwned(ctx, appService, newHPA())
+	}
+	if !served {
+		return fmt.Errorf("the cluster does not serve %s", hpaGVK.GroupVersion())
+	}
+	target, ok := scaleTarget(workload)
+	if !ok {
+		return fmt.Errorf("a %s cannot be autoscaled", workload.GetObjectKind().GroupVersionKind().Kind)
+	}
+	hpa, err := renderHPA(appService, target)
+	if err != nil {
+		return err
+	}
+	if err := ctrl.SetControllerReference(appService, hpa, r.Scheme); err != nil {
+		return err
+	}
+	return r.Patch(ctx, hpa, client.Apply, opts...)
+}
+
+// renderHPA renders the HorizontalPodAutoscaler scaling the workload of the
+// service.
+func renderHPA(appService *cloudshipv1beta1.AppService, target autoscalingv2beta2.CrossVersionObjectReference) (*unstructured.Unstructured, error) {
+	autoscaling := appService.Spec.Autoscaling
+	spec := autoscalingv2beta2.HorizontalPodAutoscalerSpec{
+		ScaleTargetRef: target,
+		MinReplicas:    autoscaling.MinReplicas,
+		MaxReplicas:    autoscaling.MaxReplicas,
+	}
+	for name, utilization := range map[corev1.ResourceName]*int32{
+		corev1.ResourceCPU:    autoscaling.TargetCPUUtilizationPercentage,
+		corev1.ResourceMemory: autoscaling.TargetMemoryUtilizationPercentage,
+	} {
+		if utilization == nil {
+			continue
+		}
+		spec.Metrics = append(spec.Metrics, autoscalingv2beta2.MetricSpec{
+			Type: autoscalingv2beta2.ResourceMetricSourceType,
+			Resource: &autoscalingv2beta2.ResourceMetricSource{
+				Name: name,
+				Target: autoscalingv2beta2.MetricTarget{
+					Type:               autoscalingv2beta2.UtilizationMetricType,
+					AverageUtilization: utilization,
+				},
+			},
+		})
+	}
+	for _, m := range autoscaling.Metrics {
+		identifier := autoscalingv2beta2.MetricIdentifier{Name: m.Name}
+		if len(m.Selector) > 0 {
+			identifier.Selector = &metav1.LabelSelector{MatchLabels: m.Selector}
+		}
+		value := m.TargetAverageValue
+		target := autoscalingv2beta2.MetricTarget{
+			Type:         autoscalingv2beta2.AverageValueMetricType,
+			AverageValue: &value,
+		}
+		switch m.Type {
+		case cloudshipv1beta1.CustomMetricTypePods:
+			spec.Metrics = append(spec.Metrics, autoscalingv2beta2.MetricSpec{
+				Type: autoscalingv2beta2.PodsMetricSourceType,
+				Pods: &autoscalingv2beta2.PodsMetricSource{Metric: identifier, Target: target},
+			})
+		case cloudshipv1beta1.CustomMetricTypeExternal:
+			spec.Metrics = append(spec.Metrics, autoscalingv2beta2.MetricSpec{
+				Type:     autoscalingv2beta2.ExternalMetricSourceType,
+				External: &autoscalingv2beta2.ExternalMetricSource{Metric: identifier, Target: target},
+			})
+		}
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&spec)
+	if err != nil {
+		return nil, err
+	}
+	hpa := newHPA()
+	hpa.Object["spec"] = content
+	hpa.SetName(appService.GetName())
+	hpa.SetNamespace(appService.GetNamespace())
+	hpa.SetLabels(map[string]string{labelKey: string(appService.GetUID())})
+	return hpa, nil
+}
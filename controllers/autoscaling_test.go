@@ -0,0 +1,168 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+)
+
+func TestRenderHPA(t *testing.T) {
+	one, cpu, memory := int32(1), int32(70), int32(80)
+	queue := resource.MustParse("30")
+	requests := resource.MustParse("100")
+	target := autoscalingv2beta2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "web"}
+
+	utilization := func(name corev1.ResourceName, value *int32) autoscalingv2beta2.MetricSpec {
+		return autoscalingv2beta2.MetricSpec{
+			Type: autoscalingv2beta2.ResourceMetricSourceType,
+			Resource: &autoscalingv2beta2.ResourceMetricSource{
+				Name: name,
+				Target: autoscalingv2beta2.MetricTarget{
+					Type:               autoscalingv2beta2.UtilizationMetricType,
+					AverageUtilization: value,
+				},
+			},
+		}
+	}
+	tests := []struct {
+		name        string
+		autoscaling cloudshipv1beta1.Autoscaling
+		resources   []autoscalingv2beta2.MetricSpec
+		custom      []autoscalingv2beta2.MetricSpec
+	}{
+		{name: "no metric", autoscaling: cloudshipv1beta1.Autoscaling{MaxReplicas: 3}},
+		{
+			name:        "CPU",
+			autoscaling: cloudshipv1beta1.Autoscaling{MinReplicas: &one, MaxReplicas: 3, TargetCPUUtilizationPercentage: &cpu},
+			resources:   []autoscalingv2beta2.MetricSpec{utilization(corev1.ResourceCPU, &cpu)},
+		},
+		{
+			name: "CPU and memory",
+			autoscaling: cloudshipv1beta1.Autoscaling{
+				MaxReplicas:                       3,
+				TargetCPUUtilizationPercentage:    &cpu,
+				TargetMemoryUtilizationPercentage: &memory,
+			},
+			resources: []autoscalingv2beta2.MetricSpec{
+				utilization(corev1.ResourceCPU, &cpu),
+				utilization(corev1.ResourceMemory, &memory),
+			},
+		},
+		{
+			name: "Pods and External",
+			autoscaling: cloudshipv1beta1.Autoscaling{
+				MaxReplicas:                       5,
+				TargetMemoryUtilizationPercentage: &memory,
+				Metrics: []cloudshipv1beta1.CustomMetric{
+					{Type: cloudshipv1beta1.CustomMetricTypePods, Name: "http_requests", TargetAverageValue: requests},
+					{
+						Type:               cloudshipv1beta1.CustomMetricTypeExternal,
+						Name:               "queue_messages",
+						Selector:           map[string]string{"queue": "orders"},
+						TargetAverageValue: queue,
+					},
+				},
+			},
+			resources: []autoscalingv2beta2.MetricSpec{utilization(corev1.ResourceMemory, &memory)},
+			custom: []autoscalingv2beta2.MetricSpec{
+				{
+					Type: autoscalingv2beta2.PodsMetricSourceType,
+					Pods: &autoscalingv2beta2.PodsMetricSource{
+						Metric: autoscalingv2beta2.MetricIdentifier{Name: "http_requests"},
+						Target: autoscalingv2beta2.MetricTarget{
+							Type:         autoscalingv2beta2.AverageValueMetricType,
+							AverageValue: &requests,
+						},
+					},
+				},
+				{
+					Type: autoscalingv2beta2.ExternalMetricSourceType,
+					External: &autoscalingv2beta2.ExternalMetricSource{
+						Metric: autoscalingv2beta2.MetricIdentifier{
+							Name:     "queue_messages",
+							Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"queue": "orders"}},
+						},
+						Target: autoscalingv2beta2.MetricTarget{
+							Type:         autoscalingv2beta2.AverageValueMetricType,
+							AverageValue: &queue,
+						},
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			autoscaling := tt.autoscaling
+			as := &cloudshipv1beta1.AppService{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop", UID: "web-uid"},
+				Spec:       cloudshipv1beta1.AppServiceSpec{Autoscaling: &autoscaling},
+			}
+			hpa, err := renderHPA(as, target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hpa.GroupVersionKind() != hpaGVK || hpa.GetName() != "web" || hpa.GetNamespace() != "shop" ||
+				hpa.GetLabels()[labelKey] != "web-uid" {
+				t.Errorf("expected the labelled %s shop/web, got %v", hpaGVK, hpa.Object)
+			}
+
+			var spec autoscalingv2beta2.HorizontalPodAutoscalerSpec
+			content := hpa.Object["spec"].(map[string]interface{})
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, &spec); err != nil {
+				t.Fatal(err)
+			}
+			if spec.ScaleTargetRef != target || spec.MaxReplicas != autoscaling.MaxReplicas ||
+				!reflect.DeepEqual(spec.MinReplicas, autoscaling.MinReplicas) {
+				t.Errorf("expected to scale %v between %v and %d replicas, got %+v",
+					target, autoscaling.MinReplicas, autoscaling.MaxReplicas, spec)
+			}
+
+			// resource metrics come first, in no particular order
+			if len(spec.Metrics) != len(tt.resources)+len(tt.custom) {
+				t.Fatalf("expected %d metrics, got %v", len(tt.resources)+len(tt.custom), spec.Metrics)
+			}
+			resources := map[corev1.ResourceName]autoscalingv2beta2.MetricSpec{}
+			for _, m := range spec.Metrics[:len(tt.resources)] {
+				if m.Resource == nil {
+					t.Fatalf("expected a resource metric, got %v", m)
+				}
+				resources[m.Resource.Name] = m
+			}
+			for _, m := range tt.resources {
+				if !reflect.DeepEqual(resources[m.Resource.Name], m) {
+					t.Errorf("expected the metric %v, got %v", m, resources[m.Resource.Name])
+				}
+			}
+			custom := spec.Metrics[len(tt.resources):]
+			for i, m := range tt.custom {
+				if !reflect.DeepEqual(custom[i], m) {
+					t.Errorf("expected the metric %v, got %v", m, custom[i])
+				}
+			}
+		})
+	}
+}
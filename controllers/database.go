@@ -0,0 +1,182 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+	"github.com/ToucanSoftware/cloudship-operator/pkg/helm/release"
+	"github.com/ToucanSoftware/cloudship-operator/pkg/types"
+)
+
+// reconcileDatabases reconciles the databases of the service and reports
+// whether they are all ready. Dedicated databases are releases of the
+// service, shared ones are created on the shared servers of the application.
+// A service without databases is always ready.
+func (r *AppServiceReconciler) reconcileDatabases(ctx context.Context, log logr.Logger, appService *cloudshipv1beta1.AppService,
+	app *cloudshipv1beta1.Application, status *cloudshipv1beta1.AppServiceStatus) (bool, error) {
+	if len(appService.Spec.Databases) == 0 {
+		status.Databases = nil
+		meta.RemoveStatusCondition(&status.Conditions, cloudshipv1beta1.ConditionDatabaseReady)
+		return true, nil
+	}
+
+	var statuses []cloudshipv1beta1.DatabaseStatus
+	var notReady []string
+	for i := range appService.Spec.Databases {
+		database := &appService.Spec.Databases[i]
+		if database.Isolation == cloudshipv1beta1.DatabaseIsolationShared {
+			details, err := r.reconcileSharedDatabase(ctx, log, appService, app, database, status)
+			if err != nil {
+				types.SetCondition(&status.Conditions, appService, cloudshipv1beta1.ConditionDatabaseReady, metav1.ConditionFalse,
+					cloudshipv1beta1.ReasonReconcileError, err.Error())
+				return false, err
+			}
+			// the database keeps its last details while the server is down
+			if details == nil {
+				notReady = append(notReady, release.SharedDatabaseReleaseName(string(database.Type)))
+				if previous := databaseStatus(status.Databases, database.Name); previous != nil {
+					statuses = append(statuses, *previous)
+				}
+				continue
+			}
+			statuses = append(statuses, r.newDatabaseStatus(appService, status, database, details))
+			continue
+		}
+
+		manager, err := r.databaseManager(ctx, log, appService, database)
+		if err != nil {
+			types.SetCondition(&status.Conditions, appService, cloudshipv1beta1.ConditionDatabaseReady, metav1.ConditionFalse,
+				cloudshipv1beta1.ReasonReconcileError, err.Error())
+			return false, err
+		}
+		recordRelease(&status.Releases, manager.ReleaseName(), cloudshipv1beta1.BackingServiceCategoryDatabase, string(database.Type))
+		ready, err := reconcileRelease(ctx, log, r.EventRecorder, manager, appService, &status.Conditions, cloudshipv1beta1.ConditionDatabaseReady)
+		if err != nil {
+			return false, err
+		}
+		if !ready {
+			notReady = append(notReady, manager.ReleaseName())
+		}
+
+		details, err := manager.ConnectionDetails()
+		if err != nil {
+			log.Error(err, "Failed to get database connection details")
+			return false, err
+		}
+		statuses = append(statuses, r.newDatabaseStatus(appService, status, database, details))
+	}
+	status.Databases = statuses
+
+	// the condition holds the outcome of the last release, unless another
+	// one is not ready
+	if len(notReady) > 0 {
+		types.SetCondition(&status.Conditions, appService, cloudshipv1beta1.ConditionDatabaseReady, metav1.ConditionFalse,
+			cloudshipv1beta1.ReasonWorkloadsNotReady, fmt.Sprintf("Releases %s are not ready", strings.Join(notReady, ", ")))
+		return false, nil
+	}
+	return true, nil
+}
+
+// newDatabaseStatus returns the status of a database of the service,
+// recording an event when its connection details changed.
+func (r *AppServiceReconciler) newDatabaseStatus(appService *cloudshipv1beta1.AppService, status *cloudshipv1beta1.AppServiceStatus,
+	database *cloudshipv1beta1.DatabaseSpec, details *cloudshipv1beta1.ConnectionDetails) cloudshipv1beta1.DatabaseStatus {
+	if previous := databaseStatus(status.Databases, database.Name); previous != nil {
+		recordConnectionChange(r.EventRecorder, appService, fmt.Sprintf("database %s", database.Name), &previous.ConnectionDetails, details)
+	}
+	return cloudshipv1beta1.DatabaseStatus{
+		Name:              database.Name,
+		Type:              database.Type,
+		ConnectionDetails: *details,
+	}
+}
+
+// databaseStatus returns the status of the database named name, or nil if
+// there is none.
+func databaseStatus(statuses []cloudshipv1beta1.DatabaseStatus, name string) *cloudshipv1beta1.DatabaseStatus {
+	for i := range statuses {
+		if statuses[i].Name == name {
+			return &statuses[i]
+		}
+	}
+	return nil
+}
+
+// databaseWanted reports whether the service still uses the dedicated
+// database of a release recorded in its status.
+func databaseWanted(appService *cloudshipv1beta1.AppService, rel cloudshipv1beta1.ReleaseStatus) bool {
+	for i := range appService.Spec.Databases {
+		database := &appService.Spec.Databases[i]
+		if database.Isolation == cloudshipv1beta1.DatabaseIsolationShared {
+			continue
+		}
+		if release.ServiceDatabaseReleaseName(appService.GetName(), database) == rel.Name && string(database.Type) == rel.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// databaseManager returns the release manager of a dedicated database of the
+// service.
+func (r *AppServiceReconciler) databaseManager(ctx context.Context, log logr.Logger,
+	appService *cloudshipv1beta1.AppService, database *cloudshipv1beta1.DatabaseSpec) (release.Manager, error) {
+	var overrideValues map[string]string
+
+	dbManagerFactory, err := r.Catalog.ManagerFactory(ctx, cloudshipv1beta1.BackingServiceCategoryDatabase, string(database.Type))
+	if err != nil {
+		return nil, err
+	}
+	log.Info(fmt.Sprintf("Reconcile %s database %s for service %s", database.Type, database.Name, appService.GetName()))
+
+	values, err := release.ResolveValues(ctx, r.Client, appService.GetNamespace(), database.HelmValues)
+	if err != nil {
+		log.Error(err, "Failed to resolve database values")
+		return nil, err
+	}
+	releaseName := release.ServiceDatabaseReleaseName(appService.GetName(), database)
+	manager, err := dbManagerFactory.ForRelease(releaseName).NewManager(ctx, appService, appService.GetNamespace(), values, overrideValues)
+	if err != nil {
+		log.Error(err, "Failed to get release manager")
+		return nil, err
+	}
+	return manager, nil
+}
+
+// releaseManager returns the release manager of a release recorded in the
+// status of the service.
+func (r *AppServiceReconciler) releaseManager(ctx context.Context, log logr.Logger,
+	appService *cloudshipv1beta1.AppService, rel cloudshipv1beta1.ReleaseStatus) (release.Manager, error) {
+	factory, err := r.Catalog.ManagerFactory(ctx, rel.Category, rel.Type)
+	if err != nil {
+		return nil, err
+	}
+	manager, err := factory.ForRelease(rel.Name).NewManager(ctx, appService, appService.GetNamespace(), nil, nil)
+	if err != nil {
+		log.Error(err, "Failed to get release manager")
+		return nil, err
+	}
+	return manager, nil
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+// Reasons of the events recorded on cloudship resources
+const (
+	eventNamespaceCreated         = "NamespaceCreated"
+	eventApplyNamespaceFailed     = "ApplyNamespaceFailed"
+	eventReleaseInstalled         = "ReleaseInstalled"
+	eventReleaseUpgraded          = "ReleaseUpgraded"
+	eventReleaseUninstalled       = "ReleaseUninstalled"
+	eventReleaseRetained          = "ReleaseRetained"
+	eventInstallFailed            = "InstallFailed"
+	eventUpgradeFailed            = "UpgradeFailed"
+	eventUninstallFailed          = "UninstallFailed"
+	eventReconcileFailed          = "ReconcileFailed"
+	eventRenderWorkloadFailed     = "RenderWorkloadFailed"
+	eventApplyWorkloadFailed      = "ApplyWorkloadFailed"
+	eventRenderServiceFailed      = "RenderServiceFailed"
+	eventApplyServiceFailed       = "ApplyServiceFailed"
+	eventExposeFailed             = "ExposeFailed"
+	eventApplyAutoscalerFailed    = "ApplyAutoscalerFailed"
+	eventApplyVolumeClaimFailed   = "ApplyVolumeClaimFailed"
+	eventConnectionDetailsChanged = "ConnectionDetailsChanged"
+	eventSharedDatabaseCreated    = "SharedDatabaseCreated"
+	eventSharedDatabaseDropped    = "SharedDatabaseDropped"
+	eventSharedDatabaseRetained   = "SharedDatabaseRetained"
+	eventSharedDatabaseFailed     = "SharedDatabaseFailed"
+)
+
+// Messages of the warning events recorded on cloudship resources
+const (
+	errApplyNamespace   = "cannot apply namespace %s: %v"
+	errRenderWorkload   = "cannot render workload: %v"
+	errApplyWorkload    = "cannot apply workload %s: %v"
+	errRenderService    = "cannot render service: %v"
+	errApplyService     = "cannot apply service %s: %v"
+	errExpose           = "cannot expose service: %v"
+	errApplyAutoscaler  = "cannot apply horizontal pod autoscaler: %v"
+	errApplyVolumeClaim = "cannot apply persistent volume claim: %v"
+)
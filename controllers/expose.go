@@ -0,0 +1,269 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+)
+
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update;patch;delete
+
+var (
+	ingressKind       = reflect.TypeOf(networkingv1.Ingress{}).Name()
+	ingressAPIVersion = networkingv1.SchemeGroupVersion.String()
+
+	// httpRouteGroupKind is the Gateway API route exposing services when the
+	// Gateway API is installed
+	httpRouteGroupKind = schema.GroupKind{Group: "gateway.networking.k8s.io", Kind: "HTTPRoute"}
+)
+
+const (
+	defaultExposePath = "/"
+
+	certManagerIssuerAnnotation        = "cert-manager.io/issuer"
+	certManagerClusterIssuerAnnotation = "cert-manager.io/cluster-issuer"
+)
+
+// httpRouteGVK returns the version of HTTPRoute served by the cluster, or
+// false when the Gateway API is not installed.
+func httpRouteGVK(mapper meta.RESTMapper) (schema.GroupVersionKind, bool) {
+	mapping, err := mapper.RESTMapping(httpRouteGroupKind)
+	if err != nil {
+		return schema.GroupVersionKind{}, false
+	}
+	return mapping.GroupVersionKind, true
+}
+
+// reconcileExpose applies the Ingress or HTTPRoute exposing the service and
+// returns its public URL. The objects of an exposure that is no longer
+// wanted are deleted.
+func (r *AppServiceReconciler) reconcileExpose(ctx context.Context, appService *cloudshipv1beta1.AppService,
+	service *corev1.Service, opts ...client.PatchOption) (string, error) {
+	expose := appService.Spec.Expose
+	routeGVK, gatewayAPI := httpRouteGVK(r.RESTMapper())
+	useRoute := expose != nil && expose.Gateway != nil && gatewayAPI
+
+	if expose == nil || useRoute {
+		if err := r.deleteOwned(ctx, appService, &networkingv1.Ingress{}); err != nil {
+			return "", err
+		}
+	}
+	if gatewayAPI && !useRoute {
+		route := &unstructured.Unstructured{}
+		route.SetGroupVersionKind(routeGVK)
+		if err := r.deleteOwned(ctx, appService, route); err != nil {
+			return "", err
+		}
+	}
+	if expose == nil {
+		return "", nil
+	}
+
+	port, err := exposedPort(expose, service)
+	if err != nil {
+		return "", err
+	}
+	var obj client.Object
+	if useRoute {
+		obj = renderHTTPRoute(appService, routeGVK, service.GetName(), port)
+	} else {
+		obj = renderIngress(appService, service.GetName(), port)
+	}
+	if err := ctrl.SetControllerReference(appService, obj, r.Scheme); err != nil {
+		return "", err
+	}
+	if err := r.Patch(ctx, obj, client.Apply, opts...); err != nil {
+		return "", err
+	}
+	return exposeURL(expose), nil
+}
+
+// deleteOwned deletes the object named after the service when the service
+// controls it.
+func (r *AppServiceReconciler) deleteOwned(ctx context.Context, appService *cloudshipv1beta1.AppService, obj client.Object) error {
+	err := r.Get(ctx, client.ObjectKey{Namespace: appService.GetNamespace(), Name: appService.GetName()}, obj)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(obj, appService) {
+		return nil
+	}
+	// Jobs orphan their pods unless asked otherwise
+	return client.IgnoreNotFound(r.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground)))
+}
+
+// exposedPort returns the port of the Service traffic is routed to.
+func exposedPort(expose *cloudshipv1beta1.Expose, service *corev1.Service) (int32, error) {
+	if len(service.Spec.Ports) == 0 {
+		return 0, fmt.Errorf("service %s has no port to expose", service.GetName())
+	}
+	if expose.Port == 0 {
+		return service.Spec.Ports[0].Port, nil
+	}
+	for _, p := range service.Spec.Ports {
+		if p.Port == expose.Port {
+			return p.Port, nil
+		}
+	}
+	return 0, fmt.Errorf("service %s has no port %d to expose", service.GetName(), expose.Port)
+}
+
+func exposePaths(expose *cloudshipv1beta1.Expose) []string {
+	if len(expose.Paths) == 0 {
+		return []string{defaultExposePath}
+	}
+	return expose.Paths
+}
+
+// exposeURL returns the public URL of the service, on its first host and
+// path.
+func exposeURL(expose *cloudshipv1beta1.Expose) string {
+	u := url.URL{
+		Scheme: "http",
+		Host:   expose.Hosts[0],
+		Path:   exposePaths(expose)[0],
+	}
+	if expose.TLS != nil {
+		u.Scheme = "https"
+	}
+	return u.String()
+}
+
+// renderIngress renders the Ingress exposing the Service of the service.
+func renderIngress(appService *cloudshipv1beta1.AppService, serviceName string, port int32) *networkingv1.Ingress {
+	expose := appService.Spec.Expose
+	pathType := networkingv1.PathTypePrefix
+	var paths []networkingv1.HTTPIngressPath
+	for _, path := range exposePaths(expose) {
+		paths = append(paths, networkingv1.HTTPIngressPath{
+			Path:     path,
+			PathType: &pathType,
+			Backend: networkingv1.IngressBackend{
+				Service: &networkingv1.IngressServiceBackend{
+					Name: serviceName,
+					Port: networkingv1.ServiceBackendPort{Number: port},
+				},
+			},
+		})
+	}
+
+	ingress := &networkingv1.Ingress{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       ingressKind,
+			APIVersion: ingressAPIVersion,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      appService.GetName(),
+			Namespace: appService.GetNamespace(),
+			Labels: map[string]string{
+				labelKey: string(appService.GetUID()),
+			},
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: expose.IngressClassName,
+		},
+	}
+	for _, host := range expose.Hosts {
+		ingress.Spec.Rules = append(ingress.Spec.Rules, networkingv1.IngressRule{
+			Host: host,
+			IngressRuleValue: networkingv1.IngressRuleValue{
+				HTTP: &networkingv1.HTTPIngressRuleValue{Paths: paths},
+			},
+		})
+	}
+
+	if tls := expose.TLS; tls != nil {
+		secretName := tls.SecretName
+		if tls.Issuer != "" {
+			annotation := certManagerClusterIssuerAnnotation
+			if tls.IssuerKind == cloudshipv1beta1.IssuerKindIssuer {
+				annotation = certManagerIssuerAnnotation
+			}
+			ingress.SetAnnotations(map[string]string{annotation: tls.Issuer})
+			if secretName == "" {
+				secretName = appService.GetName() + "-tls"
+			}
+		}
+		ingress.Spec.TLS = []networkingv1.IngressTLS{{
+			Hosts:      expose.Hosts,
+			SecretName: secretName,
+		}}
+	}
+	return ingress
+}
+
+// renderHTTPRoute renders the HTTPRoute attaching the Service of the service
+// to its Gateway. TLS is terminated by the listeners of the Gateway.
+func renderHTTPRoute(appService *cloudshipv1beta1.AppService, gvk schema.GroupVersionKind,
+	serviceName string, port int32) *unstructured.Unstructured {
+	expose := appService.Spec.Expose
+	parentRef := map[string]interface{}{"name": expose.Gateway.Name}
+	if expose.Gateway.Namespace != "" {
+		parentRef["namespace"] = expose.Gateway.Namespace
+	}
+	var matches []interface{}
+	for _, path := range exposePaths(expose) {
+		matches = append(matches, map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":  "PathPrefix",
+				"value": path,
+			},
+		})
+	}
+	var hostnames []interface{}
+	for _, host := range expose.Hosts {
+		hostnames = append(hostnames, host)
+	}
+
+	route := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"parentRefs": []interface{}{parentRef},
+			"hostnames":  hostnames,
+			"rules": []interface{}{
+				map[string]interface{}{
+					"matches": matches,
+					"backendRefs": []interface{}{
+						map[string]interface{}{
+							"name": serviceName,
+							"port": int64(port),
+						},
+					},
+				},
+			},
+		},
+	}}
+	route.SetGroupVersionKind(gvk)
+	route.SetName(appService.GetName())
+	route.SetNamespace(appService.GetNamespace())
+	route.SetLabels(map[string]string{labelKey: string(appService.GetUID())})
+	return route
+}
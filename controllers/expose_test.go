@@ -0,0 +1,237 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+)
+
+func TestExposedPort(t *testing.T) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web"},
+		Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+			{Name: "http", Port: 8080},
+			{Name: "metrics", Port: 9090},
+		}},
+	}
+	tests := []struct {
+		name    string
+		port    int32
+		service *corev1.Service
+		want    int32
+		err     string
+	}{
+		{name: "first port by default", service: service, want: 8080},
+		{name: "port", port: 9090, service: service, want: 9090},
+		{name: "missing port", port: 443, service: service, err: "service web has no port 443 to expose"},
+		{
+			name:    "no port",
+			service: &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web"}},
+			err:     "service web has no port to expose",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port, err := exposedPort(&cloudshipv1beta1.Expose{Port: tt.port}, tt.service)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if port != tt.want {
+				t.Errorf("expected port %d, got %d", tt.want, port)
+			}
+		})
+	}
+}
+
+func TestExposeURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		expose cloudshipv1beta1.Expose
+		want   string
+	}{
+		{name: "default path", expose: cloudshipv1beta1.Expose{Hosts: []string{"shop.example.com"}}, want: "http://shop.example.com/"},
+		{
+			name:   "first host and path",
+			expose: cloudshipv1beta1.Expose{Hosts: []string{"shop.example.com", "www.example.com"}, Paths: []string{"/api", "/web"}},
+			want:   "http://shop.example.com/api",
+		},
+		{
+			name:   "TLS",
+			expose: cloudshipv1beta1.Expose{Hosts: []string{"shop.example.com"}, TLS: &cloudshipv1beta1.ExposeTLS{}},
+			want:   "https://shop.example.com/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if u := exposeURL(&tt.expose); u != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, u)
+			}
+		})
+	}
+}
+
+// exposedAppService returns the service shop/web exposed on shop.example.com.
+func exposedAppService(expose cloudshipv1beta1.Expose) *cloudshipv1beta1.AppService {
+	expose.Hosts = []string{"shop.example.com"}
+	return &cloudshipv1beta1.AppService{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop", UID: "web-uid"},
+		Spec:       cloudshipv1beta1.AppServiceSpec{Expose: &expose},
+	}
+}
+
+func TestRenderIngress(t *testing.T) {
+	tests := []struct {
+		name        string
+		tls         *cloudshipv1beta1.ExposeTLS
+		annotations map[string]string
+		ingressTLS  []networkingv1.IngressTLS
+	}{
+		{name: "no TLS"},
+		{
+			name:       "TLS secret",
+			tls:        &cloudshipv1beta1.ExposeTLS{SecretName: "shop-cert"},
+			ingressTLS: []networkingv1.IngressTLS{{Hosts: []string{"shop.example.com"}, SecretName: "shop-cert"}},
+		},
+		{
+			name:        "cluster issuer",
+			tls:         &cloudshipv1beta1.ExposeTLS{Issuer: "letsencrypt"},
+			annotations: map[string]string{certManagerClusterIssuerAnnotation: "letsencrypt"},
+			ingressTLS:  []networkingv1.IngressTLS{{Hosts: []string{"shop.example.com"}, SecretName: "web-tls"}},
+		},
+		{
+			name:        "explicit cluster issuer",
+			tls:         &cloudshipv1beta1.ExposeTLS{Issuer: "letsencrypt", IssuerKind: cloudshipv1beta1.IssuerKindClusterIssuer},
+			annotations: map[string]string{certManagerClusterIssuerAnnotation: "letsencrypt"},
+			ingressTLS:  []networkingv1.IngressTLS{{Hosts: []string{"shop.example.com"}, SecretName: "web-tls"}},
+		},
+		{
+			name: "namespaced issuer",
+			tls: &cloudshipv1beta1.ExposeTLS{
+				Issuer:     "shop-ca",
+				IssuerKind: cloudshipv1beta1.IssuerKindIssuer,
+				SecretName: "shop-cert",
+			},
+			annotations: map[string]string{certManagerIssuerAnnotation: "shop-ca"},
+			ingressTLS:  []networkingv1.IngressTLS{{Hosts: []string{"shop.example.com"}, SecretName: "shop-cert"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			className := "nginx"
+			as := exposedAppService(cloudshipv1beta1.Expose{IngressClassName: &className, TLS: tt.tls})
+			ingress := renderIngress(as, "web", 8080)
+
+			if ingress.GetName() != "web" || ingress.GetNamespace() != "shop" || ingress.GetLabels()[labelKey] != "web-uid" {
+				t.Errorf("expected the labelled Ingress shop/web, got %v", ingress.ObjectMeta)
+			}
+			if !reflect.DeepEqual(ingress.GetAnnotations(), tt.annotations) {
+				t.Errorf("expected annotations %v, got %v", tt.annotations, ingress.GetAnnotations())
+			}
+			if !reflect.DeepEqual(ingress.Spec.TLS, tt.ingressTLS) {
+				t.Errorf("expected TLS %v, got %v", tt.ingressTLS, ingress.Spec.TLS)
+			}
+			if *ingress.Spec.IngressClassName != "nginx" {
+				t.Errorf("expected the class nginx, got %s", *ingress.Spec.IngressClassName)
+			}
+			pathType := networkingv1.PathTypePrefix
+			rules := []networkingv1.IngressRule{{
+				Host: "shop.example.com",
+				IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: []networkingv1.HTTPIngressPath{{
+						Path:     "/",
+						PathType: &pathType,
+						Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+							Name: "web",
+							Port: networkingv1.ServiceBackendPort{Number: 8080},
+						}},
+					}},
+				}},
+			}}
+			if !reflect.DeepEqual(ingress.Spec.Rules, rules) {
+				t.Errorf("expected rules %v, got %v", rules, ingress.Spec.Rules)
+			}
+		})
+	}
+}
+
+func TestRenderHTTPRoute(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1beta1", Kind: "HTTPRoute"}
+	tests := []struct {
+		name      string
+		gateway   cloudshipv1beta1.GatewayReference
+		parentRef map[string]interface{}
+	}{
+		{
+			name:      "gateway of the namespace",
+			gateway:   cloudshipv1beta1.GatewayReference{Name: "public"},
+			parentRef: map[string]interface{}{"name": "public"},
+		},
+		{
+			name:      "gateway of another namespace",
+			gateway:   cloudshipv1beta1.GatewayReference{Name: "public", Namespace: "gateways"},
+			parentRef: map[string]interface{}{"name": "public", "namespace": "gateways"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway := tt.gateway
+			as := exposedAppService(cloudshipv1beta1.Expose{Gateway: &gateway, Paths: []string{"/api"}})
+			route := renderHTTPRoute(as, gvk, "web", 8080)
+
+			if route.GroupVersionKind() != gvk || route.GetName() != "web" || route.GetNamespace() != "shop" ||
+				route.GetLabels()[labelKey] != "web-uid" {
+				t.Errorf("expected the labelled HTTPRoute shop/web, got %v", route.Object)
+			}
+			parentRefs, _, err := unstructured.NestedSlice(route.Object, "spec", "parentRefs")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(parentRefs, []interface{}{tt.parentRef}) {
+				t.Errorf("expected the parent %v, got %v", tt.parentRef, parentRefs)
+			}
+			hostnames, _, _ := unstructured.NestedStringSlice(route.Object, "spec", "hostnames")
+			if !reflect.DeepEqual(hostnames, []string{"shop.example.com"}) {
+				t.Errorf("expected the hostname shop.example.com, got %v", hostnames)
+			}
+			rules, _, _ := unstructured.NestedSlice(route.Object, "spec", "rules")
+			rule := []interface{}{map[string]interface{}{
+				"matches": []interface{}{map[string]interface{}{
+					"path": map[string]interface{}{"type": "PathPrefix", "value": "/api"},
+				}},
+				"backendRefs": []interface{}{map[string]interface{}{"name": "web", "port": int64(8080)}},
+			}}
+			if !reflect.DeepEqual(rules, rule) {
+				t.Errorf("expected the rules %v, got %v", rule, rules)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/ToucanSoftware/cloudship-operator/pkg/helm/release"
+	"github.com/ToucanSoftware/cloudship-operator/pkg/types"
+)
+
+var (
+	// uninstallWaitResult requeues a resource while its releases are uninstalled
+	uninstallWaitResult = reconcile.Result{RequeueAfter: 5 * time.Second}
+)
+
+// uninstallRelease uninstalls the release of the manager and reports whether
+// the release and all of its resources are gone. The outcome is recorded as
+// events of obj.
+func uninstallRelease(ctx context.Context, log logr.Logger, recorder record.EventRecorder, manager release.Manager, obj types.Object) (bool, error) {
+	if _, err := manager.UninstallRelease(ctx); err != nil {
+		if errors.Is(err, driver.ErrReleaseNotFound) {
+			return true, nil
+		}
+		log.Error(err, "Failed to uninstall release")
+		recorder.Eventf(obj, corev1.EventTypeWarning, eventUninstallFailed, "Release %s: %v", manager.ReleaseName(), err)
+		return false, err
+	}
+
+	uninstalled, err := manager.IsUninstalled(ctx)
+	if err != nil {
+		log.Error(err, "Failed to check uninstalled release")
+		return false, err
+	}
+	if !uninstalled {
+		log.Info(fmt.Sprintf("Waiting for the resources of release %s to be deleted", manager.ReleaseName()))
+		return false, nil
+	}
+	recorder.Eventf(obj, corev1.EventTypeNormal, eventReleaseUninstalled, "Uninstalled release %s", manager.ReleaseName())
+	return true, nil
+}
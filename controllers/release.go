@@ -0,0 +1,176 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+	"github.com/ToucanSoftware/cloudship-operator/pkg/helm/release"
+	"github.com/ToucanSoftware/cloudship-operator/pkg/types"
+)
+
+// +kubebuilder:rbac:groups=apps,resources=statefulsets;daemonsets,verbs=get;list;watch
+
+// reconcileRelease installs, upgrades or reconciles the release of the
+// manager and reports whether its workloads are ready. The outcome is set in
+// conditions as the conditionType of the backing service, along with the
+// Irreconcilable and ReleaseFailed conditions of obj, and recorded as events
+// of obj.
+func reconcileRelease(ctx context.Context, log logr.Logger, recorder record.EventRecorder, manager release.Manager,
+	obj types.Object, conditions *[]metav1.Condition, conditionType string) (bool, error) {
+	setFailure := func(failureType, reason, eventReason string, err error) {
+		types.SetCondition(conditions, obj, failureType, metav1.ConditionTrue, reason, err.Error())
+		types.SetCondition(conditions, obj, conditionType, metav1.ConditionFalse, reason, err.Error())
+		recorder.Eventf(obj, corev1.EventTypeWarning, eventReason, "Release %s: %v", manager.ReleaseName(), err)
+	}
+
+	if err := manager.Sync(ctx); err != nil {
+		log.Error(err, "Failed to sync release")
+		setFailure(cloudshipv1beta1.ConditionIrreconcilable, cloudshipv1beta1.ReasonReconcileError, eventReconcileFailed, err)
+		return false, err
+	}
+
+	var reason string
+	switch {
+	case !manager.IsInstalled():
+		log.Info(fmt.Sprintf("Installing release %s for %s", manager.ReleaseName(), obj.GetName()))
+		manager.PreInstalacion()
+		rel, err := manager.InstallRelease(ctx)
+		if err != nil {
+			log.Error(err, "Release failed")
+			setFailure(cloudshipv1beta1.ConditionReleaseFailed, cloudshipv1beta1.ReasonInstallError, eventInstallFailed, err)
+			return false, err
+		}
+		log.Info(fmt.Sprintf("Release %s for %s installed", rel.Name, obj.GetName()))
+		recorder.Eventf(obj, corev1.EventTypeNormal, eventReleaseInstalled, "Installed release %s revision %d",
+			rel.Name, rel.Version)
+		reason = cloudshipv1beta1.ReasonInstallSuccessful
+	case manager.IsUpgradeRequired():
+		log.Info(fmt.Sprintf("Upgrading release %s for %s", manager.ReleaseName(), obj.GetName()))
+		previousRel, rel, err := manager.UpgradeRelease(ctx)
+		if err != nil {
+			log.Error(err, "Release upgrade failed")
+			setFailure(cloudshipv1beta1.ConditionReleaseFailed, cloudshipv1beta1.ReasonUpgradeError, eventUpgradeFailed, err)
+			return false, err
+		}
+		log.Info(fmt.Sprintf("Release %s for %s upgraded from revision %d to %d",
+			rel.Name, obj.GetName(), previousRel.Version, rel.Version))
+		recorder.Eventf(obj, corev1.EventTypeNormal, eventReleaseUpgraded, "Upgraded release %s from revision %d to %d",
+			rel.Name, previousRel.Version, rel.Version)
+		reason = cloudshipv1beta1.ReasonUpgradeSuccessful
+	default:
+		if _, err := manager.ReconcileRelease(ctx); err != nil {
+			log.Error(err, "Failed to reconcile release")
+			setFailure(cloudshipv1beta1.ConditionIrreconcilable, cloudshipv1beta1.ReasonReconcileError, eventReconcileFailed, err)
+			return false, err
+		}
+		reason = cloudshipv1beta1.ReasonReconcileSuccessful
+	}
+	types.SetCondition(conditions, obj, cloudshipv1beta1.ConditionIrreconcilable, metav1.ConditionFalse, reason, "")
+	types.SetCondition(conditions, obj, cloudshipv1beta1.ConditionReleaseFailed, metav1.ConditionFalse, reason, "")
+
+	ready, message, err := manager.IsReady(ctx)
+	if err != nil {
+		log.Error(err, "Failed to check release readiness")
+		types.SetCondition(conditions, obj, conditionType, metav1.ConditionFalse, cloudshipv1beta1.ReasonReconcileError, err.Error())
+		return false, err
+	}
+	if !ready {
+		types.SetCondition(conditions, obj, conditionType, metav1.ConditionFalse, cloudshipv1beta1.ReasonWorkloadsNotReady, message)
+		return false, nil
+	}
+	types.SetCondition(conditions, obj, conditionType, metav1.ConditionTrue, reason,
+		fmt.Sprintf("Release %s is ready", manager.ReleaseName()))
+	return true, nil
+}
+
+// recordConnectionChange records an event on obj when the connection details
+// of one of its backing services change.
+func recordConnectionChange(recorder record.EventRecorder, obj types.Object, backingService string,
+	previous, current *cloudshipv1beta1.ConnectionDetails) {
+	if previous == nil || current == nil || equality.Semantic.DeepEqual(previous, current) {
+		return
+	}
+	recorder.Eventf(obj, corev1.EventTypeNormal, eventConnectionDetailsChanged,
+		"Connection details of the %s changed to %s", backingService, net.JoinHostPort(current.Hostname, current.Port))
+}
+
+// recordRelease records the release installed for a backing service in
+// releases, replacing any record with the same name.
+func recordRelease(releases *[]cloudshipv1beta1.ReleaseStatus, name string,
+	category cloudshipv1beta1.BackingServiceCategory, serviceType string) {
+	record := cloudshipv1beta1.ReleaseStatus{Name: name, Category: category, Type: serviceType}
+	for i := range *releases {
+		if (*releases)[i].Name == name {
+			(*releases)[i] = record
+			return
+		}
+	}
+	*releases = append(*releases, record)
+}
+
+// uninstallReplacedReleases uninstalls the releases recorded in releases for
+// backing services obj no longer wants, and drops them from releases once
+// they are gone. With keep set the releases are retained instead. It reports
+// whether every replaced release is gone.
+func uninstallReplacedReleases(ctx context.Context, log logr.Logger, recorder record.EventRecorder, obj types.Object,
+	releases *[]cloudshipv1beta1.ReleaseStatus, keep bool, wanted func(cloudshipv1beta1.ReleaseStatus) bool,
+	newManager func(cloudshipv1beta1.ReleaseStatus) (release.Manager, error)) (bool, error) {
+	uninstalled := true
+	var remaining []cloudshipv1beta1.ReleaseStatus
+	for _, rel := range *releases {
+		if wanted(rel) {
+			remaining = append(remaining, rel)
+			continue
+		}
+		if keep {
+			if !rel.Retained {
+				log.Info(fmt.Sprintf("Keeping replaced release %s for %s", rel.Name, obj.GetName()))
+				recorder.Eventf(obj, corev1.EventTypeNormal, eventReleaseRetained,
+					"Kept replaced release %s of %s %s", rel.Name, rel.Category, rel.Type)
+			}
+			rel.Retained = true
+			remaining = append(remaining, rel)
+			continue
+		}
+
+		log.Info(fmt.Sprintf("Uninstalling replaced release %s for %s", rel.Name, obj.GetName()))
+		manager, err := newManager(rel)
+		if err != nil {
+			return false, err
+		}
+		gone, err := uninstallRelease(ctx, log, recorder, manager, obj)
+		if err != nil {
+			return false, err
+		}
+		if !gone {
+			uninstalled = false
+			remaining = append(remaining, rel)
+		}
+	}
+	*releases = remaining
+	return uninstalled, nil
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	rpb "helm.sh/helm/v3/pkg/release"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+	"github.com/ToucanSoftware/cloudship-operator/pkg/helm/release"
+)
+
+// fakeManager is a release manager whose releases are uninstalled at once.
+// Only the methods used to uninstall releases are implemented.
+type fakeManager struct {
+	release.Manager
+	name        string
+	uninstalled map[string]bool
+}
+
+func (m fakeManager) ReleaseName() string {
+	return m.name
+}
+
+func (m fakeManager) UninstallRelease(context.Context, ...release.UninstallOption) (*rpb.Release, error) {
+	m.uninstalled[m.name] = true
+	return &rpb.Release{Name: m.name}, nil
+}
+
+func (m fakeManager) IsUninstalled(context.Context) (bool, error) {
+	return m.uninstalled[m.name], nil
+}
+
+// replaceCacheType changes the type of the cache main of an application from
+// Memcached to Redis while its Memcached release is still recorded, and
+// returns the application along with the name of both releases.
+func replaceCacheType() (*cloudshipv1beta1.Application, string, string) {
+	app := &cloudshipv1beta1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: "shop"},
+		Spec: cloudshipv1beta1.ApplicationSpec{
+			Caches: []cloudshipv1beta1.CacheSpec{{Name: "main", Type: cloudshipv1beta1.CacheTypeMemcached}},
+		},
+	}
+	category := cloudshipv1beta1.BackingServiceCategoryCache
+	old := release.InstanceReleaseName(category, "main", string(cloudshipv1beta1.CacheTypeMemcached))
+	recordRelease(&app.Status.Releases, old, category, string(cloudshipv1beta1.CacheTypeMemcached))
+
+	app.Spec.Caches[0].Type = cloudshipv1beta1.CacheTypeRedis
+	replacement := release.InstanceReleaseName(category, "main", string(cloudshipv1beta1.CacheTypeRedis))
+	recordRelease(&app.Status.Releases, replacement, category, string(cloudshipv1beta1.CacheTypeRedis))
+	return app, old, replacement
+}
+
+func TestReplaceCacheType(t *testing.T) {
+	app, old, replacement := replaceCacheType()
+	if old == replacement {
+		t.Fatalf("expected the caches of both types to have releases of their own, got %s", old)
+	}
+	if len(app.Status.Releases) != 2 {
+		t.Fatalf("expected both releases to be recorded, got %v", app.Status.Releases)
+	}
+
+	uninstalled := map[string]bool{}
+	gone, err := uninstallReplacedReleases(context.Background(), ctrl.Log, record.NewFakeRecorder(10), app, &app.Status.Releases, false,
+		func(rel cloudshipv1beta1.ReleaseStatus) bool { return releaseWanted(app, nil, rel) },
+		func(rel cloudshipv1beta1.ReleaseStatus) (release.Manager, error) {
+			return fakeManager{name: rel.Name, uninstalled: uninstalled}, nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gone {
+		t.Fatal("expected the replaced release to be gone")
+	}
+	if !uninstalled[old] || uninstalled[replacement] {
+		t.Fatalf("expected only %s to be uninstalled, got %v", old, uninstalled)
+	}
+	if len(app.Status.Releases) != 1 || app.Status.Releases[0].Name != replacement {
+		t.Fatalf("expected only %s to be recorded, got %v", replacement, app.Status.Releases)
+	}
+}
+
+func TestReplaceCacheTypeKept(t *testing.T) {
+	app, old, _ := replaceCacheType()
+
+	uninstalled := map[string]bool{}
+	gone, err := uninstallReplacedReleases(context.Background(), ctrl.Log, record.NewFakeRecorder(10), app, &app.Status.Releases, true,
+		func(rel cloudshipv1beta1.ReleaseStatus) bool { return releaseWanted(app, nil, rel) },
+		func(rel cloudshipv1beta1.ReleaseStatus) (release.Manager, error) {
+			return fakeManager{name: rel.Name, uninstalled: uninstalled}, nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gone || len(uninstalled) > 0 {
+		t.Fatalf("expected the replaced release to be kept, got %v uninstalled", uninstalled)
+	}
+	if len(app.Status.Releases) != 2 || app.Status.Releases[0].Name != old || !app.Status.Releases[0].Retained {
+		t.Fatalf("expected %s to be retained, got %v", old, app.Status.Releases)
+	}
+}
@@ -18,14 +18,26 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
-	cloudshipv1alpha1 "github.com/ToucanSoftware/cloudship-operator/api/v1alpha1"
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+	"github.com/ToucanSoftware/cloudship-operator/pkg/helm/release"
+	"github.com/ToucanSoftware/cloudship-operator/pkg/types"
+
+	k8stypes "k8s.io/apimachinery/pkg/types"
 )
 
 // AppResourceReconciler reconciles a AppResource object
@@ -34,32 +46,167 @@ type AppResourceReconciler struct {
 	Log           logr.Logger
 	Scheme        *runtime.Scheme
 	EventRecorder record.EventRecorder
+	Catalog       release.Catalog
 }
 
+const (
+	// uninstallResourceFinalizer is added to resources so their release is
+	// uninstalled before they are deleted.
+	uninstallResourceFinalizer = "cloudship.toucansoft.io/uninstall-resource"
+)
+
 // +kubebuilder:rbac:groups=cloudship.toucansoft.io,resources=resources,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=cloudship.toucansoft.io,resources=resources/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=cloudship.toucansoft.io,resources=resources/finalizers,verbs=update
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the AppResource object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
+// An AppResource is a backing service installed as a Helm release named
+// after it, whose connection details are published in its status.
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.7.0/pkg/reconcile
 func (r *AppResourceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	_ = r.Log.WithValues("appresource", req.NamespacedName)
+	log := r.Log.WithValues("appresource", req.NamespacedName)
+
+	var appResource cloudshipv1beta1.AppResource
+	if err := r.Get(ctx, req.NamespacedName, &appResource); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if appResource.GetDeletionTimestamp() != nil {
+		return r.finalizeAppResource(ctx, log, &appResource)
+	}
+	if !controllerutil.ContainsFinalizer(&appResource, uninstallResourceFinalizer) {
+		controllerutil.AddFinalizer(&appResource, uninstallResourceFinalizer)
+		if err := r.Update(ctx, &appResource); err != nil {
+			log.Error(err, "Failed to add uninstall finalizer")
+			return ctrl.Result{}, err
+		}
+	}
+
+	status := &appResource.Status
+	manager, err := r.resourceManager(ctx, log, &appResource)
+	if err != nil {
+		return ctrl.Result{}, r.failReconcile(ctx, log, &appResource, status, err)
+	}
+	status.ReleaseName = manager.ReleaseName()
+	if _, err := reconcileRelease(ctx, log, r.EventRecorder, manager, &appResource, &status.Conditions, cloudshipv1beta1.ConditionReady); err != nil {
+		if err := r.updateResourceStatus(ctx, &appResource, status); err != nil {
+			log.Error(err, "Failed to update resource status")
+		}
+		return ctrl.Result{}, err
+	}
+	details, err := manager.ConnectionDetails()
+	if err != nil {
+		log.Error(err, "Failed to get resource connection details")
+		return ctrl.Result{}, r.failReconcile(ctx, log, &appResource, status, err)
+	}
+	recordConnectionChange(r.EventRecorder, &appResource, "resource", status.Connection, details)
+	status.Connection = details
+
+	if err := r.updateResourceStatus(ctx, &appResource, status); err != nil {
+		log.Error(err, "Failed to update resource status")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// failReconcile marks the resource as not ready because of err and returns
+// err.
+func (r *AppResourceReconciler) failReconcile(ctx context.Context, log logr.Logger,
+	appResource *cloudshipv1beta1.AppResource, status *cloudshipv1beta1.AppResourceStatus, err error) error {
+	types.SetCondition(&status.Conditions, appResource, cloudshipv1beta1.ConditionReady, metav1.ConditionFalse,
+		cloudshipv1beta1.ReasonReconcileError, err.Error())
+	if err := r.updateResourceStatus(ctx, appResource, status); err != nil {
+		log.Error(err, "Failed to update resource status")
+	}
+	return err
+}
+
+// updateResourceStatus patches the status of the resource, retrying on
+// conflicts with the latest version of it.
+func (r *AppResourceReconciler) updateResourceStatus(ctx context.Context, appResource *cloudshipv1beta1.AppResource, status *cloudshipv1beta1.AppResourceStatus) error {
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		latest := &cloudshipv1beta1.AppResource{}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(appResource), latest); err != nil {
+			return err
+		}
+		patch := client.MergeFromWithOptions(latest.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		latest.Status = *status
+		return r.Status().Patch(ctx, latest, patch)
+	})
+}
 
-	// your logic here
+// resourceManager returns the release manager of the resource. The release
+// is named after the resource and its parameters are set over its values.
+func (r *AppResourceReconciler) resourceManager(ctx context.Context, log logr.Logger, appResource *cloudshipv1beta1.AppResource) (release.Manager, error) {
+	spec := appResource.Spec
+	factory, err := r.Catalog.ManagerFactory(ctx, spec.Category, spec.Type)
+	if err != nil {
+		return nil, err
+	}
+	log.Info(fmt.Sprintf("Reconcile %s %s for resource %s", spec.Category, spec.Type, appResource.GetName()))
+
+	values, err := release.ResolveValues(ctx, r.Client, appResource.GetNamespace(), spec.HelmValues)
+	if err != nil {
+		log.Error(err, "Failed to resolve resource values")
+		return nil, err
+	}
+	manager, err := factory.ForRelease(appResource.GetName()).NewManager(ctx, appResource, appResource.GetNamespace(), values, spec.Parameters)
+	if err != nil {
+		log.Error(err, "Failed to get release manager")
+		return nil, err
+	}
+	return manager, nil
+}
 
+// finalizeAppResource uninstalls the release of a deleted resource and
+// removes the finalizer once the release and its resources are gone.
+func (r *AppResourceReconciler) finalizeAppResource(ctx context.Context, log logr.Logger, appResource *cloudshipv1beta1.AppResource) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(appResource, uninstallResourceFinalizer) {
+		log.Info("Resource is terminated, skipping reconciliation")
+		return ctrl.Result{}, nil
+	}
+
+	manager, err := r.resourceManager(ctx, log, appResource)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	uninstalled, err := uninstallRelease(ctx, log, r.EventRecorder, manager, appResource)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !uninstalled {
+		return uninstallWaitResult, nil
+	}
+
+	controllerutil.RemoveFinalizer(appResource, uninstallResourceFinalizer)
+	if err := r.Update(ctx, appResource); err != nil {
+		log.Error(err, "Failed to remove uninstall finalizer")
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	log.Info(fmt.Sprintf("Resource %s: Uninstalled", appResource.GetName()))
 	return ctrl.Result{}, nil
 }
 
-// SetupWithManager sets up the controller with the Manager.
+// SetupWithManager sets up the controller with the Manager. Resources are
+// reconciled when the workloads of their release change.
 func (r *AppResourceReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&cloudshipv1alpha1.AppResource{}).
-		Complete(r)
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&cloudshipv1beta1.AppResource{})
+	for _, workload := range releaseWorkloads() {
+		b = b.Watches(&source.Kind{Type: workload},
+			handler.EnqueueRequestsFromMapFunc(appResourceForRelease),
+			builder.WithPredicates(helmManaged))
+	}
+	return b.Complete(r)
+}
+
+// appResourceForRelease maps a workload of a release to the resource named
+// after the release.
+func appResourceForRelease(obj client.Object) []reconcile.Request {
+	return []reconcile.Request{{NamespacedName: k8stypes.NamespacedName{
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetAnnotations()[helmReleaseNameAnnotation],
+	}}}
 }
@@ -19,20 +19,28 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/go-logr/logr"
 
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
-	cloudshipv1alpha1 "github.com/ToucanSoftware/cloudship-operator/api/v1alpha1"
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
 	"github.com/ToucanSoftware/cloudship-operator/pkg/helm/release"
 	"github.com/ToucanSoftware/cloudship-operator/pkg/types"
 
@@ -42,205 +50,450 @@ import (
 // AppServiceReconciler reconciles a AppService object
 type AppServiceReconciler struct {
 	client.Client
-	Log                      logr.Logger
-	Scheme                   *runtime.Scheme
-	EventRecorder            record.EventRecorder
-	MySQLManagerFactory      release.ManagerFactory
-	PostgreSQLManagerFactory release.ManagerFactory
+	Log           logr.Logger
+	Scheme        *runtime.Scheme
+	EventRecorder record.EventRecorder
+	Catalog       release.Catalog
 }
 
-var (
-	// ReconcileWaitResult is the time to wait between reconciliation.
-	ReconcileWaitResult = reconcile.Result{RequeueAfter: 30 * time.Second}
+const (
+	// uninstallDatabaseFinalizer is added to services so their database is
+	// uninstalled before they are deleted.
+	uninstallDatabaseFinalizer = "cloudship.toucansoft.io/uninstall-database"
 )
 
-// Reconcile reconciles a AppService object
 // +kubebuilder:rbac:groups=cloudship.toucansoft.io,resources=services,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=cloudship.toucansoft.io,resources=services/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=cloudship.toucansoft.io,resources=services/finalizers,verbs=update
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
+
+// Reconcile reconciles a AppService object
 func (r *AppServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("appservice", req.NamespacedName)
 	log.Info("Reconcile container workload")
 
-	var appService cloudshipv1alpha1.AppService
+	var appService cloudshipv1beta1.AppService
 	if err := r.Get(ctx, req.NamespacedName, &appService); err != nil {
 		if apierrors.IsNotFound(err) {
 			log.Info("Container workload is deleted")
 		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
-	var app cloudshipv1alpha1.Application
+
+	if appService.GetDeletionTimestamp() != nil {
+		return r.finalizeAppService(ctx, log, &appService)
+	}
+	if !controllerutil.ContainsFinalizer(&appService, uninstallDatabaseFinalizer) {
+		controllerutil.AddFinalizer(&appService, uninstallDatabaseFinalizer)
+		if err := r.Update(ctx, &appService); err != nil {
+			log.Error(err, "Failed to add uninstall finalizer")
+			return ctrl.Result{}, err
+		}
+	}
+
+	var app cloudshipv1beta1.Application
 	if err := r.Get(ctx, k8stypes.NamespacedName{Name: appService.GetNamespace()}, &app); err != nil {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
 	var envVars []corev1.EnvVar = []corev1.EnvVar{}
 
-	if app.Spec.CacheRef != nil {
-		var cacheEnvVars = translateCacheEnvVars(app.Status.Cache)
-		envVars = append(envVars, cacheEnvVars...)
+	// the first cache and event stream are the default ones, set without
+	// their name too
+	for i := range app.Status.Caches {
+		cache := &app.Status.Caches[i]
+		if i == 0 {
+			envVars = append(envVars, translateCacheEnvVars("CACHE", cache)...)
+		}
+		envVars = append(envVars, translateCacheEnvVars(instanceEnvPrefix("CACHE", cache.Name), cache)...)
 	}
-
-	if appService.Spec.DatabaseRef != nil {
-		var overrideValues map[string]string
-		var dbManagerFactory release.ManagerFactory
-
-		switch appService.Spec.DatabaseRef.Type {
-		case cloudshipv1alpha1.DatabaseTypeMySQL:
-			log.Info(fmt.Sprintf("Reconcile MySQL for service %s", appService.GetName()))
-			dbManagerFactory = r.MySQLManagerFactory
-		case cloudshipv1alpha1.DatabaseTypePostgreSQL:
-			log.Info(fmt.Sprintf("Reconcile PosgreSQL for application %s", appService.GetName()))
-			dbManagerFactory = r.PostgreSQLManagerFactory
-		default:
-			return ReconcileWaitResult, fmt.Errorf("No Manager Factory for %v", appService.Spec.DatabaseRef.Type)
+	for i := range app.Status.EventStreams {
+		eventStream := &app.Status.EventStreams[i]
+		if i == 0 {
+			envVars = append(envVars, translateEventStreamEnvVars("EVENT_STREAM", eventStream)...)
 		}
+		envVars = append(envVars, translateEventStreamEnvVars(instanceEnvPrefix("EVENT_STREAM", eventStream.Name), eventStream)...)
+	}
 
-		manager, err := dbManagerFactory.NewManager(req.Namespace, overrideValues)
-		if err != nil {
-			log.Error(err, "Failed to get release manager")
-			return ReconcileWaitResult, err
-		}
-
-		if err := manager.Sync(ctx); err != nil {
-			log.Error(err, "Failed to sync release")
-			// status.SetCondition(types.HelmAppCondition{
-			// 	Type:    types.ConditionIrreconcilable,
-			// 	Status:  types.StatusTrue,
-			// 	Reason:  types.ReasonReconcileError,
-			// 	Message: err.Error(),
-			// })
-			// if err := r.updateResourceStatus(ctx, o, status); err != nil {
-			// 	log.Error(err, "Failed to update status after sync release failure")
-			// }
-			return ReconcileWaitResult, err
-		}
-		//	status.RemoveCondition(types.ConditionIrreconcilable)
-
-		if !manager.IsInstalled() {
-			log.Info(fmt.Sprintf("Installing Database Release %s", appService.GetName()))
-
-			//TODO: acá se puede hacer lo que haya que hacer previo a la instalación.
-			manager.PreInstalacion()
-
-			rel, err := manager.InstallRelease(ctx)
-			if err != nil {
-				log.Error(err, "Release failed")
-				return ReconcileWaitResult, err
-			}
-			//status := types.StatusFor(o)
-			log.Info(fmt.Sprintf("Database with name %s for service %s installed", rel.Name, appService.GetName()))
-		}
-		// Generate Environment variable for the database
-		var databaseEnvVars = manager.EnvVars(&app)
-		envVars = append(envVars, databaseEnvVars...)
-		// Refactor all of this
-		var dbStatus *cloudshipv1alpha1.DatabaseStatus = &cloudshipv1alpha1.DatabaseStatus{
-			Name:     envVars[0].Value,
-			Hostname: manager.Hostname(&app),
-			Port:     manager.Port(),
-			Username: envVars[3].Value,
+	status := &appService.Status
+	databaseReady, err := r.reconcileDatabases(ctx, log, &appService, &app, status)
+	if err != nil {
+		return ctrl.Result{}, r.failReconcile(ctx, log, &appService, status, err)
+	}
+	for i := range status.Databases {
+		database := &status.Databases[i]
+		if i == 0 {
+			envVars = append(envVars, translateDatabaseEnvVars("DATABASE", database)...)
 		}
-		appService.Status.DatabaseStatusRef = dbStatus
+		envVars = append(envVars, translateDatabaseEnvVars(instanceEnvPrefix("DATABASE", database.Name), database)...)
 	}
 
-	deploy, err := r.renderDeployment(ctx, &appService, envVars)
-
+	workload, err := r.renderWorkload(ctx, &appService, envVars)
 	if err != nil {
-		log.Error(err, "Failed to render a deployment")
-		// r.record.Event(eventObj, event.Warning(errRenderWorkload, err))
-		return ReconcileWaitResult, client.IgnoreNotFound(err)
+		log.Error(err, "Failed to render a workload")
+		r.EventRecorder.Eventf(&appService, corev1.EventTypeWarning, eventRenderWorkloadFailed, errRenderWorkload, err)
+		return ctrl.Result{}, r.failReconcile(ctx, log, &appService, status, err)
 	}
 	// server side apply, only the fields we set are touched
 	applyOpts := []client.PatchOption{client.ForceOwnership, client.FieldOwner(appService.GetUID())}
-	if err := r.Patch(ctx, deploy, client.Apply, applyOpts...); err != nil {
-		log.Error(err, "Failed to apply to a deployment")
-		//r.record.Event(eventObj, event.Warning(errApplyDeployment, err))
-		return ReconcileWaitResult, client.IgnoreNotFound(err)
+	if err := r.reconcileVolumeClaims(ctx, &appService, applyOpts...); err != nil {
+		log.Error(err, "Failed to apply a persistent volume claim")
+		r.EventRecorder.Eventf(&appService, corev1.EventTypeWarning, eventApplyVolumeClaimFailed, errApplyVolumeClaim, err)
+		return ctrl.Result{}, r.failReconcile(ctx, log, &appService, status, err)
+	}
+	if err := r.applyWorkload(ctx, &appService, workload, applyOpts...); err != nil {
+		log.Error(err, "Failed to apply a workload")
+		r.EventRecorder.Eventf(&appService, corev1.EventTypeWarning, eventApplyWorkloadFailed, errApplyWorkload, workload.GetName(), err)
+		return ctrl.Result{}, r.failReconcile(ctx, log, &appService, status, err)
 	}
 
-	service, err := r.renderService(ctx, &appService, deploy)
+	services, err := r.renderServices(ctx, &appService, workload)
 	if err != nil {
 		log.Error(err, "Failed to render a service")
-		//r.record.Event(eventObj, event.Warning(errRenderService, err))
-		return ReconcileWaitResult, client.IgnoreNotFound(err)
+		r.EventRecorder.Eventf(&appService, corev1.EventTypeWarning, eventRenderServiceFailed, errRenderService, err)
+		return ctrl.Result{}, r.failReconcile(ctx, log, &appService, status, err)
+	}
+	// server side apply the services
+	for _, service := range services {
+		if err := r.applyService(ctx, &appService, service, applyOpts...); err != nil {
+			log.Error(err, "Failed to apply a service")
+			r.EventRecorder.Eventf(&appService, corev1.EventTypeWarning, eventApplyServiceFailed, errApplyService, service.GetName(), err)
+			return ctrl.Result{}, r.failReconcile(ctx, log, &appService, status, err)
+		}
+	}
+	// a Service without ports is deleted, this removes the headless Service
+	// left by a StatefulSet
+	if len(services) < 2 && governingServiceName(&appService) != appService.GetName() {
+		governing := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: governingServiceName(&appService), Namespace: appService.GetNamespace()}}
+		if err := r.applyService(ctx, &appService, governing); err != nil {
+			log.Error(err, "Failed to delete a service")
+			return ctrl.Result{}, r.failReconcile(ctx, log, &appService, status, err)
+		}
+	}
+
+	if err := r.reconcileAutoscaling(ctx, &appService, workload, applyOpts...); err != nil {
+		log.Error(err, "Failed to apply a horizontal pod autoscaler")
+		r.EventRecorder.Eventf(&appService, corev1.EventTypeWarning, eventApplyAutoscalerFailed, errApplyAutoscaler, err)
+		return ctrl.Result{}, r.failReconcile(ctx, log, &appService, status, err)
+	}
+
+	exposedURL, err := r.reconcileExpose(ctx, &appService, services[0], applyOpts...)
+	if err != nil {
+		log.Error(err, "Failed to expose the service")
+		r.EventRecorder.Eventf(&appService, corev1.EventTypeWarning, eventExposeFailed, errExpose, err)
+		return ctrl.Result{}, r.failReconcile(ctx, log, &appService, status, err)
+	}
+	status.URL = exposedURL
+
+	// replaced databases go once the workload moved to their replacement
+	result := ctrl.Result{}
+	if databaseReady {
+		keep := app.GetAnnotations()[cloudshipv1beta1.KeepReplacedReleasesAnnotation] == "true"
+		uninstalled, err := uninstallReplacedReleases(ctx, log, r.EventRecorder, &appService, &status.Releases, keep,
+			func(rel cloudshipv1beta1.ReleaseStatus) bool { return databaseWanted(&appService, rel) },
+			func(rel cloudshipv1beta1.ReleaseStatus) (release.Manager, error) {
+				return r.releaseManager(ctx, log, &appService, rel)
+			})
+		if err != nil {
+			return ctrl.Result{}, r.failReconcile(ctx, log, &appService, status, err)
+		}
+		dropped, err := r.dropReplacedSharedDatabases(ctx, log, &appService, &app, status, keep)
+		if err != nil {
+			return ctrl.Result{}, r.failReconcile(ctx, log, &appService, status, err)
+		}
+		if !uninstalled || !dropped {
+			result = uninstallWaitResult
+		}
+	}
+
+	workloadIsReady, workloadMessage := workloadReady(workload)
+	switch {
+	case !databaseReady:
+		types.SetCondition(&status.Conditions, &appService, cloudshipv1beta1.ConditionReady, metav1.ConditionFalse,
+			cloudshipv1beta1.ReasonNotReady, "Waiting for the databases of the service to be ready")
+	case !workloadIsReady:
+		types.SetCondition(&status.Conditions, &appService, cloudshipv1beta1.ConditionReady, metav1.ConditionFalse,
+			cloudshipv1beta1.ReasonWorkloadsNotReady, workloadMessage)
+	default:
+		types.SetCondition(&status.Conditions, &appService, cloudshipv1beta1.ConditionReady, metav1.ConditionTrue,
+			cloudshipv1beta1.ReasonReady, "The service is available")
+	}
+	if err := r.updateResourceStatus(ctx, &appService, status); err != nil {
+		log.Error(err, "Failed to update service status")
+		return ctrl.Result{}, err
+	}
+	return result, nil
+}
+
+// failReconcile marks the service as not ready because of err and returns
+// err.
+func (r *AppServiceReconciler) failReconcile(ctx context.Context, log logr.Logger,
+	appService *cloudshipv1beta1.AppService, status *cloudshipv1beta1.AppServiceStatus, err error) error {
+	types.SetCondition(&status.Conditions, appService, cloudshipv1beta1.ConditionReady, metav1.ConditionFalse,
+		cloudshipv1beta1.ReasonReconcileError, err.Error())
+	if err := r.updateResourceStatus(ctx, appService, status); err != nil {
+		log.Error(err, "Failed to update service status")
+	}
+	return err
+}
+
+// updateResourceStatus patches the status of the service, retrying on
+// conflicts with the latest version of it.
+func (r *AppServiceReconciler) updateResourceStatus(ctx context.Context, appService *cloudshipv1beta1.AppService, status *cloudshipv1beta1.AppServiceStatus) error {
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		latest := &cloudshipv1beta1.AppService{}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(appService), latest); err != nil {
+			return err
+		}
+		patch := client.MergeFromWithOptions(latest.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		latest.Status = *status
+		return r.Status().Patch(ctx, latest, patch)
+	})
+}
+
+// finalizeAppService drops the shared databases of a deleted service and
+// uninstalls its dedicated ones, along with the replaced ones it retained,
+// and removes the finalizer once the databases, the releases and their
+// resources are gone.
+func (r *AppServiceReconciler) finalizeAppService(ctx context.Context, log logr.Logger, appService *cloudshipv1beta1.AppService) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(appService, uninstallDatabaseFinalizer) {
+		log.Info("Resource is terminated, skipping reconciliation")
+		return ctrl.Result{}, nil
+	}
+
+	// without an application there are no shared servers left
+	app := &cloudshipv1beta1.Application{}
+	if err := r.Get(ctx, k8stypes.NamespacedName{Name: appService.GetNamespace()}, app); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		app = nil
+	}
+	for _, shared := range appService.Status.SharedDatabases {
+		dropped, err := r.dropSharedDatabase(ctx, log, appService, app, shared)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !dropped {
+			return uninstallWaitResult, nil
+		}
 	}
-	// server side apply the service
-	if err := r.Patch(ctx, service, client.Apply, applyOpts...); err != nil {
-		log.Error(err, "Failed to apply a service")
-		//r.record.Event(eventObj, event.Warning(errApplyDeployment, err))
-		return ReconcileWaitResult, client.IgnoreNotFound(err)
+
+	var managers []func() (release.Manager, error)
+	for _, rel := range appService.Status.Releases {
+		if databaseWanted(appService, rel) {
+			continue
+		}
+		rel := rel
+		managers = append(managers, func() (release.Manager, error) {
+			return r.releaseManager(ctx, log, appService, rel)
+		})
+	}
+	for i := range appService.Spec.Databases {
+		database := &appService.Spec.Databases[i]
+		if database.Isolation == cloudshipv1beta1.DatabaseIsolationShared {
+			continue
+		}
+		managers = append(managers, func() (release.Manager, error) {
+			return r.databaseManager(ctx, log, appService, database)
+		})
+	}
+	for _, newManager := range managers {
+		manager, err := newManager()
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		uninstalled, err := uninstallRelease(ctx, log, r.EventRecorder, manager, appService)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !uninstalled {
+			return uninstallWaitResult, nil
+		}
 	}
 
-	if err := r.Status().Update(ctx, &appService); err != nil {
-		return ReconcileWaitResult, err
+	controllerutil.RemoveFinalizer(appService, uninstallDatabaseFinalizer)
+	if err := r.Update(ctx, appService); err != nil {
+		log.Error(err, "Failed to remove uninstall finalizer")
+		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
-	return reconcile.Result{}, nil
+	log.Info(fmt.Sprintf("Service %s: Uninstalled", appService.GetName()))
+	return ctrl.Result{}, nil
 }
 
-// SetupWithManager sets up the controller with the Manager.
+// SetupWithManager sets up the controller with the Manager. Services are
+// reconciled when their workload or Service change, when a ConfigMap or
+// Secret they mount changes, when the status of their application changes
+// and when the workloads of their database change.
 func (r *AppServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&cloudshipv1alpha1.AppService{}).
-		Complete(r)
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&cloudshipv1beta1.AppService{}).
+		Owns(&appsv1.Deployment{}).
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&batchv1.Job{}).
+		Owns(newCronJob(mgr.GetRESTMapper())).
+		Owns(&corev1.Service{}).
+		Owns(&corev1.PersistentVolumeClaim{}).
+		Owns(&networkingv1.Ingress{}).
+		Watches(&source.Kind{Type: &cloudshipv1beta1.Application{}},
+			handler.EnqueueRequestsFromMapFunc(r.appServicesForApplication),
+			builder.WithPredicates(applicationStatusChanged)).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}},
+			handler.EnqueueRequestsFromMapFunc(r.appServicesForConfigMap)).
+		Watches(&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.appServicesForSecret))
+	if hpaServed(mgr.GetRESTMapper()) {
+		b = b.Owns(newHPA())
+	}
+	if gvk, ok := httpRouteGVK(mgr.GetRESTMapper()); ok {
+		route := &unstructured.Unstructured{}
+		route.SetGroupVersionKind(gvk)
+		b = b.Owns(route)
+	}
+	for _, workload := range releaseWorkloads() {
+		b = b.Watches(&source.Kind{Type: workload},
+			handler.EnqueueRequestsFromMapFunc(r.appServicesForDatabase),
+			builder.WithPredicates(helmManaged))
+	}
+	return b.Complete(r)
+}
+
+// appServicesForApplication maps an application to the services in its
+// namespace.
+func (r *AppServiceReconciler) appServicesForApplication(obj client.Object) []reconcile.Request {
+	return r.appServicesIn(obj.GetName(), func(*cloudshipv1beta1.AppService) bool { return true })
 }
 
-// create a corresponding deployment
-func (r *AppServiceReconciler) renderDeployment(ctx context.Context,
-	appService *cloudshipv1alpha1.AppService, envVars []corev1.EnvVar) (*appsv1.Deployment, error) {
+// appServicesForDatabase maps a workload of a release to the services with a
+// database in its namespace.
+func (r *AppServiceReconciler) appServicesForDatabase(obj client.Object) []reconcile.Request {
+	return r.appServicesIn(obj.GetNamespace(), func(appService *cloudshipv1beta1.AppService) bool {
+		return len(appService.Spec.Databases) > 0
+	})
+}
+
+func (r *AppServiceReconciler) appServicesIn(namespace string, filter func(*cloudshipv1beta1.AppService) bool) []reconcile.Request {
+	var appServices cloudshipv1beta1.AppServiceList
+	if err := r.List(context.Background(), &appServices, client.InNamespace(namespace)); err != nil {
+		r.Log.Error(err, "Failed to list services", "namespace", namespace)
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range appServices.Items {
+		if filter(&appServices.Items[i]) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&appServices.Items[i])})
+		}
+	}
+	return requests
+}
+
+// renderWorkload renders the workload running the containers of the service
+func (r *AppServiceReconciler) renderWorkload(ctx context.Context,
+	appService *cloudshipv1beta1.AppService, envVars []corev1.EnvVar) (types.Object, error) {
 
 	resources, err := TranslateContainer(ctx, appService, envVars)
 	if err != nil {
 		return nil, err
 	}
+	if len(resources) == 0 {
+		return nil, fmt.Errorf("internal error, workload is not rendered correctly")
+	}
+	workload := resources[0]
 
-	deploy, ok := resources[0].(*appsv1.Deployment)
-	if !ok {
-		return nil, fmt.Errorf("internal error, deployment is not rendered correctly")
+	// the replica count is left to the autoscaler when there is one
+	replicas := appService.Spec.Replicas
+	if appService.Spec.Autoscaling != nil {
+		replicas = nil
 	}
-	// make sure we don't have opinion on the replica count
-	deploy.Spec.Replicas = nil
+	switch w := workload.(type) {
+	case *appsv1.Deployment:
+		w.Spec.Replicas = replicas
+	case *appsv1.StatefulSet:
+		w.Spec.Replicas = replicas
+	}
+
 	// k8s server-side patch complains if the protocol is not set
-	for i := 0; i < len(deploy.Spec.Template.Spec.Containers); i++ {
-		for j := 0; j < len(deploy.Spec.Template.Spec.Containers[i].Ports); j++ {
-			if len(deploy.Spec.Template.Spec.Containers[i].Ports[j].Protocol) == 0 {
-				deploy.Spec.Template.Spec.Containers[i].Ports[j].Protocol = corev1.ProtocolTCP
+	template := podTemplateOf(workload)
+	for i := 0; i < len(template.Spec.Containers); i++ {
+		for j := 0; j < len(template.Spec.Containers[i].Ports); j++ {
+			if len(template.Spec.Containers[i].Ports[j].Protocol) == 0 {
+				template.Spec.Containers[i].Ports[j].Protocol = corev1.ProtocolTCP
 			}
 		}
 	}
-	r.Log.Info("rendered a deployment", "deploy", deploy.Spec.Template.Spec)
+	checksum, err := r.configChecksum(ctx, appService)
+	if err != nil {
+		return nil, err
+	}
+	if checksum != "" {
+		metav1.SetMetaDataAnnotation(&template.ObjectMeta, configChecksumAnnotation, checksum)
+	}
+	r.Log.Info("rendered a workload", "kind", workload.GetObjectKind().GroupVersionKind().Kind, "template", template.Spec)
 
-	// set the controller reference so that we can watch this deployment and it will be deleted automatically
-	if err := ctrl.SetControllerReference(appService, deploy, r.Scheme); err != nil {
+	// set the controller reference so that we can watch this workload and it will be deleted automatically
+	if err := ctrl.SetControllerReference(appService, workload, r.Scheme); err != nil {
 		return nil, err
 	}
 
-	return deploy, nil
+	return workload, nil
 }
 
-// create a corresponding service
-func (r *AppServiceReconciler) renderService(ctx context.Context,
-	appService *cloudshipv1alpha1.AppService, deploy *appsv1.Deployment) (*corev1.Service, error) {
-	// create a service for the workload
-	resources, err := ServiceInjector(ctx, appService, []types.Object{deploy})
+// renderServices renders the Service of the service, followed by the
+// headless Service governing its StatefulSet when there is one
+func (r *AppServiceReconciler) renderServices(ctx context.Context,
+	appService *cloudshipv1beta1.AppService, workload types.Object) ([]*corev1.Service, error) {
+	// create the services for the workload
+	resources, err := ServiceInjector(ctx, appService, []types.Object{workload})
 	if err != nil {
 		return nil, err
 	}
-	service, ok := resources[1].(*corev1.Service)
-	if !ok {
+	if len(resources) < 2 {
 		return nil, fmt.Errorf("internal error, service is not rendered correctly")
 	}
-	// the service injector lib doesn't set the namespace and serviceType
-	service.Namespace = appService.Namespace
-	service.Spec.Type = corev1.ServiceTypeClusterIP
-	// k8s server-side patch complains if the protocol is not set
-	for i := 0; i < len(service.Spec.Ports); i++ {
-		service.Spec.Ports[i].Protocol = corev1.ProtocolTCP
+	var services []*corev1.Service
+	for _, resource := range resources[1:] {
+		service, ok := resource.(*corev1.Service)
+		if !ok {
+			return nil, fmt.Errorf("internal error, service is not rendered correctly")
+		}
+		// the service injector lib doesn't set the namespace
+		service.Namespace = appService.Namespace
+		// always set the controller reference so that we can watch this service and
+		if err := ctrl.SetControllerReference(appService, service, r.Scheme); err != nil {
+			return nil, err
+		}
+		services = append(services, service)
 	}
-	// always set the controller reference so that we can watch this service and
-	if err := ctrl.SetControllerReference(appService, service, r.Scheme); err != nil {
-		return nil, err
+	return services, nil
+}
+
+// applyService applies the Service of the service. Ports removed from the
+// containers are dropped from the Service by server side apply, and the
+// Service itself is deleted once no port is left. Switching to or from a
+// headless Service recreates it, as its cluster IP cannot change.
+func (r *AppServiceReconciler) applyService(ctx context.Context, appService *cloudshipv1beta1.AppService,
+	service *corev1.Service, opts ...client.PatchOption) error {
+	var existing corev1.Service
+	err := r.Get(ctx, client.ObjectKeyFromObject(service), &existing)
+	if client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	owned := err == nil && metav1.IsControlledBy(&existing, appService)
+	headless := service.Spec.ClusterIP == corev1.ClusterIPNone
+
+	if len(service.Spec.Ports) == 0 && !headless {
+		if owned {
+			return client.IgnoreNotFound(r.Delete(ctx, &existing))
+		}
+		return nil
+	}
+	if owned && (existing.Spec.ClusterIP == corev1.ClusterIPNone) != headless {
+		if err := r.Delete(ctx, &existing); client.IgnoreNotFound(err) != nil {
+			return err
+		}
 	}
-	return service, nil
+	return r.Patch(ctx, service, client.Apply, opts...)
 }
@@ -0,0 +1,300 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+	sqldb "github.com/ToucanSoftware/cloudship-operator/pkg/database"
+	"github.com/ToucanSoftware/cloudship-operator/pkg/helm/release"
+	"github.com/ToucanSoftware/cloudship-operator/pkg/types"
+)
+
+const (
+	// sharedDatabasePasswordKey is the key of the Secret with the password of
+	// the user of a shared database
+	sharedDatabasePasswordKey = "password"
+)
+
+// sharedDatabaseSecretName returns the name of the Secret with the password
+// of the user of the shared database of a type named database of a service.
+func sharedDatabaseSecretName(service, database string, databaseType cloudshipv1beta1.DatabaseType) string {
+	return release.DatabaseReleaseName(service, database, string(databaseType)) + "-shared-credentials"
+}
+
+// reconcileSharedDatabase creates a shared database of the service, and the
+// user owning it, on the server of its type shared by the application. It
+// returns the connection details of the database, or nil while the server is
+// not ready.
+func (r *AppServiceReconciler) reconcileSharedDatabase(ctx context.Context, log logr.Logger, appService *cloudshipv1beta1.AppService,
+	app *cloudshipv1beta1.Application, database *cloudshipv1beta1.DatabaseSpec, status *cloudshipv1beta1.AppServiceStatus) (*cloudshipv1beta1.ConnectionDetails, error) {
+	server := databaseServerStatus(app.Status.DatabaseServers, database.Type)
+	if server == nil {
+		log.Info(fmt.Sprintf("Waiting for the shared %s server of application %s", database.Type, app.GetName()))
+		return nil, nil
+	}
+	log.Info(fmt.Sprintf("Reconcile shared %s database %s for service %s", database.Type, database.Name, appService.GetName()))
+
+	passwordRef, password, err := r.sharedDatabaseCredentials(ctx, appService, database)
+	if err != nil {
+		log.Error(err, "Failed to get shared database credentials")
+		return nil, err
+	}
+
+	// the database is recorded first, so it is dropped even if it was only
+	// partly created
+	name := sqldb.Name(appService.GetName(), database.Name)
+	serverRelease := release.SharedDatabaseReleaseName(string(database.Type))
+	created := sharedDatabaseStatus(status.SharedDatabases, database.Name, database.Type) == nil
+	recordSharedDatabase(&status.SharedDatabases, cloudshipv1beta1.SharedDatabaseStatus{
+		Name:     database.Name,
+		Type:     database.Type,
+		Database: name,
+		Username: name,
+	})
+	err = r.withDatabaseServer(ctx, appService.GetNamespace(), server, func(s sqldb.Server) error {
+		return s.EnsureDatabase(ctx, name, name, password)
+	})
+	if err != nil {
+		log.Error(err, "Failed to create shared database")
+		r.EventRecorder.Eventf(appService, corev1.EventTypeWarning, eventSharedDatabaseFailed, "Database %s on release %s: %v", name, serverRelease, err)
+		return nil, err
+	}
+	if created {
+		r.EventRecorder.Eventf(appService, corev1.EventTypeNormal, eventSharedDatabaseCreated, "Created database %s on release %s", name, serverRelease)
+	}
+	types.SetCondition(&status.Conditions, appService, cloudshipv1beta1.ConditionDatabaseReady, metav1.ConditionTrue,
+		cloudshipv1beta1.ReasonReconcileSuccessful, fmt.Sprintf("Database %s on release %s is ready", name, serverRelease))
+
+	details := &cloudshipv1beta1.ConnectionDetails{
+		Hostname:          server.Hostname,
+		Port:              server.Port,
+		Username:          name,
+		Database:          name,
+		PasswordSecretRef: passwordRef,
+		TLS:               server.TLS,
+	}
+	if server.URL != "" {
+		if u, err := url.Parse(server.URL); err == nil {
+			u.User = url.User(details.Username)
+			u.Path = "/" + details.Database
+			details.URL = u.String()
+		}
+	}
+	return details, nil
+}
+
+// sharedDatabaseCredentials returns the reference to the password of the user
+// of a shared database of the service, and the password. It is generated the
+// first time in a Secret owned by the service.
+func (r *AppServiceReconciler) sharedDatabaseCredentials(ctx context.Context, appService *cloudshipv1beta1.AppService,
+	database *cloudshipv1beta1.DatabaseSpec) (*corev1.SecretKeySelector, string, error) {
+	ref := &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: sharedDatabaseSecretName(appService.GetName(), database.Name, database.Type)},
+		Key:                  sharedDatabasePasswordKey,
+	}
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, k8stypes.NamespacedName{Namespace: appService.GetNamespace(), Name: ref.Name}, secret)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, "", fmt.Errorf("failed to get credentials secret: %w", err)
+	}
+	exists := err == nil
+	if password := secret.Data[ref.Key]; len(password) > 0 {
+		return ref, string(password), nil
+	}
+
+	password, err := release.NewPassword()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate password: %w", err)
+	}
+	if !exists {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      ref.Name,
+				Namespace: appService.GetNamespace(),
+			},
+			Type: corev1.SecretTypeOpaque,
+		}
+		if err := controllerutil.SetControllerReference(appService, secret, r.Scheme); err != nil {
+			return nil, "", fmt.Errorf("failed to set owner of credentials secret: %w", err)
+		}
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[ref.Key] = []byte(password)
+	if !exists {
+		if err := r.Create(ctx, secret); err != nil {
+			return nil, "", fmt.Errorf("failed to create credentials secret: %w", err)
+		}
+		return ref, password, nil
+	}
+	if err := r.Update(ctx, secret); err != nil {
+		return nil, "", fmt.Errorf("failed to update credentials secret: %w", err)
+	}
+	return ref, password, nil
+}
+
+// withDatabaseServer connects to a shared database server as its
+// administrator and runs fn with the connection.
+func (r *AppServiceReconciler) withDatabaseServer(ctx context.Context, namespace string,
+	server *cloudshipv1beta1.DatabaseServerStatus, fn func(sqldb.Server) error) error {
+	if server.PasswordSecretRef == nil {
+		return fmt.Errorf("shared %s server has no administrator password", server.Type)
+	}
+	var secret corev1.Secret
+	if err := r.Get(ctx, k8stypes.NamespacedName{Namespace: namespace, Name: server.PasswordSecretRef.Name}, &secret); err != nil {
+		return fmt.Errorf("failed to get the administrator password of the shared %s server: %w", server.Type, err)
+	}
+	sqlServer, err := sqldb.Open(server.Type, sqldb.Connection{
+		Hostname: server.Hostname,
+		Port:     server.Port,
+		Username: server.Username,
+		Password: string(secret.Data[server.PasswordSecretRef.Key]),
+		TLS:      server.TLS,
+	})
+	if err != nil {
+		return err
+	}
+	defer sqlServer.Close()
+	return fn(sqlServer)
+}
+
+// dropReplacedSharedDatabases drops the shared databases recorded in the
+// status of the service that it no longer uses, and forgets them once they
+// are gone. With keep set the databases are retained instead. It reports
+// whether every replaced database is gone.
+func (r *AppServiceReconciler) dropReplacedSharedDatabases(ctx context.Context, log logr.Logger, appService *cloudshipv1beta1.AppService,
+	app *cloudshipv1beta1.Application, status *cloudshipv1beta1.AppServiceStatus, keep bool) (bool, error) {
+	dropped := true
+	var remaining []cloudshipv1beta1.SharedDatabaseStatus
+	for _, shared := range status.SharedDatabases {
+		if sharedDatabaseWanted(appService, shared) {
+			remaining = append(remaining, shared)
+			continue
+		}
+		if keep {
+			if !shared.Retained {
+				log.Info(fmt.Sprintf("Keeping replaced database %s for %s", shared.Database, appService.GetName()))
+				r.EventRecorder.Eventf(appService, corev1.EventTypeNormal, eventSharedDatabaseRetained,
+					"Kept replaced database %s on release %s", shared.Database, release.SharedDatabaseReleaseName(string(shared.Type)))
+			}
+			shared.Retained = true
+			remaining = append(remaining, shared)
+			continue
+		}
+
+		gone, err := r.dropSharedDatabase(ctx, log, appService, app, shared)
+		if err != nil {
+			return false, err
+		}
+		if !gone {
+			dropped = false
+			remaining = append(remaining, shared)
+		}
+	}
+	status.SharedDatabases = remaining
+	return dropped, nil
+}
+
+// dropSharedDatabase drops a shared database of the service along with its
+// user and the Secret with its password. It reports whether the database is
+// gone, which it also is once its server is uninstalled or when there is no
+// application.
+func (r *AppServiceReconciler) dropSharedDatabase(ctx context.Context, log logr.Logger, appService *cloudshipv1beta1.AppService,
+	app *cloudshipv1beta1.Application, shared cloudshipv1beta1.SharedDatabaseStatus) (bool, error) {
+	serverRelease := release.SharedDatabaseReleaseName(string(shared.Type))
+	if app != nil {
+		server := databaseServerStatus(app.Status.DatabaseServers, shared.Type)
+		if server == nil {
+			for _, rel := range app.Status.Releases {
+				if rel.Name == serverRelease {
+					log.Info(fmt.Sprintf("Waiting for release %s to drop database %s", serverRelease, shared.Database))
+					return false, nil
+				}
+			}
+		} else {
+			log.Info(fmt.Sprintf("Dropping database %s for %s", shared.Database, appService.GetName()))
+			err := r.withDatabaseServer(ctx, appService.GetNamespace(), server, func(s sqldb.Server) error {
+				return s.DropDatabase(ctx, shared.Database, shared.Username)
+			})
+			if err != nil {
+				log.Error(err, "Failed to drop shared database")
+				r.EventRecorder.Eventf(appService, corev1.EventTypeWarning, eventSharedDatabaseFailed,
+					"Database %s on release %s: %v", shared.Database, serverRelease, err)
+				return false, err
+			}
+			r.EventRecorder.Eventf(appService, corev1.EventTypeNormal, eventSharedDatabaseDropped,
+				"Dropped database %s on release %s", shared.Database, serverRelease)
+		}
+	}
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Name:      sharedDatabaseSecretName(appService.GetName(), shared.Name, shared.Type),
+		Namespace: appService.GetNamespace(),
+	}}
+	if err := r.Delete(ctx, secret); client.IgnoreNotFound(err) != nil {
+		log.Error(err, "Failed to delete shared database credentials")
+		return false, err
+	}
+	return true, nil
+}
+
+// sharedDatabaseStatus returns the shared database of a type named name
+// recorded in the status of a service, or nil if there is none.
+func sharedDatabaseStatus(statuses []cloudshipv1beta1.SharedDatabaseStatus, name string,
+	databaseType cloudshipv1beta1.DatabaseType) *cloudshipv1beta1.SharedDatabaseStatus {
+	for i := range statuses {
+		if statuses[i].Name == name && statuses[i].Type == databaseType {
+			return &statuses[i]
+		}
+	}
+	return nil
+}
+
+// recordSharedDatabase records a shared database in statuses, replacing any
+// record with the same name and type. A database replaced by one of another
+// type keeps its record until it is dropped.
+func recordSharedDatabase(statuses *[]cloudshipv1beta1.SharedDatabaseStatus, record cloudshipv1beta1.SharedDatabaseStatus) {
+	if previous := sharedDatabaseStatus(*statuses, record.Name, record.Type); previous != nil {
+		*previous = record
+		return
+	}
+	*statuses = append(*statuses, record)
+}
+
+// sharedDatabaseWanted reports whether the service still uses a shared
+// database recorded in its status.
+func sharedDatabaseWanted(appService *cloudshipv1beta1.AppService, shared cloudshipv1beta1.SharedDatabaseStatus) bool {
+	for _, database := range appService.Spec.Databases {
+		if database.Isolation == cloudshipv1beta1.DatabaseIsolationShared && database.Name == shared.Name && database.Type == shared.Type {
+			return true
+		}
+	}
+	return false
+}
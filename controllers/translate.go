@@ -18,14 +18,18 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 	"reflect"
+	"strings"
 
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
-	cloudshipv1alpha1 "github.com/ToucanSoftware/cloudship-operator/api/v1alpha1"
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
 	"github.com/ToucanSoftware/cloudship-operator/pkg/types"
 )
 
@@ -36,6 +40,16 @@ var (
 	serviceAPIVersion    = corev1.SchemeGroupVersion.String()
 	namespaceKind        = reflect.TypeOf(corev1.Namespace{}).Name()
 	namespaceAPIVersion  = corev1.SchemeGroupVersion.String()
+
+	statefulSetKind       = reflect.TypeOf(appsv1.StatefulSet{}).Name()
+	statefulSetAPIVersion = appsv1.SchemeGroupVersion.String()
+	jobKind               = reflect.TypeOf(batchv1.Job{}).Name()
+	jobAPIVersion         = batchv1.SchemeGroupVersion.String()
+	cronJobKind           = reflect.TypeOf(batchv1beta1.CronJob{}).Name()
+	cronJobAPIVersion     = batchv1beta1.SchemeGroupVersion.String()
+
+	persistentVolumeClaimKind       = reflect.TypeOf(corev1.PersistentVolumeClaim{}).Name()
+	persistentVolumeClaimAPIVersion = corev1.SchemeGroupVersion.String()
 )
 
 // Reconcile error strings.
@@ -45,228 +59,331 @@ const (
 	errNotContainerizedWorkload = "object is not a containerized workload"
 )
 
-//TranslateContainer transalate to kubernetes objects
-func TranslateContainer(ctx context.Context, as *cloudshipv1alpha1.AppService, envVars []corev1.EnvVar) ([]types.Object, error) {
-
-	d := &appsv1.Deployment{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       deploymentKind,
-			APIVersion: deploymentAPIVersion,
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      as.GetName(),
-			Namespace: as.GetNamespace(),
+//TranslateContainer transalate to kubernetes objects. The containers run as
+// the workload kind of the service, a Deployment unless set otherwise.
+func TranslateContainer(ctx context.Context, as *cloudshipv1beta1.AppService, envVars []corev1.EnvVar) ([]types.Object, error) {
+	objectMeta := metav1.ObjectMeta{
+		Name:      as.GetName(),
+		Namespace: as.GetNamespace(),
+	}
+	selector := &metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			labelKey: string(as.GetUID()),
 		},
-		Spec: appsv1.DeploymentSpec{
-			Selector: &metav1.LabelSelector{
-				MatchLabels: map[string]string{
-					labelKey: string(as.GetUID()),
-				},
+	}
+	template, err := translatePodTemplate(as, envVars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch as.Spec.WorkloadType {
+	case "", cloudshipv1beta1.WorkloadTypeDeployment:
+		return []types.Object{&appsv1.Deployment{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       deploymentKind,
+				APIVersion: deploymentAPIVersion,
 			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{
-						labelKey: string(as.GetUID()),
+			ObjectMeta: objectMeta,
+			Spec: appsv1.DeploymentSpec{
+				Selector: selector,
+				Template: template,
+			},
+		}}, nil
+	case cloudshipv1beta1.WorkloadTypeStatefulSet:
+		claims := translateVolumeClaimTemplates(as.Spec.VolumeClaimTemplates)
+		for i := range template.Spec.Containers {
+			for _, claim := range as.Spec.VolumeClaimTemplates {
+				template.Spec.Containers[i].VolumeMounts = append(template.Spec.Containers[i].VolumeMounts, corev1.VolumeMount{
+					Name:      claim.Name,
+					MountPath: claim.MountPath,
+				})
+			}
+		}
+		return []types.Object{&appsv1.StatefulSet{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       statefulSetKind,
+				APIVersion: statefulSetAPIVersion,
+			},
+			ObjectMeta: objectMeta,
+			Spec: appsv1.StatefulSetSpec{
+				ServiceName:          governingServiceName(as),
+				Selector:             selector,
+				Template:             template,
+				VolumeClaimTemplates: claims,
+			},
+		}}, nil
+	case cloudshipv1beta1.WorkloadTypeJob:
+		template.Spec.RestartPolicy = corev1.RestartPolicyOnFailure
+		return []types.Object{&batchv1.Job{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       jobKind,
+				APIVersion: jobAPIVersion,
+			},
+			ObjectMeta: objectMeta,
+			Spec: batchv1.JobSpec{
+				Template: template,
+			},
+		}}, nil
+	case cloudshipv1beta1.WorkloadTypeCronJob:
+		if as.Spec.Schedule == "" {
+			return nil, fmt.Errorf("a schedule is required to run a %s", as.Spec.WorkloadType)
+		}
+		template.Spec.RestartPolicy = corev1.RestartPolicyOnFailure
+		return []types.Object{&batchv1beta1.CronJob{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       cronJobKind,
+				APIVersion: cronJobAPIVersion,
+			},
+			ObjectMeta: objectMeta,
+			Spec: batchv1beta1.CronJobSpec{
+				Schedule: as.Spec.Schedule,
+				JobTemplate: batchv1beta1.JobTemplateSpec{
+					Spec: batchv1.JobSpec{
+						Template: template,
 					},
 				},
 			},
+		}}, nil
+	}
+	return nil, fmt.Errorf("unsupported workload type %q", as.Spec.WorkloadType)
+}
+
+// translatePodTemplate returns the pod template running the containers of
+// the service, shared by every workload kind.
+func translatePodTemplate(as *cloudshipv1beta1.AppService, envVars []corev1.EnvVar) (corev1.PodTemplateSpec, error) {
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{
+				labelKey: string(as.GetUID()),
+			},
+		},
+		Spec: corev1.PodSpec{
+			Volumes: translateVolumes(as),
 		},
 	}
 
-	for _, container := range as.Spec.Containers {
-		/*
-			if container.ImagePullSecret != nil {
-				d.Spec.Template.Spec.ImagePullSecrets = append(d.Spec.Template.Spec.ImagePullSecrets, corev1.LocalObjectReference{
-					Name: *container.ImagePullSecret,
-				})
-			}*/
-		kubernetesContainer := corev1.Container{
-			Name:  container.Name,
-			Image: container.Image,
-			//Command: container.Command,
-			//Args:    container.Arguments,
+	// the claim templates of a StatefulSet can be mounted like volumes
+	volumes := map[string]bool{}
+	for _, v := range as.Spec.Volumes {
+		volumes[v.Name] = true
+	}
+	if as.Spec.WorkloadType == cloudshipv1beta1.WorkloadTypeStatefulSet {
+		for _, t := range as.Spec.VolumeClaimTemplates {
+			volumes[t.Name] = true
 		}
+	}
 
-		if as.Status.DatabaseStatusRef != nil {
-			kubernetesContainer.Env = append(kubernetesContainer.Env, envVars...)
+	for _, container := range as.Spec.Containers {
+		if container.ImagePullSecret != nil {
+			template.Spec.ImagePullSecrets = append(template.Spec.ImagePullSecrets, corev1.LocalObjectReference{
+				Name: *container.ImagePullSecret,
+			})
+		}
+		kubernetesContainer := corev1.Container{
+			Name:    container.Name,
+			Image:   container.Image,
+			Command: container.Command,
+			Args:    container.Arguments,
 		}
 
-		/*
-			if container.Resources != nil {
-				kubernetesContainer.Resources = corev1.ResourceRequirements{
-					Requests: corev1.ResourceList{
-						corev1.ResourceCPU:    container.Resources.CPU.Required,
-						corev1.ResourceMemory: container.Resources.Memory.Required,
-					},
-				}
-				for _, v := range container.Resources.Volumes {
-					mount := corev1.VolumeMount{
-						Name:      v.Name,
-						MountPath: v.MountPath,
-					}
-					if v.AccessMode != nil && *v.AccessMode == v1alpha2.VolumeAccessModeRO {
-						mount.ReadOnly = true
-					}
-					kubernetesContainer.VolumeMounts = append(kubernetesContainer.VolumeMounts, mount)
+		// the variables of the container override the ones of the backing
+		// services with the same name
+		kubernetesContainer.Env = mergeEnvVars(envVars, translateContainerEnvVars(container.Environment))
 
-				}
-			}*/
+		if container.Resources != nil {
+			kubernetesContainer.Resources = translateResources(container.Resources)
+		}
 
 		for _, p := range container.Ports {
 			port := corev1.ContainerPort{
 				Name:          p.Name,
 				ContainerPort: p.Port,
+				Protocol:      corev1.ProtocolTCP,
+			}
+			if p.Protocol != nil {
+				port.Protocol = corev1.Protocol(*p.Protocol)
 			}
-			// if p.Protocol != nil {
-			// 	port.Protocol = corev1.Protocol(*p.Protocol)
-			// }
 			kubernetesContainer.Ports = append(kubernetesContainer.Ports, port)
 		}
-		/*
-			for _, e := range container.Environment {
-				if e.Value != nil {
-					kubernetesContainer.Env = append(kubernetesContainer.Env, corev1.EnvVar{
-						Name:  e.Name,
-						Value: *e.Value,
-					})
-					continue
-				}
-				if e.FromSecret != nil {
-					kubernetesContainer.Env = append(kubernetesContainer.Env, corev1.EnvVar{
-						Name: e.Name,
-						ValueFrom: &corev1.EnvVarSource{
-							SecretKeyRef: &corev1.SecretKeySelector{
-								Key: e.FromSecret.Key,
-								LocalObjectReference: corev1.LocalObjectReference{
-									Name: e.FromSecret.Name,
-								},
-							},
-						},
-					})
-				}
-			}*/
-		/*
-			if container.LivenessProbe != nil {
-				kubernetesContainer.LivenessProbe = &corev1.Probe{}
-				if container.LivenessProbe.InitialDelaySeconds != nil {
-					kubernetesContainer.LivenessProbe.InitialDelaySeconds = *container.LivenessProbe.InitialDelaySeconds
-				}
-				if container.LivenessProbe.TimeoutSeconds != nil {
-					kubernetesContainer.LivenessProbe.TimeoutSeconds = *container.LivenessProbe.TimeoutSeconds
-				}
-				if container.LivenessProbe.PeriodSeconds != nil {
-					kubernetesContainer.LivenessProbe.PeriodSeconds = *container.LivenessProbe.PeriodSeconds
-				}
-				if container.LivenessProbe.SuccessThreshold != nil {
-					kubernetesContainer.LivenessProbe.SuccessThreshold = *container.LivenessProbe.SuccessThreshold
-				}
-				if container.LivenessProbe.FailureThreshold != nil {
-					kubernetesContainer.LivenessProbe.FailureThreshold = *container.LivenessProbe.FailureThreshold
-				}
 
-				// NOTE(hasheddan): Kubernetes specifies that only one type of
-				// handler should be provided. OAM does not impose that same
-				// restriction. We optimistically check all and set whatever is
-				// provided.
-				if container.LivenessProbe.HTTPGet != nil {
-					kubernetesContainer.LivenessProbe.Handler.HTTPGet = &corev1.HTTPGetAction{
-						Path: container.LivenessProbe.HTTPGet.Path,
-						Port: intstr.IntOrString{IntVal: container.LivenessProbe.HTTPGet.Port},
-					}
-
-					for _, h := range container.LivenessProbe.HTTPGet.HTTPHeaders {
-						kubernetesContainer.LivenessProbe.Handler.HTTPGet.HTTPHeaders = append(kubernetesContainer.LivenessProbe.Handler.HTTPGet.HTTPHeaders, corev1.HTTPHeader{
-							Name:  h.Name,
-							Value: h.Value,
-						})
-					}
-				}
-				if container.LivenessProbe.Exec != nil {
-					kubernetesContainer.LivenessProbe.Exec = &corev1.ExecAction{
-						Command: container.LivenessProbe.Exec.Command,
-					}
-				}
-				if container.LivenessProbe.TCPSocket != nil {
-					kubernetesContainer.LivenessProbe.TCPSocket = &corev1.TCPSocketAction{
-						Port: intstr.IntOrString{IntVal: container.LivenessProbe.TCPSocket.Port},
-					}
-				}
-			}*/
-		/*
-			if container.ReadinessProbe != nil {
-				kubernetesContainer.ReadinessProbe = &corev1.Probe{}
-				if container.ReadinessProbe.InitialDelaySeconds != nil {
-					kubernetesContainer.ReadinessProbe.InitialDelaySeconds = *container.ReadinessProbe.InitialDelaySeconds
-				}
-				if container.ReadinessProbe.TimeoutSeconds != nil {
-					kubernetesContainer.ReadinessProbe.TimeoutSeconds = *container.ReadinessProbe.TimeoutSeconds
-				}
-				if container.ReadinessProbe.PeriodSeconds != nil {
-					kubernetesContainer.ReadinessProbe.PeriodSeconds = *container.ReadinessProbe.PeriodSeconds
-				}
-				if container.ReadinessProbe.SuccessThreshold != nil {
-					kubernetesContainer.ReadinessProbe.SuccessThreshold = *container.ReadinessProbe.SuccessThreshold
-				}
-				if container.ReadinessProbe.FailureThreshold != nil {
-					kubernetesContainer.ReadinessProbe.FailureThreshold = *container.ReadinessProbe.FailureThreshold
-				}
+		for _, m := range container.VolumeMounts {
+			if !volumes[m.Name] {
+				return template, fmt.Errorf("container %s mounts unknown volume %s", container.Name, m.Name)
+			}
+			kubernetesContainer.VolumeMounts = append(kubernetesContainer.VolumeMounts, corev1.VolumeMount{
+				Name:      m.Name,
+				MountPath: m.MountPath,
+				SubPath:   m.SubPath,
+				ReadOnly:  m.ReadOnly,
+			})
+		}
 
-				// NOTE(hasheddan): Kubernetes specifies that only one type of
-				// handler should be provided. OAM does not impose that same
-				// restriction. We optimistically check all and set whatever is
-				// provided.
-				if container.ReadinessProbe.HTTPGet != nil {
-					kubernetesContainer.ReadinessProbe.Handler.HTTPGet = &corev1.HTTPGetAction{
-						Path: container.ReadinessProbe.HTTPGet.Path,
-						Port: intstr.IntOrString{IntVal: container.ReadinessProbe.HTTPGet.Port},
-					}
-
-					for _, h := range container.ReadinessProbe.HTTPGet.HTTPHeaders {
-						kubernetesContainer.ReadinessProbe.Handler.HTTPGet.HTTPHeaders = append(kubernetesContainer.ReadinessProbe.Handler.HTTPGet.HTTPHeaders, corev1.HTTPHeader{
-							Name:  h.Name,
-							Value: h.Value,
-						})
-					}
-				}
-				if container.ReadinessProbe.Exec != nil {
-					kubernetesContainer.ReadinessProbe.Exec = &corev1.ExecAction{
-						Command: container.ReadinessProbe.Exec.Command,
-					}
-				}
-				if container.ReadinessProbe.TCPSocket != nil {
-					kubernetesContainer.ReadinessProbe.TCPSocket = &corev1.TCPSocketAction{
-						Port: intstr.IntOrString{IntVal: container.ReadinessProbe.TCPSocket.Port},
-					}
+		kubernetesContainer.LivenessProbe = translateProbe(container.LivenessProbe)
+		kubernetesContainer.ReadinessProbe = translateProbe(container.ReadinessProbe)
+
+		template.Spec.Containers = append(template.Spec.Containers, kubernetesContainer)
+	}
+	return template, nil
+}
+
+// translateVolumes returns the volumes of the pods of the service.
+func translateVolumes(as *cloudshipv1beta1.AppService) []corev1.Volume {
+	var volumes []corev1.Volume
+	for _, v := range as.Spec.Volumes {
+		volume := corev1.Volume{Name: v.Name}
+		switch {
+		case v.PersistentVolumeClaim != nil:
+			volume.PersistentVolumeClaim = &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: volumeClaimName(as, v.Name),
+			}
+		case v.ConfigMap != nil:
+			volume.ConfigMap = &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: v.ConfigMap.Name},
+				Items:                translateKeyToPaths(v.ConfigMap.Items),
+				DefaultMode:          v.ConfigMap.DefaultMode,
+			}
+		case v.Secret != nil:
+			volume.Secret = &corev1.SecretVolumeSource{
+				SecretName:  v.Secret.Name,
+				Items:       translateKeyToPaths(v.Secret.Items),
+				DefaultMode: v.Secret.DefaultMode,
+			}
+		default:
+			volume.EmptyDir = &corev1.EmptyDirVolumeSource{}
+			if v.EmptyDir != nil {
+				if v.EmptyDir.InMemory {
+					volume.EmptyDir.Medium = corev1.StorageMediumMemory
 				}
-			}*/
+				volume.EmptyDir.SizeLimit = v.EmptyDir.SizeLimit
+			}
+		}
+		volumes = append(volumes, volume)
+	}
+	return volumes
+}
 
-		d.Spec.Template.Spec.Containers = append(d.Spec.Template.Spec.Containers, kubernetesContainer)
+func translateKeyToPaths(items []cloudshipv1beta1.KeyToPath) []corev1.KeyToPath {
+	var paths []corev1.KeyToPath
+	for _, item := range items {
+		paths = append(paths, corev1.KeyToPath{Key: item.Key, Path: item.Path})
 	}
+	return paths
+}
 
-	// pass through label and annotation from the workload to the deployment
-	//util.PassLabelAndAnnotation(w, d)
-	// pass through label from the workload to the pod template
-	//util.PassLabel(w, &d.Spec.Template)
+// volumeClaimName returns the name of the PersistentVolumeClaim created for a
+// volume of the service.
+func volumeClaimName(as *cloudshipv1beta1.AppService, volume string) string {
+	return as.GetName() + "-" + volume
+}
 
-	return []types.Object{d}, nil
+// translateVolumeClaims returns the PersistentVolumeClaims of the volumes of
+// the service.
+func translateVolumeClaims(as *cloudshipv1beta1.AppService) []*corev1.PersistentVolumeClaim {
+	var claims []*corev1.PersistentVolumeClaim
+	for _, v := range as.Spec.Volumes {
+		if v.PersistentVolumeClaim == nil {
+			continue
+		}
+		accessModes := v.PersistentVolumeClaim.AccessModes
+		if len(accessModes) == 0 {
+			accessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+		}
+		claims = append(claims, &corev1.PersistentVolumeClaim{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       persistentVolumeClaimKind,
+				APIVersion: persistentVolumeClaimAPIVersion,
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      volumeClaimName(as, v.Name),
+				Namespace: as.GetNamespace(),
+				Labels: map[string]string{
+					labelKey: string(as.GetUID()),
+				},
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes:      accessModes,
+				StorageClassName: v.PersistentVolumeClaim.StorageClassName,
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: v.PersistentVolumeClaim.Size,
+					},
+				},
+			},
+		})
+	}
+	return claims
 }
 
-// ServiceInjector adds a Service object for the first Port on the first
-// Container for the first Deployment observed in a workload translation.
-func ServiceInjector(ctx context.Context, as *cloudshipv1alpha1.AppService, objs []types.Object) ([]types.Object, error) {
+// translateVolumeClaimTemplates returns the claims of every replica of a
+// StatefulSet.
+func translateVolumeClaimTemplates(templates []cloudshipv1beta1.VolumeClaimTemplate) []corev1.PersistentVolumeClaim {
+	var claims []corev1.PersistentVolumeClaim
+	for _, t := range templates {
+		accessModes := t.AccessModes
+		if len(accessModes) == 0 {
+			accessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+		}
+		claims = append(claims, corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: t.Name,
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes:      accessModes,
+				StorageClassName: t.StorageClassName,
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: t.Size,
+					},
+				},
+			},
+		})
+	}
+	return claims
+}
+
+// governingServiceName returns the name of the headless Service giving the
+// pods of a StatefulSet their network identity. It is the Service of the
+// service itself when that one is headless.
+func governingServiceName(as *cloudshipv1beta1.AppService) string {
+	if as.Spec.ServiceType == cloudshipv1beta1.ServiceTypeHeadless {
+		return as.GetName()
+	}
+	return as.GetName() + "-headless"
+}
+
+// podTemplateOf returns the pod template of a translated workload.
+func podTemplateOf(o types.Object) *corev1.PodTemplateSpec {
+	switch w := o.(type) {
+	case *appsv1.Deployment:
+		return &w.Spec.Template
+	case *appsv1.StatefulSet:
+		return &w.Spec.Template
+	case *batchv1.Job:
+		return &w.Spec.Template
+	case *batchv1beta1.CronJob:
+		return &w.Spec.JobTemplate.Spec.Template
+	}
+	return nil
+}
+
+// ServiceInjector adds a Service object exposing every port of every
+// container of the first workload observed in a workload translation. A
+// StatefulSet also gets the headless Service governing it, unless the Service
+// of the service is headless itself.
+func ServiceInjector(ctx context.Context, as *cloudshipv1beta1.AppService, objs []types.Object) ([]types.Object, error) {
 	if objs == nil {
 		return nil, nil
 	}
 
 	for _, o := range objs {
-		d, ok := o.(*appsv1.Deployment)
-		if !ok {
+		template := podTemplateOf(o)
+		if template == nil {
 			continue
 		}
 
-		// We don't add a Service if there are no containers for the Deployment.
+		// We don't add a Service if there are no containers for the workload.
 		// This should never happen in practice.
-		if len(d.Spec.Template.Spec.Containers) < 1 {
+		if len(template.Spec.Containers) < 1 {
 			continue
 		}
 
@@ -276,47 +393,290 @@ func ServiceInjector(ctx context.Context, as *cloudshipv1alpha1.AppService, objs
 				APIVersion: serviceAPIVersion,
 			},
 			ObjectMeta: metav1.ObjectMeta{
-				Name:      d.GetName(),
-				Namespace: d.GetNamespace(),
+				Name:      o.GetName(),
+				Namespace: o.GetNamespace(),
 				Labels: map[string]string{
 					labelKey: string(as.GetUID()),
 				},
 			},
 			Spec: corev1.ServiceSpec{
-				Selector: d.Spec.Selector.MatchLabels,
+				Selector: template.GetLabels(),
 				Ports:    []corev1.ServicePort{},
-				Type:     corev1.ServiceTypeLoadBalancer,
+				Type:     corev1.ServiceTypeClusterIP,
 			},
 		}
+		switch as.Spec.ServiceType {
+		case cloudshipv1beta1.ServiceTypeNodePort:
+			s.Spec.Type = corev1.ServiceTypeNodePort
+		case cloudshipv1beta1.ServiceTypeLoadBalancer:
+			s.Spec.Type = corev1.ServiceTypeLoadBalancer
+		case cloudshipv1beta1.ServiceTypeHeadless:
+			s.Spec.ClusterIP = corev1.ClusterIPNone
+		}
 
-		// We only add a single Service for the Deployment, even if multiple
-		// ports or no ports are defined on the first container. This is to
-		// exclude the need for implementing garbage collection in the
-		// short-term in the case that ports are modified after creation.
-		if len(d.Spec.Template.Spec.Containers[0].Ports) > 0 {
-			s.Spec.Ports = []corev1.ServicePort{
-				{
-					Name:       d.GetName(),
-					Port:       d.Spec.Template.Spec.Containers[0].Ports[0].ContainerPort,
-					TargetPort: intstr.FromInt(int(d.Spec.Template.Spec.Containers[0].Ports[0].ContainerPort)),
-				},
+		for _, c := range template.Spec.Containers {
+			for _, p := range c.Ports {
+				name := p.Name
+				if name == "" {
+					name = fmt.Sprintf("%s-%d", strings.ToLower(string(p.Protocol)), p.ContainerPort)
+				}
+				s.Spec.Ports = append(s.Spec.Ports, corev1.ServicePort{
+					Name:       name,
+					Protocol:   p.Protocol,
+					Port:       p.ContainerPort,
+					TargetPort: intstr.FromInt(int(p.ContainerPort)),
+				})
 			}
 		}
 		objs = append(objs, s)
+
+		if _, ok := o.(*appsv1.StatefulSet); ok && s.Spec.ClusterIP != corev1.ClusterIPNone {
+			governing := s.DeepCopy()
+			governing.SetName(governingServiceName(as))
+			governing.Spec.Type = corev1.ServiceTypeClusterIP
+			governing.Spec.ClusterIP = corev1.ClusterIPNone
+			governing.Spec.PublishNotReadyAddresses = true
+			objs = append(objs, governing)
+		}
 		break
 	}
 	return objs, nil
 }
 
-func translateCacheEnvVars(status *cloudshipv1alpha1.CacheStatus) []corev1.EnvVar {
-	return []corev1.EnvVar{
+// translateContainerEnvVars returns the environment variables declared for a
+// container.
+func translateContainerEnvVars(env []cloudshipv1beta1.ContainerEnvVar) []corev1.EnvVar {
+	var envVars []corev1.EnvVar
+	for _, e := range env {
+		switch {
+		case e.Value != nil:
+			envVars = append(envVars, corev1.EnvVar{
+				Name:  e.Name,
+				Value: *e.Value,
+			})
+		case e.FromSecret != nil:
+			envVars = append(envVars, secretEnvVar(e.Name, &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: e.FromSecret.Name},
+				Key:                  e.FromSecret.Key,
+			}))
+		case e.FromConfigMap != nil:
+			envVars = append(envVars, corev1.EnvVar{
+				Name: e.Name,
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: e.FromConfigMap.Name},
+						Key:                  e.FromConfigMap.Key,
+					},
+				},
+			})
+		default:
+			envVars = append(envVars, corev1.EnvVar{Name: e.Name})
+		}
+	}
+	return envVars
+}
+
+// mergeEnvVars returns the variables of the backing services followed by the
+// ones of a container. A variable of the container replaces the one of the
+// backing services with the same name, in place, so variables referencing it
+// still follow it.
+func mergeEnvVars(injected, own []corev1.EnvVar) []corev1.EnvVar {
+	var merged []corev1.EnvVar
+	merged = append(merged, injected...)
+	index := map[string]int{}
+	for i, e := range merged {
+		index[e.Name] = i
+	}
+	for _, e := range own {
+		if i, ok := index[e.Name]; ok {
+			merged[i] = e
+			continue
+		}
+		index[e.Name] = len(merged)
+		merged = append(merged, e)
+	}
+	return merged
+}
+
+// translateResources returns the resource requirements of a container.
+func translateResources(resources *cloudshipv1beta1.ContainerResources) corev1.ResourceRequirements {
+	requirements := corev1.ResourceRequirements{}
+	for name, quantity := range map[corev1.ResourceName]*cloudshipv1beta1.ResourceQuantity{
+		corev1.ResourceCPU:    resources.CPU,
+		corev1.ResourceMemory: resources.Memory,
+	} {
+		if quantity == nil {
+			continue
+		}
+		if requirements.Requests == nil {
+			requirements.Requests = corev1.ResourceList{}
+		}
+		requirements.Requests[name] = quantity.Required
+		if quantity.Limit != nil {
+			if requirements.Limits == nil {
+				requirements.Limits = corev1.ResourceList{}
+			}
+			requirements.Limits[name] = *quantity.Limit
+		}
+	}
+	return requirements
+}
+
+// translateProbe returns the Kubernetes probe of a container health probe,
+// or nil when no probe is declared.
+func translateProbe(probe *cloudshipv1beta1.ContainerHealthProbe) *corev1.Probe {
+	if probe == nil {
+		return nil
+	}
+	kubernetesProbe := &corev1.Probe{}
+	if probe.InitialDelaySeconds != nil {
+		kubernetesProbe.InitialDelaySeconds = *probe.InitialDelaySeconds
+	}
+	if probe.TimeoutSeconds != nil {
+		kubernetesProbe.TimeoutSeconds = *probe.TimeoutSeconds
+	}
+	if probe.PeriodSeconds != nil {
+		kubernetesProbe.PeriodSeconds = *probe.PeriodSeconds
+	}
+	if probe.SuccessThreshold != nil {
+		kubernetesProbe.SuccessThreshold = *probe.SuccessThreshold
+	}
+	if probe.FailureThreshold != nil {
+		kubernetesProbe.FailureThreshold = *probe.FailureThreshold
+	}
+
+	// Kubernetes accepts a single handler per probe, the first one declared
+	// is used.
+	switch {
+	case probe.Exec != nil:
+		kubernetesProbe.Exec = &corev1.ExecAction{
+			Command: probe.Exec.Command,
+		}
+	case probe.HTTPGet != nil:
+		kubernetesProbe.HTTPGet = &corev1.HTTPGetAction{
+			Path: probe.HTTPGet.Path,
+			Port: intstr.FromInt(int(probe.HTTPGet.Port)),
+		}
+		for _, h := range probe.HTTPGet.HTTPHeaders {
+			kubernetesProbe.HTTPGet.HTTPHeaders = append(kubernetesProbe.HTTPGet.HTTPHeaders, corev1.HTTPHeader{
+				Name:  h.Name,
+				Value: h.Value,
+			})
+		}
+	case probe.TCPSocket != nil:
+		kubernetesProbe.TCPSocket = &corev1.TCPSocketAction{
+			Port: intstr.FromInt(int(probe.TCPSocket.Port)),
+		}
+	}
+	return kubernetesProbe
+}
+
+// instanceEnvPrefix returns the prefix of the environment variables of the
+// backing service named name, e.g. CACHE_PAGE_CACHE for the cache page-cache.
+func instanceEnvPrefix(prefix, name string) string {
+	return prefix + "_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+func translateCacheEnvVars(prefix string, status *cloudshipv1beta1.CacheStatus) []corev1.EnvVar {
+	envVars := []corev1.EnvVar{
+		{
+			Name:  prefix + "_HOSTNAME",
+			Value: status.Hostname,
+		},
+		{
+			Name:  prefix + "_PORT",
+			Value: status.Port,
+		},
+	}
+	return append(envVars, translateOptionalConnectionEnvVars(prefix, &status.ConnectionDetails)...)
+}
+
+func translateDatabaseEnvVars(prefix string, status *cloudshipv1beta1.DatabaseStatus) []corev1.EnvVar {
+	envVars := []corev1.EnvVar{
+		{
+			Name:  prefix + "_NAME",
+			Value: status.Database,
+		},
+		{
+			Name:  prefix + "_HOST",
+			Value: status.Hostname,
+		},
 		{
-			Name:  "CACHE_HOSTNAME",
+			Name:  prefix + "_PORT",
+			Value: status.Port,
+		},
+		{
+			Name:  prefix + "_USERNAME",
+			Value: status.Username,
+		},
+	}
+	return append(envVars, translateOptionalConnectionEnvVars(prefix, &status.ConnectionDetails)...)
+}
+
+func translateEventStreamEnvVars(prefix string, status *cloudshipv1beta1.EventStreamStatus) []corev1.EnvVar {
+	brokers := strings.Join(status.Brokers, ",")
+	envVars := []corev1.EnvVar{
+		{
+			Name:  prefix + "_TYPE",
+			Value: string(status.Type),
+		},
+		{
+			Name:  prefix + "_HOSTNAME",
 			Value: status.Hostname,
 		},
 		{
-			Name:  "CACHE_PORT",
+			Name:  prefix + "_PORT",
 			Value: status.Port,
 		},
+		{
+			Name:  prefix + "_BROKERS",
+			Value: brokers,
+		},
+	}
+	if status.Type == cloudshipv1beta1.EventStreamTypeKafka {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  prefix + "_BOOTSTRAP_SERVERS",
+			Value: brokers,
+		})
+	}
+	if status.Username != "" {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  prefix + "_USERNAME",
+			Value: status.Username,
+		})
+	}
+	return append(envVars, translateOptionalConnectionEnvVars(prefix, &status.ConnectionDetails)...)
+}
+
+// translateOptionalConnectionEnvVars returns the environment variables of the
+// connection details that are not set for every backing service.
+func translateOptionalConnectionEnvVars(prefix string, details *cloudshipv1beta1.ConnectionDetails) []corev1.EnvVar {
+	var envVars []corev1.EnvVar
+	if details.PasswordSecretRef != nil {
+		envVars = append(envVars, secretEnvVar(prefix+"_PASSWORD", details.PasswordSecretRef))
+	}
+	if details.URL != "" {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  prefix + "_URL",
+			Value: details.URL,
+		})
+	}
+	if details.TLS {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  prefix + "_TLS",
+			Value: "true",
+		})
+	}
+	return envVars
+}
+
+// secretEnvVar returns an environment variable read from a Secret key, so
+// credentials never show up in plain text in the workloads.
+func secretEnvVar(name string, ref *corev1.SecretKeySelector) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: ref.DeepCopy(),
+		},
 	}
 }
@@ -0,0 +1,344 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+)
+
+// testAppService returns a service of two containers, the first one with an
+// HTTP and a metrics port, the second one with a DNS port.
+func testAppService() *cloudshipv1beta1.AppService {
+	udp := cloudshipv1beta1.TransportProtocolUDP
+	return &cloudshipv1beta1.AppService{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop", UID: "web-uid"},
+		Spec: cloudshipv1beta1.AppServiceSpec{
+			Containers: []cloudshipv1beta1.Container{
+				{Name: "web", Image: "nginx:1.19", Ports: []cloudshipv1beta1.Service{
+					{Name: "http", Port: 8080},
+					{Name: "metrics", Port: 9090},
+				}},
+				{Name: "dns", Image: "coredns/coredns:1.8.0", Ports: []cloudshipv1beta1.Service{
+					{Port: 53, Protocol: &udp},
+				}},
+			},
+		},
+	}
+}
+
+func TestServiceInjector(t *testing.T) {
+	tests := []struct {
+		name         string
+		workloadType cloudshipv1beta1.WorkloadType
+		serviceType  cloudshipv1beta1.ServiceType
+		type_        corev1.ServiceType
+		clusterIP    string
+		governing    bool
+	}{
+		{name: "default", type_: corev1.ServiceTypeClusterIP},
+		{name: "node port", serviceType: cloudshipv1beta1.ServiceTypeNodePort, type_: corev1.ServiceTypeNodePort},
+		{name: "load balancer", serviceType: cloudshipv1beta1.ServiceTypeLoadBalancer, type_: corev1.ServiceTypeLoadBalancer},
+		{
+			name:        "headless",
+			serviceType: cloudshipv1beta1.ServiceTypeHeadless,
+			type_:       corev1.ServiceTypeClusterIP,
+			clusterIP:   corev1.ClusterIPNone,
+		},
+		{
+			name:         "StatefulSet",
+			workloadType: cloudshipv1beta1.WorkloadTypeStatefulSet,
+			type_:        corev1.ServiceTypeClusterIP,
+			governing:    true,
+		},
+		{
+			name:         "headless StatefulSet",
+			workloadType: cloudshipv1beta1.WorkloadTypeStatefulSet,
+			serviceType:  cloudshipv1beta1.ServiceTypeHeadless,
+			type_:        corev1.ServiceTypeClusterIP,
+			clusterIP:    corev1.ClusterIPNone,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			as := testAppService()
+			as.Spec.WorkloadType = tt.workloadType
+			as.Spec.ServiceType = tt.serviceType
+			workloads, err := TranslateContainer(context.Background(), as, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			objs, err := ServiceInjector(context.Background(), as, workloads)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := 2
+			if tt.governing {
+				expected = 3
+			}
+			if len(objs) != expected {
+				t.Fatalf("expected %d objects, got %d", expected, len(objs))
+			}
+			svc, ok := objs[1].(*corev1.Service)
+			if !ok {
+				t.Fatalf("expected a Service, got %T", objs[1])
+			}
+			if svc.GetName() != "web" || svc.Spec.Type != tt.type_ || svc.Spec.ClusterIP != tt.clusterIP {
+				t.Errorf("expected Service web of type %s with cluster IP %q, got %s of type %s with cluster IP %q",
+					tt.type_, tt.clusterIP, svc.GetName(), svc.Spec.Type, svc.Spec.ClusterIP)
+			}
+			ports := []corev1.ServicePort{
+				{Name: "http", Protocol: corev1.ProtocolTCP, Port: 8080, TargetPort: intstr.FromInt(8080)},
+				{Name: "metrics", Protocol: corev1.ProtocolTCP, Port: 9090, TargetPort: intstr.FromInt(9090)},
+				{Name: "udp-53", Protocol: corev1.ProtocolUDP, Port: 53, TargetPort: intstr.FromInt(53)},
+			}
+			if !reflect.DeepEqual(svc.Spec.Ports, ports) {
+				t.Errorf("expected ports %v, got %v", ports, svc.Spec.Ports)
+			}
+			if selector := map[string]string{labelKey: "web-uid"}; !reflect.DeepEqual(svc.Spec.Selector, selector) {
+				t.Errorf("expected selector %v, got %v", selector, svc.Spec.Selector)
+			}
+
+			if !tt.governing {
+				return
+			}
+			governing := objs[2].(*corev1.Service)
+			if governing.GetName() != "web-headless" || governing.Spec.ClusterIP != corev1.ClusterIPNone ||
+				!governing.Spec.PublishNotReadyAddresses || !reflect.DeepEqual(governing.Spec.Ports, ports) {
+				t.Errorf("expected the headless Service web-headless governing the StatefulSet, got %+v", governing)
+			}
+			if name := objs[0].(*appsv1.StatefulSet).Spec.ServiceName; name != "web-headless" {
+				t.Errorf("expected the StatefulSet to be governed by web-headless, got %s", name)
+			}
+		})
+	}
+
+	t.Run("no workload", func(t *testing.T) {
+		objs, err := ServiceInjector(context.Background(), testAppService(), nil)
+		if err != nil || objs != nil {
+			t.Fatalf("expected no objects, got %v, %v", objs, err)
+		}
+	})
+}
+
+func TestTranslateContainer(t *testing.T) {
+	tests := []struct {
+		name         string
+		workloadType cloudshipv1beta1.WorkloadType
+		schedule     string
+		kind         string
+		err          string
+	}{
+		{name: "default", kind: "Deployment"},
+		{name: "Deployment", workloadType: cloudshipv1beta1.WorkloadTypeDeployment, kind: "Deployment"},
+		{name: "StatefulSet", workloadType: cloudshipv1beta1.WorkloadTypeStatefulSet, kind: "StatefulSet"},
+		{name: "Job", workloadType: cloudshipv1beta1.WorkloadTypeJob, kind: "Job"},
+		{name: "CronJob", workloadType: cloudshipv1beta1.WorkloadTypeCronJob, schedule: "*/5 * * * *", kind: "CronJob"},
+		{name: "CronJob without schedule", workloadType: cloudshipv1beta1.WorkloadTypeCronJob, err: "a schedule is required"},
+		{name: "unsupported", workloadType: "DaemonSet", err: `unsupported workload type "DaemonSet"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			as := testAppService()
+			as.Spec.WorkloadType = tt.workloadType
+			as.Spec.Schedule = tt.schedule
+			as.Spec.VolumeClaimTemplates = []cloudshipv1beta1.VolumeClaimTemplate{
+				{Name: "data", MountPath: "/data", Size: resource.MustParse("1Gi")},
+			}
+
+			objs, err := TranslateContainer(context.Background(), as, nil)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(objs) != 1 {
+				t.Fatalf("expected a workload, got %d objects", len(objs))
+			}
+			workload := objs[0]
+			if kind := workload.GetObjectKind().GroupVersionKind().Kind; kind != tt.kind {
+				t.Fatalf("expected a %s, got a %s", tt.kind, kind)
+			}
+			if workload.GetName() != "web" || workload.GetNamespace() != "shop" {
+				t.Errorf("expected the workload shop/web, got %s/%s", workload.GetNamespace(), workload.GetName())
+			}
+			template := podTemplateOf(workload)
+			if len(template.Spec.Containers) != 2 || template.GetLabels()[labelKey] != "web-uid" {
+				t.Errorf("expected the pods to run both containers and to be labelled, got %+v", template)
+			}
+
+			switch w := workload.(type) {
+			case *appsv1.Deployment:
+				if w.Spec.Selector.MatchLabels[labelKey] != "web-uid" {
+					t.Errorf("expected the Deployment to select its pods, got %v", w.Spec.Selector)
+				}
+			case *appsv1.StatefulSet:
+				if len(w.Spec.VolumeClaimTemplates) != 1 || w.Spec.VolumeClaimTemplates[0].GetName() != "data" {
+					t.Errorf("expected the claim template data, got %v", w.Spec.VolumeClaimTemplates)
+				}
+				for _, c := range template.Spec.Containers {
+					if len(c.VolumeMounts) != 1 || c.VolumeMounts[0].MountPath != "/data" {
+						t.Errorf("expected container %s to mount data at /data, got %v", c.Name, c.VolumeMounts)
+					}
+				}
+			case *batchv1.Job:
+				if template.Spec.RestartPolicy != corev1.RestartPolicyOnFailure {
+					t.Errorf("expected the pods of the Job to restart on failure, got %s", template.Spec.RestartPolicy)
+				}
+			case *batchv1beta1.CronJob:
+				if w.Spec.Schedule != tt.schedule || template.Spec.RestartPolicy != corev1.RestartPolicyOnFailure {
+					t.Errorf("expected a CronJob scheduled %s restarting on failure, got %q, %s",
+						tt.schedule, w.Spec.Schedule, template.Spec.RestartPolicy)
+				}
+			}
+		})
+	}
+}
+
+func TestTranslateVolumes(t *testing.T) {
+	mode := int32(0400)
+	storageClass := "fast"
+	sizeLimit := resource.MustParse("64Mi")
+	as := testAppService()
+	as.Spec.Volumes = []cloudshipv1beta1.Volume{
+		{Name: "data", PersistentVolumeClaim: &cloudshipv1beta1.PersistentVolumeClaimVolume{
+			Size:             resource.MustParse("10Gi"),
+			StorageClassName: &storageClass,
+		}},
+		{Name: "config", ConfigMap: &cloudshipv1beta1.FilesVolume{
+			Name:  "web-config",
+			Items: []cloudshipv1beta1.KeyToPath{{Key: "nginx.conf", Path: "default.conf"}},
+		}},
+		{Name: "tls", Secret: &cloudshipv1beta1.FilesVolume{Name: "web-tls", DefaultMode: &mode}},
+		{Name: "cache", EmptyDir: &cloudshipv1beta1.EmptyDirVolume{InMemory: true, SizeLimit: &sizeLimit}},
+		{Name: "tmp"},
+	}
+	as.Spec.Containers[0].VolumeMounts = []cloudshipv1beta1.VolumeMount{
+		{Name: "data", MountPath: "/data"},
+		{Name: "config", MountPath: "/etc/nginx/conf.d", ReadOnly: true},
+	}
+
+	expected := []corev1.Volume{
+		{Name: "data", VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+			ClaimName: "web-data",
+		}}},
+		{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "web-config"},
+			Items:                []corev1.KeyToPath{{Key: "nginx.conf", Path: "default.conf"}},
+		}}},
+		{Name: "tls", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+			SecretName:  "web-tls",
+			DefaultMode: &mode,
+		}}},
+		{Name: "cache", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{
+			Medium:    corev1.StorageMediumMemory,
+			SizeLimit: &sizeLimit,
+		}}},
+		{Name: "tmp", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+	}
+	if volumes := translateVolumes(as); !reflect.DeepEqual(volumes, expected) {
+		t.Errorf("expected volumes %v, got %v", expected, volumes)
+	}
+
+	claims := translateVolumeClaims(as)
+	if len(claims) != 1 {
+		t.Fatalf("expected a claim, got %d", len(claims))
+	}
+	claim := claims[0]
+	if claim.GetName() != "web-data" || claim.GetNamespace() != "shop" || *claim.Spec.StorageClassName != "fast" ||
+		!reflect.DeepEqual(claim.Spec.AccessModes, []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}) ||
+		!claim.Spec.Resources.Requests.Storage().Equal(resource.MustParse("10Gi")) {
+		t.Errorf("expected the claim shop/web-data of 10Gi, got %+v", claim)
+	}
+
+	template, err := translatePodTemplate(as, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mounts := []corev1.VolumeMount{
+		{Name: "data", MountPath: "/data"},
+		{Name: "config", MountPath: "/etc/nginx/conf.d", ReadOnly: true},
+	}
+	if !reflect.DeepEqual(template.Spec.Containers[0].VolumeMounts, mounts) {
+		t.Errorf("expected mounts %v, got %v", mounts, template.Spec.Containers[0].VolumeMounts)
+	}
+
+	as.Spec.Containers[1].VolumeMounts = []cloudshipv1beta1.VolumeMount{{Name: "logs", MountPath: "/var/log"}}
+	if _, err := translatePodTemplate(as, nil); err == nil || !strings.Contains(err.Error(), "mounts unknown volume logs") {
+		t.Errorf("expected a mount of an unknown volume to fail, got %v", err)
+	}
+}
+
+func TestTranslatePodTemplateEnv(t *testing.T) {
+	url := "redis://cache.example.com:6379"
+	debug := "true"
+	as := &cloudshipv1beta1.AppService{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"},
+		Spec: cloudshipv1beta1.AppServiceSpec{
+			Containers: []cloudshipv1beta1.Container{
+				{Name: "web", Image: "nginx:1.19", Environment: []cloudshipv1beta1.ContainerEnvVar{
+					{Name: "DEBUG", Value: &debug},
+					{Name: "CACHE_URL", Value: &url},
+				}},
+				{Name: "worker", Image: "nginx:1.19"},
+			},
+		},
+	}
+	injected := []corev1.EnvVar{
+		{Name: "CACHE_HOST", Value: "cache-sessions-redis-master"},
+		{Name: "CACHE_URL", Value: "redis://cache-sessions-redis-master:6379"},
+		{Name: "CACHE_PORT", Value: "6379"},
+	}
+
+	template, err := translatePodTemplate(as, injected)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []corev1.EnvVar{
+		{Name: "CACHE_HOST", Value: "cache-sessions-redis-master"},
+		{Name: "CACHE_URL", Value: url},
+		{Name: "CACHE_PORT", Value: "6379"},
+		{Name: "DEBUG", Value: debug},
+	}
+	if env := template.Spec.Containers[0].Env; !reflect.DeepEqual(env, expected) {
+		t.Errorf("expected the variables of container web to be %v, got %v", expected, env)
+	}
+	if env := template.Spec.Containers[1].Env; !reflect.DeepEqual(env, injected) {
+		t.Errorf("expected the variables of container worker to be %v, got %v", injected, env)
+	}
+	if injected[1].Value != "redis://cache-sessions-redis-master:6379" {
+		t.Errorf("expected the variables of the backing services to be left unchanged, got %v", injected)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+)
+
+// +kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch
+
+const (
+	// configChecksumAnnotation records on the pod template the checksum of
+	// the ConfigMaps and Secrets mounted by the containers, so that editing
+	// them rolls the pods out
+	configChecksumAnnotation = "cloudship.toucansoft.io/config-checksum"
+)
+
+// reconcileVolumeClaims applies the PersistentVolumeClaims of the volumes of
+// the service. Claims of removed volumes are kept with their data, and are
+// deleted with the service.
+func (r *AppServiceReconciler) reconcileVolumeClaims(ctx context.Context, appService *cloudshipv1beta1.AppService,
+	opts ...client.PatchOption) error {
+	for _, claim := range translateVolumeClaims(appService) {
+		if err := ctrl.SetControllerReference(appService, claim, r.Scheme); err != nil {
+			return err
+		}
+		if err := r.Patch(ctx, claim, client.Apply, opts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configChecksum returns the checksum of the content of the ConfigMaps and
+// Secrets mounted as volumes of the service, or an empty string when none is
+// mounted. Missing ones are left out, the pods wait for them to be created.
+func (r *AppServiceReconciler) configChecksum(ctx context.Context, appService *cloudshipv1beta1.AppService) (string, error) {
+	hash := sha256.New()
+	mounted := false
+	for _, v := range appService.Spec.Volumes {
+		key := client.ObjectKey{Namespace: appService.GetNamespace()}
+		switch {
+		case v.ConfigMap != nil:
+			key.Name = v.ConfigMap.Name
+			var configMap corev1.ConfigMap
+			if err := r.Get(ctx, key, &configMap); err != nil {
+				if client.IgnoreNotFound(err) != nil {
+					return "", err
+				}
+				continue
+			}
+			fmt.Fprintf(hash, "configmap/%s\n", key.Name)
+			for _, k := range sortedKeys(configMap.Data) {
+				fmt.Fprintf(hash, "%s=%s\n", k, configMap.Data[k])
+			}
+			for _, k := range sortedByteKeys(configMap.BinaryData) {
+				fmt.Fprintf(hash, "%s=%x\n", k, configMap.BinaryData[k])
+			}
+		case v.Secret != nil:
+			key.Name = v.Secret.Name
+			var secret corev1.Secret
+			if err := r.Get(ctx, key, &secret); err != nil {
+				if client.IgnoreNotFound(err) != nil {
+					return "", err
+				}
+				continue
+			}
+			fmt.Fprintf(hash, "secret/%s\n", key.Name)
+			for _, k := range sortedByteKeys(secret.Data) {
+				fmt.Fprintf(hash, "%s=%x\n", k, secret.Data[k])
+			}
+		default:
+			continue
+		}
+		mounted = true
+	}
+	if !mounted {
+		return "", nil
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedByteKeys(m map[string][]byte) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// appServicesForConfigMap maps a ConfigMap to the services mounting it.
+func (r *AppServiceReconciler) appServicesForConfigMap(obj client.Object) []reconcile.Request {
+	return r.appServicesIn(obj.GetNamespace(), func(appService *cloudshipv1beta1.AppService) bool {
+		for _, v := range appService.Spec.Volumes {
+			if v.ConfigMap != nil && v.ConfigMap.Name == obj.GetName() {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// appServicesForSecret maps a Secret to the services mounting it.
+func (r *AppServiceReconciler) appServicesForSecret(obj client.Object) []reconcile.Request {
+	return r.appServicesIn(obj.GetNamespace(), func(appService *cloudshipv1beta1.AppService) bool {
+		for _, v := range appService.Spec.Volumes {
+			if v.Secret != nil && v.Secret.Name == obj.GetName() {
+				return true
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+)
+
+// testReconciler returns a reconciler of services reading the objects.
+func testReconciler(t *testing.T, objs ...client.Object) *AppServiceReconciler {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := cloudshipv1beta1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	return &AppServiceReconciler{
+		Client: fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build(),
+		Log:    ctrl.Log.WithName("test"),
+		Scheme: s,
+	}
+}
+
+// mountingAppService returns the service shop/web mounting the ConfigMap
+// web-config and the Secret web-tls.
+func mountingAppService() *cloudshipv1beta1.AppService {
+	as := testAppService()
+	as.Spec.Volumes = []cloudshipv1beta1.Volume{
+		{Name: "config", ConfigMap: &cloudshipv1beta1.FilesVolume{Name: "web-config"}},
+		{Name: "tls", Secret: &cloudshipv1beta1.FilesVolume{Name: "web-tls"}},
+		{Name: "tmp"},
+	}
+	return as
+}
+
+func TestConfigChecksum(t *testing.T) {
+	configMap := func(data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "web-config", Namespace: "shop"}, Data: data}
+	}
+	secret := func(data map[string][]byte) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "web-tls", Namespace: "shop"}, Data: data}
+	}
+	checksum := func(t *testing.T, as *cloudshipv1beta1.AppService, objs ...client.Object) string {
+		sum, err := testReconciler(t, objs...).configChecksum(context.Background(), as)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sum
+	}
+
+	base := checksum(t, mountingAppService(),
+		configMap(map[string]string{"a": "1", "b": "2"}), secret(map[string][]byte{"tls.key": []byte("key")}))
+	if base == "" {
+		t.Fatal("expected a checksum of the mounted objects")
+	}
+
+	tests := []struct {
+		name  string
+		as    *cloudshipv1beta1.AppService
+		objs  []client.Object
+		equal bool
+	}{
+		{
+			name:  "same content",
+			as:    mountingAppService(),
+			objs:  []client.Object{configMap(map[string]string{"b": "2", "a": "1"}), secret(map[string][]byte{"tls.key": []byte("key")})},
+			equal: true,
+		},
+		{
+			name: "edited ConfigMap",
+			as:   mountingAppService(),
+			objs: []client.Object{configMap(map[string]string{"a": "1", "b": "3"}), secret(map[string][]byte{"tls.key": []byte("key")})},
+		},
+		{
+			name: "edited Secret",
+			as:   mountingAppService(),
+			objs: []client.Object{configMap(map[string]string{"a": "1", "b": "2"}), secret(map[string][]byte{"tls.key": []byte("new")})},
+		},
+		{
+			name: "missing Secret",
+			as:   mountingAppService(),
+			objs: []client.Object{configMap(map[string]string{"a": "1", "b": "2"})},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sum := checksum(t, tt.as, tt.objs...)
+			if sum == "" {
+				t.Fatal("expected a checksum of the mounted objects")
+			}
+			if (sum == base) != tt.equal {
+				t.Errorf("expected the checksums %s and %s to be equal: %t", sum, base, tt.equal)
+			}
+		})
+	}
+
+	t.Run("nothing mounted", func(t *testing.T) {
+		if sum := checksum(t, testAppService()); sum != "" {
+			t.Errorf("expected no checksum, got %s", sum)
+		}
+	})
+	t.Run("mounted objects missing", func(t *testing.T) {
+		if sum := checksum(t, mountingAppService()); sum != "" {
+			t.Errorf("expected no checksum, got %s", sum)
+		}
+	})
+}
+
+func TestRenderWorkloadConfigChecksum(t *testing.T) {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-config", Namespace: "shop"},
+		Data:       map[string]string{"nginx.conf": "server {}"},
+	}
+	tests := []struct {
+		name      string
+		as        *cloudshipv1beta1.AppService
+		annotated bool
+	}{
+		{name: "nothing mounted", as: testAppService()},
+		{name: "ConfigMap mounted", as: mountingAppService(), annotated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testReconciler(t, configMap)
+			workload, err := r.renderWorkload(context.Background(), tt.as, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			deployment := workload.(*appsv1.Deployment)
+			annotation, ok := deployment.Spec.Template.GetAnnotations()[configChecksumAnnotation]
+			if ok != tt.annotated {
+				t.Fatalf("expected the pod template to be annotated: %t, got %v", tt.annotated, deployment.Spec.Template.GetAnnotations())
+			}
+			if !tt.annotated {
+				return
+			}
+			sum, err := r.configChecksum(context.Background(), tt.as)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if annotation != sum {
+				t.Errorf("expected the checksum %s, got %s", sum, annotation)
+			}
+			if !metav1.IsControlledBy(deployment, tt.as) {
+				t.Errorf("expected the Deployment to be controlled by the service, got %v", deployment.GetOwnerReferences())
+			}
+		})
+	}
+}
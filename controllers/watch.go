@@ -0,0 +1,65 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+)
+
+const (
+	// helmReleaseNameAnnotation is set by Helm on every resource of a release
+	helmReleaseNameAnnotation = "meta.helm.sh/release-name"
+)
+
+// releaseWorkloads returns the kinds of workloads rendered by the charts of
+// backing services, watched to follow their readiness.
+func releaseWorkloads() []client.Object {
+	return []client.Object{
+		&appsv1.Deployment{},
+		&appsv1.StatefulSet{},
+		&appsv1.DaemonSet{},
+	}
+}
+
+// helmManaged filters the objects that belong to a Helm release.
+var helmManaged = predicate.NewPredicateFuncs(func(obj client.Object) bool {
+	_, ok := obj.GetAnnotations()[helmReleaseNameAnnotation]
+	return ok
+})
+
+// applicationStatusChanged filters the updates of applications to the ones
+// changing their status, which carries the connection details services are
+// configured with.
+var applicationStatusChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldApp, ok := e.ObjectOld.(*cloudshipv1beta1.Application)
+		if !ok {
+			return false
+		}
+		newApp, ok := e.ObjectNew.(*cloudshipv1beta1.Application)
+		if !ok {
+			return false
+		}
+		return !equality.Semantic.DeepEqual(oldApp.Status, newApp.Status)
+	},
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+	"github.com/ToucanSoftware/cloudship-operator/pkg/types"
+)
+
+// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs;cronjobs,verbs=get;list;watch;create;update;patch;delete
+
+const (
+	// templateHashAnnotation records the hash of the pod template of a Job,
+	// which cannot change once the Job is created
+	templateHashAnnotation = "cloudship.toucansoft.io/template-hash"
+)
+
+var (
+	// cronJobV1GVK is the version of CronJob applied when the cluster serves
+	// it. The batch/v1beta1 types are rendered as batch/v1, which has the
+	// same schema.
+	cronJobV1GVK = schema.GroupVersionKind{Group: batchv1.GroupName, Version: "v1", Kind: cronJobKind}
+)
+
+// cronJobV1Served reports whether the cluster serves batch/v1 CronJobs.
+func cronJobV1Served(mapper meta.RESTMapper) bool {
+	_, err := mapper.RESTMapping(cronJobV1GVK.GroupKind(), cronJobV1GVK.Version)
+	return err == nil
+}
+
+// newCronJob returns an empty CronJob of the version served by the cluster.
+func newCronJob(mapper meta.RESTMapper) client.Object {
+	if !cronJobV1Served(mapper) {
+		return &batchv1beta1.CronJob{}
+	}
+	cronJob := &unstructured.Unstructured{}
+	cronJob.SetGroupVersionKind(cronJobV1GVK)
+	return cronJob
+}
+
+// applyWorkload applies the workload running the containers of the service
+// and deletes the workloads of other kinds left by a change of workload
+// type. Jobs are recreated when their pod template changes.
+func (r *AppServiceReconciler) applyWorkload(ctx context.Context, appService *cloudshipv1beta1.AppService,
+	workload types.Object, opts ...client.PatchOption) error {
+	for _, stale := range r.staleWorkloads(workload) {
+		if err := r.deleteOwned(ctx, appService, stale); err != nil {
+			return err
+		}
+	}
+
+	switch w := workload.(type) {
+	case *batchv1.Job:
+		hash, err := templateHash(&w.Spec.Template)
+		if err != nil {
+			return err
+		}
+		metav1.SetMetaDataAnnotation(&w.ObjectMeta, templateHashAnnotation, hash)
+
+		var existing batchv1.Job
+		err = r.Get(ctx, client.ObjectKeyFromObject(w), &existing)
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		if err == nil && metav1.IsControlledBy(&existing, appService) {
+			if existing.GetAnnotations()[templateHashAnnotation] == hash {
+				existing.DeepCopyInto(w)
+				return nil
+			}
+			propagation := client.PropagationPolicy(metav1.DeletePropagationBackground)
+			if err := r.Delete(ctx, &existing, propagation); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+		}
+	case *batchv1beta1.CronJob:
+		if cronJobV1Served(r.RESTMapper()) {
+			content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(w)
+			if err != nil {
+				return err
+			}
+			cronJob := &unstructured.Unstructured{Object: content}
+			cronJob.SetGroupVersionKind(cronJobV1GVK)
+			return r.Patch(ctx, cronJob, client.Apply, opts...)
+		}
+	}
+	return r.Patch(ctx, workload, client.Apply, opts...)
+}
+
+// staleWorkloads returns empty objects of the workload kinds other than the
+// one of workload.
+func (r *AppServiceReconciler) staleWorkloads(workload types.Object) []client.Object {
+	var stale []client.Object
+	if _, ok := workload.(*appsv1.Deployment); !ok {
+		stale = append(stale, &appsv1.Deployment{})
+	}
+	if _, ok := workload.(*appsv1.StatefulSet); !ok {
+		stale = append(stale, &appsv1.StatefulSet{})
+	}
+	if _, ok := workload.(*batchv1.Job); !ok {
+		stale = append(stale, &batchv1.Job{})
+	}
+	if _, ok := workload.(*batchv1beta1.CronJob); !ok {
+		stale = append(stale, newCronJob(r.RESTMapper()))
+	}
+	return stale
+}
+
+// templateHash returns the hash of a pod template.
+func templateHash(template *corev1.PodTemplateSpec) (string, error) {
+	content, err := json.Marshal(template)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(content)), nil
+}
+
+// scaleTarget returns the reference of an autoscaler to the workload, or
+// false when the workload cannot be scaled.
+func scaleTarget(workload types.Object) (autoscalingv2beta2.CrossVersionObjectReference, bool) {
+	switch workload.(type) {
+	case *appsv1.Deployment:
+		return autoscalingv2beta2.CrossVersionObjectReference{
+			APIVersion: deploymentAPIVersion,
+			Kind:       deploymentKind,
+			Name:       workload.GetName(),
+		}, true
+	case *appsv1.StatefulSet:
+		return autoscalingv2beta2.CrossVersionObjectReference{
+			APIVersion: statefulSetAPIVersion,
+			Kind:       statefulSetKind,
+			Name:       workload.GetName(),
+		}, true
+	}
+	return autoscalingv2beta2.CrossVersionObjectReference{}, false
+}
+
+// workloadReady reports whether the applied workload is ready, with the
+// reason when it is not.
+func workloadReady(workload types.Object) (bool, string) {
+	switch w := workload.(type) {
+	case *appsv1.Deployment:
+		if w.Status.ObservedGeneration < w.GetGeneration() {
+			return false, fmt.Sprintf("Deployment %s is rolling out", w.GetName())
+		}
+		for _, condition := range w.Status.Conditions {
+			if condition.Type == appsv1.DeploymentAvailable && condition.Status == corev1.ConditionTrue {
+				return true, ""
+			}
+		}
+		return false, fmt.Sprintf("Deployment %s is not available", w.GetName())
+	case *appsv1.StatefulSet:
+		replicas := int32(1)
+		if w.Spec.Replicas != nil {
+			replicas = *w.Spec.Replicas
+		}
+		if w.Status.ObservedGeneration < w.GetGeneration() || w.Status.ReadyReplicas < replicas {
+			return false, fmt.Sprintf("StatefulSet %s has %d of %d replicas ready", w.GetName(), w.Status.ReadyReplicas, replicas)
+		}
+		return true, ""
+	case *batchv1.Job:
+		for _, condition := range w.Status.Conditions {
+			if condition.Status != corev1.ConditionTrue {
+				continue
+			}
+			switch condition.Type {
+			case batchv1.JobComplete:
+				return true, ""
+			case batchv1.JobFailed:
+				return false, fmt.Sprintf("Job %s failed: %s", w.GetName(), condition.Message)
+			}
+		}
+		return false, fmt.Sprintf("Job %s is running", w.GetName())
+	}
+	// a CronJob is ready once it is scheduled
+	return true, ""
+}
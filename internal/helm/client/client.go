@@ -18,11 +18,16 @@ package client
 
 import (
 	"errors"
+	"io"
+	"strings"
 
 	"helm.sh/helm/v3/pkg/kube"
 	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/resource"
 	"k8s.io/client-go/discovery"
 	cached "k8s.io/client-go/discovery/cached"
 	"k8s.io/client-go/rest"
@@ -98,6 +103,16 @@ func NewRESTClientGetter(mgr manager.Manager, ns string) (genericclioptions.REST
 
 var _ kube.Interface = &ownerRefInjectingClient{}
 
+const (
+	// OwnerAnnotation is set on resources that cannot carry an owner reference
+	// to their owner, e.g. cluster scoped resources owned by a namespaced
+	// owner. It holds the namespaced name of the owner.
+	OwnerAnnotation = "cloudship.toucansoft.io/owner"
+	// OwnerTypeAnnotation holds the group kind of the owner of resources
+	// annotated with OwnerAnnotation.
+	OwnerTypeAnnotation = "cloudship.toucansoft.io/owner-type"
+)
+
 // NewOwnerRefInjectingClient new client for owner reference injection
 func NewOwnerRefInjectingClient(base kube.Client, restMapper meta.RESTMapper,
 	cr *unstructured.Unstructured) (kube.Interface, error) {
@@ -123,52 +138,79 @@ type ownerRefInjectingClient struct {
 	owner      *unstructured.Unstructured
 }
 
-// func (c *ownerRefInjectingClient) Build(reader io.Reader, validate bool) (kube.ResourceList, error) {
-// 	resourceList, err := c.Client.Build(reader, validate)
-// 	if err != nil {
-// 		return resourceList, err
-// 	}
-// 	err = resourceList.Visit(func(r *resource.Info, err error) error {
-// 		if err != nil {
-// 			return err
-// 		}
-// 		objMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(r.Object)
-// 		if err != nil {
-// 			return err
-// 		}
-// 		u := &unstructured.Unstructured{Object: objMap}
-// 		useOwnerRef, err := k8sutil.SupportsOwnerReference(c.restMapper, c.owner, u)
-// 		if err != nil {
-// 			return err
-// 		}
-
-// 		// If the resource contains the Helm resource-policy keep annotation, then do not add
-// 		// the owner reference. So when the CR is deleted, Kubernetes won't GCs the resource.
-// 		if useOwnerRef && !containsResourcePolicyKeep(u.GetAnnotations()) {
-// 			ownerRef := metav1.NewControllerRef(c.owner, c.owner.GroupVersionKind())
-// 			u.SetOwnerReferences([]metav1.OwnerReference{*ownerRef})
-// 		} else {
-// 			err := handler.SetOwnerAnnotations(u, c.owner)
-// 			if err != nil {
-// 				return err
-// 			}
-// 		}
-// 		return nil
-// 	})
-// 	if err != nil {
-// 		return nil, err
-// 	}
-// 	return resourceList, nil
-// }
-
-// func containsResourcePolicyKeep(annotations map[string]string) bool {
-// 	if annotations == nil {
-// 		return false
-// 	}
-// 	resourcePolicyType, ok := annotations[kube.ResourcePolicyAnno]
-// 	if !ok {
-// 		return false
-// 	}
-// 	resourcePolicyType = strings.ToLower(strings.TrimSpace(resourcePolicyType))
-// 	return resourcePolicyType == kube.KeepPolicy
-// }
+// Build builds the resources of a release manifest and injects the owner into
+// every resource: as a controller reference when Kubernetes supports it, or
+// as owner annotations otherwise.
+func (c *ownerRefInjectingClient) Build(reader io.Reader, validate bool) (kube.ResourceList, error) {
+	resourceList, err := c.Client.Build(reader, validate)
+	if err != nil || c.owner == nil {
+		return resourceList, err
+	}
+	err = resourceList.Visit(func(r *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+		obj, err := meta.Accessor(r.Object)
+		if err != nil {
+			return err
+		}
+		useOwnerRef, err := supportsOwnerReference(c.restMapper, c.owner, r)
+		if err != nil {
+			return err
+		}
+
+		// If the resource contains the Helm resource-policy keep annotation, then do not add
+		// the owner reference. So when the CR is deleted, Kubernetes won't GCs the resource.
+		if useOwnerRef && !containsResourcePolicyKeep(obj.GetAnnotations()) {
+			ownerRef := metav1.NewControllerRef(c.owner, c.owner.GroupVersionKind())
+			obj.SetOwnerReferences([]metav1.OwnerReference{*ownerRef})
+		} else {
+			setOwnerAnnotations(obj, c.owner)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resourceList, nil
+}
+
+// supportsOwnerReference checks whether the dependent resource can be owned by
+// owner. A cluster scoped owner can own any resource, while a namespaced owner
+// can only own resources in its own namespace.
+func supportsOwnerReference(restMapper meta.RESTMapper, owner *unstructured.Unstructured, dependent *resource.Info) (bool, error) {
+	ownerGVK := owner.GroupVersionKind()
+	ownerMapping, err := restMapper.RESTMapping(ownerGVK.GroupKind(), ownerGVK.Version)
+	if err != nil {
+		return false, err
+	}
+	if ownerMapping.Scope.Name() == meta.RESTScopeNameRoot {
+		return true, nil
+	}
+	if dependent.Mapping == nil || dependent.Mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		return false, nil
+	}
+	return owner.GetNamespace() == dependent.Namespace, nil
+}
+
+func setOwnerAnnotations(obj metav1.Object, owner *unstructured.Unstructured) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[OwnerAnnotation] = types.NamespacedName{Namespace: owner.GetNamespace(), Name: owner.GetName()}.String()
+	annotations[OwnerTypeAnnotation] = owner.GroupVersionKind().GroupKind().String()
+	obj.SetAnnotations(annotations)
+}
+
+func containsResourcePolicyKeep(annotations map[string]string) bool {
+	if annotations == nil {
+		return false
+	}
+	resourcePolicyType, ok := annotations[kube.ResourcePolicyAnno]
+	if !ok {
+		return false
+	}
+	resourcePolicyType = strings.ToLower(strings.TrimSpace(resourcePolicyType))
+	return resourcePolicyType == kube.KeepPolicy
+}
@@ -0,0 +1,228 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/kube"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/rest/fake"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/kubectl/pkg/validation"
+)
+
+var (
+	applicationGVK = schema.GroupVersionKind{Group: "cloudship.toucansoft.io", Version: "v1beta1", Kind: "Application"}
+	appServiceGVK  = schema.GroupVersionKind{Group: "cloudship.toucansoft.io", Version: "v1beta1", Kind: "AppService"}
+)
+
+// fakeFactory builds resources from manifests without an API server.
+type fakeFactory struct {
+	kube.Factory
+	restMapper meta.RESTMapper
+}
+
+func (f fakeFactory) NewBuilder() *resource.Builder {
+	return resource.NewFakeBuilder(
+		func(schema.GroupVersion) (resource.RESTClient, error) { return &fake.RESTClient{}, nil },
+		func() (meta.RESTMapper, error) { return f.restMapper, nil },
+		func() (restmapper.CategoryExpander, error) { return restmapper.SimpleCategoryExpander{}, nil },
+	)
+}
+
+func (f fakeFactory) Validator(bool) (validation.Schema, error) {
+	return validation.NullSchema{}, nil
+}
+
+func testRESTMapper() meta.RESTMapper {
+	restMapper := meta.NewDefaultRESTMapper(nil)
+	restMapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	restMapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, meta.RESTScopeRoot)
+	restMapper.Add(applicationGVK, meta.RESTScopeRoot)
+	restMapper.Add(appServiceGVK, meta.RESTScopeNamespace)
+	return restMapper
+}
+
+func testOwner(gvk schema.GroupVersionKind, namespace, name string) *unstructured.Unstructured {
+	owner := &unstructured.Unstructured{}
+	owner.SetGroupVersionKind(gvk)
+	owner.SetNamespace(namespace)
+	owner.SetName(name)
+	owner.SetUID(types.UID("uid-" + name))
+	return owner
+}
+
+const (
+	configMapManifest = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cache-sessions-redis
+`
+	otherNamespaceManifest = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cache-sessions-redis
+  namespace: monitoring
+`
+	keptManifest = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cache-sessions-redis
+  annotations:
+    helm.sh/resource-policy: " Keep "
+`
+	clusterRoleManifest = `apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: cache-sessions-redis
+`
+)
+
+func TestBuildInjectsOwner(t *testing.T) {
+	web := testOwner(appServiceGVK, "shop", "web")
+	shop := testOwner(applicationGVK, "", "shop")
+
+	tests := []struct {
+		name        string
+		owner       *unstructured.Unstructured
+		manifest    string
+		ownerRef    bool
+		annotations map[string]string
+	}{
+		{
+			name:     "namespaced owner of a namespaced resource",
+			owner:    web,
+			manifest: configMapManifest,
+			ownerRef: true,
+		},
+		{
+			name:     "namespaced owner of a resource in another namespace",
+			owner:    web,
+			manifest: otherNamespaceManifest,
+			annotations: map[string]string{
+				OwnerAnnotation:     "shop/web",
+				OwnerTypeAnnotation: "AppService.cloudship.toucansoft.io",
+			},
+		},
+		{
+			name:     "namespaced owner of a cluster scoped resource",
+			owner:    web,
+			manifest: clusterRoleManifest,
+			annotations: map[string]string{
+				OwnerAnnotation:     "shop/web",
+				OwnerTypeAnnotation: "AppService.cloudship.toucansoft.io",
+			},
+		},
+		{
+			name:     "cluster scoped owner of a namespaced resource",
+			owner:    shop,
+			manifest: configMapManifest,
+			ownerRef: true,
+		},
+		{
+			name:     "cluster scoped owner of a cluster scoped resource",
+			owner:    shop,
+			manifest: clusterRoleManifest,
+			ownerRef: true,
+		},
+		{
+			name:     "resource kept by Helm",
+			owner:    web,
+			manifest: keptManifest,
+			annotations: map[string]string{
+				kube.ResourcePolicyAnno: " Keep ",
+				OwnerAnnotation:         "shop/web",
+				OwnerTypeAnnotation:     "AppService.cloudship.toucansoft.io",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := kube.Client{Factory: fakeFactory{restMapper: testRESTMapper()}, Namespace: "shop", Log: func(string, ...interface{}) {}}
+			c, err := NewOwnerRefInjectingClient(base, testRESTMapper(), tt.owner)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resources, err := c.Build(strings.NewReader(tt.manifest), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(resources) != 1 {
+				t.Fatalf("expected a resource, got %d", len(resources))
+			}
+			obj, err := meta.Accessor(resources[0].Object)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			refs := obj.GetOwnerReferences()
+			if tt.ownerRef {
+				if len(refs) != 1 || !metav1.IsControlledBy(obj, tt.owner) {
+					t.Errorf("expected %s to be controlled by %s, got %v", obj.GetName(), tt.owner.GetName(), refs)
+				}
+			} else if len(refs) != 0 {
+				t.Errorf("expected %s to have no owner, got %v", obj.GetName(), refs)
+			}
+			if annotations := obj.GetAnnotations(); len(annotations) != len(tt.annotations) {
+				t.Errorf("expected annotations %v, got %v", tt.annotations, annotations)
+			} else {
+				for k, v := range tt.annotations {
+					if annotations[k] != v {
+						t.Errorf("expected annotations %v, got %v", tt.annotations, annotations)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNewOwnerRefInjectingClient(t *testing.T) {
+	tests := []struct {
+		name  string
+		owner *unstructured.Unstructured
+		valid bool
+	}{
+		{name: "no owner", valid: true},
+		{name: "owner", owner: testOwner(appServiceGVK, "shop", "web"), valid: true},
+		{name: "no kind", owner: testOwner(schema.GroupVersionKind{}, "shop", "web")},
+		{name: "no name", owner: testOwner(appServiceGVK, "shop", "")},
+		{name: "no UID", owner: func() *unstructured.Unstructured {
+			owner := testOwner(appServiceGVK, "shop", "web")
+			owner.SetUID("")
+			return owner
+		}()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewOwnerRefInjectingClient(kube.Client{}, testRESTMapper(), tt.owner)
+			if tt.valid && err != nil {
+				t.Errorf("expected the owner to be valid, got %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("expected the owner to be invalid")
+			}
+		})
+	}
+}
@@ -32,8 +32,10 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	cloudshipv1alpha1 "github.com/ToucanSoftware/cloudship-operator/api/v1alpha1"
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
 	"github.com/ToucanSoftware/cloudship-operator/controllers"
 	"github.com/ToucanSoftware/cloudship-operator/pkg/helm/release"
+	"github.com/ToucanSoftware/cloudship-operator/pkg/webhooks"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -46,6 +48,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(cloudshipv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(cloudshipv1beta1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
@@ -79,26 +82,24 @@ func main() {
 		os.Exit(1)
 	}
 
+	catalog := release.NewCatalog(mgr)
+
 	if err = (&controllers.ApplicationReconciler{
-		Client:                   mgr.GetClient(),
-		EventRecorder:            mgr.GetEventRecorderFor("Application"),
-		Log:                      ctrl.Log.WithName("controllers").WithName("Application"),
-		Scheme:                   mgr.GetScheme(),
-		MemecachedManagerFactory: release.NewMemecachedManagerFactory(mgr),
-		RedisManagerFactory:      release.NewRedisManagerFactory(mgr),
-		RabbitMQManagerFactory:   release.NewRabbitMQManagerFactory(mgr),
-		KafkaManagerFactory:      release.NewKafkaManagerFactory(mgr),
+		Client:        mgr.GetClient(),
+		EventRecorder: mgr.GetEventRecorderFor("Application"),
+		Log:           ctrl.Log.WithName("controllers").WithName("Application"),
+		Scheme:        mgr.GetScheme(),
+		Catalog:       catalog,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Application")
 		os.Exit(1)
 	}
 	if err = (&controllers.AppServiceReconciler{
-		Client:                   mgr.GetClient(),
-		EventRecorder:            mgr.GetEventRecorderFor("AppService"),
-		Log:                      ctrl.Log.WithName("controllers").WithName("AppService"),
-		Scheme:                   mgr.GetScheme(),
-		MySQLManagerFactory:      release.NewMySQLManagerFactory(mgr),
-		PostgreSQLManagerFactory: release.NewPostgreSQLManagerFactory(mgr),
+		Client:        mgr.GetClient(),
+		EventRecorder: mgr.GetEventRecorderFor("AppService"),
+		Log:           ctrl.Log.WithName("controllers").WithName("AppService"),
+		Scheme:        mgr.GetScheme(),
+		Catalog:       catalog,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "AppService")
 		os.Exit(1)
@@ -108,10 +109,18 @@ func main() {
 		EventRecorder: mgr.GetEventRecorderFor("AppResource"),
 		Log:           ctrl.Log.WithName("controllers").WithName("AppResource"),
 		Scheme:        mgr.GetScheme(),
+		Catalog:       catalog,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "AppResource")
 		os.Exit(1)
 	}
+	// the webhooks can be disabled to run the operator outside the cluster
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = webhooks.SetupWithManager(mgr, catalog); err != nil {
+			setupLog.Error(err, "unable to create webhooks")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("health", healthz.Ping); err != nil {
@@ -0,0 +1,129 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package database creates the databases of services, and the users owning
+// them, on the database servers shared by the services of an application.
+// The operator connects to the servers over the SQL protocol as their
+// administrator.
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+)
+
+const (
+	// maxNameLength is the length of the longest user name MySQL accepts,
+	// shorter than the longest identifiers of PostgreSQL
+	maxNameLength int = 32
+)
+
+// Server creates and drops databases and users on a database server.
+type Server interface {
+	// EnsureDatabase creates the database and the user owning it, unless
+	// they exist. The password of the user is set to password.
+	EnsureDatabase(ctx context.Context, database, username, password string) error
+	// DropDatabase drops the database and the user owning it, if they exist.
+	DropDatabase(ctx context.Context, database, username string) error
+	// Close closes the connections to the server.
+	Close() error
+}
+
+// Connection are the details the operator connects to a server with.
+type Connection struct {
+	// Hostname is the hostname of the server
+	Hostname string
+	// Port is the port of the server
+	Port string
+	// Username is the name of the administrator of the server
+	Username string
+	// Password is the password of the administrator
+	Password string
+	// TLS is set when the server only accepts TLS connections. The
+	// certificates of the servers are usually self-signed, so they are not
+	// verified.
+	TLS bool
+}
+
+// Supported reports whether the databases of a type can be created on a
+// shared server.
+func Supported(databaseType cloudshipv1beta1.DatabaseType) bool {
+	switch databaseType {
+	case cloudshipv1beta1.DatabaseTypePostgreSQL, cloudshipv1beta1.DatabaseTypeMySQL:
+		return true
+	}
+	return false
+}
+
+// Open connects to a database server of a type.
+func Open(databaseType cloudshipv1beta1.DatabaseType, conn Connection) (Server, error) {
+	var driverName, dataSourceName string
+	switch databaseType {
+	case cloudshipv1beta1.DatabaseTypePostgreSQL:
+		driverName, dataSourceName = postgresqlDriver, postgresqlDataSourceName(conn)
+	case cloudshipv1beta1.DatabaseTypeMySQL:
+		driverName, dataSourceName = mysqlDriver, mysqlDataSourceName(conn)
+	default:
+		return nil, fmt.Errorf("databases of type %s cannot be shared", databaseType)
+	}
+	db, err := sql.Open(driverName, dataSourceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s server %s: %w", databaseType, conn.Hostname, err)
+	}
+	return NewServer(databaseType, db)
+}
+
+// NewServer returns the Server of a type reached through db, which it closes
+// when closed.
+func NewServer(databaseType cloudshipv1beta1.DatabaseType, db *sql.DB) (Server, error) {
+	switch databaseType {
+	case cloudshipv1beta1.DatabaseTypePostgreSQL:
+		return &postgresqlServer{db: db}, nil
+	case cloudshipv1beta1.DatabaseTypeMySQL:
+		return &mysqlServer{db: db}, nil
+	}
+	return nil, fmt.Errorf("databases of type %s cannot be shared", databaseType)
+}
+
+// Name returns the name of the database, and of the user owning it, created
+// on a shared server for the database of a service, e.g. orders_main for the
+// database main of the service orders. Names with characters the servers do
+// not accept in identifiers, or too long for them, are shortened or replaced
+// and suffixed with a hash of the original name so they stay unique.
+func Name(service, database string) string {
+	name := service + "_" + database
+	sanitized := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+	if sanitized == name && len(name) <= maxNameLength {
+		return name
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(name))
+	suffix := fmt.Sprintf("_%08x", hash.Sum32())
+	if len(sanitized) > maxNameLength-len(suffix) {
+		sanitized = sanitized[:maxNameLength-len(suffix)]
+	}
+	return sanitized + suffix
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+)
+
+// newMockServer returns the Server of a type backed by sqlmock, which
+// matches the statements as they are written.
+func newMockServer(t *testing.T, databaseType cloudshipv1beta1.DatabaseType) (Server, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewServer(databaseType, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		mock.ExpectClose()
+		if err := server.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	return server, mock
+}
+
+func TestName(t *testing.T) {
+	for _, tc := range []struct {
+		service, database, expected string
+	}{
+		{"orders", "main", "orders_main"},
+		{"order-api", "main", "order_api_main_adfaf1ae"},
+		{"order", "api-main", "order_api_main_0b0994ce"},
+		{"a-very-long-service-name", "reports", "a_very_long_service_nam_8e20d41a"},
+	} {
+		name := Name(tc.service, tc.database)
+		if len(name) > maxNameLength {
+			t.Errorf("name %s of database %s of service %s is longer than %d", name, tc.database, tc.service, maxNameLength)
+		}
+		if name != tc.expected {
+			t.Errorf("expected database %s of service %s to be named %s, got %s", tc.database, tc.service, tc.expected, name)
+		}
+	}
+}
+
+func TestNewServerUnsupported(t *testing.T) {
+	if Supported("Oracle") {
+		t.Fatal("expected Oracle databases not to be shared")
+	}
+	if _, err := NewServer("Oracle", nil); err == nil {
+		t.Fatal("expected an error for Oracle databases")
+	}
+}
+
+func TestPostgreSQLEnsureDatabase(t *testing.T) {
+	server, mock := newMockServer(t, cloudshipv1beta1.DatabaseTypePostgreSQL)
+	mock.ExpectQuery("SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)").
+		WithArgs("orders_main").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(`CREATE ROLE "orders_main" LOGIN PASSWORD 'pa''ss'`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)").
+		WithArgs("orders_main").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(`CREATE DATABASE "orders_main" OWNER "orders_main"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`REVOKE ALL ON DATABASE "orders_main" FROM PUBLIC`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := server.EnsureDatabase(context.Background(), "orders_main", "orders_main", "pa'ss"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPostgreSQLEnsureExistingDatabase(t *testing.T) {
+	server, mock := newMockServer(t, cloudshipv1beta1.DatabaseTypePostgreSQL)
+	mock.ExpectQuery("SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)").
+		WithArgs("orders_main").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec(`ALTER ROLE "orders_main" WITH LOGIN PASSWORD 'secret'`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)").
+		WithArgs("orders_main").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec(`REVOKE ALL ON DATABASE "orders_main" FROM PUBLIC`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := server.EnsureDatabase(context.Background(), "orders_main", "orders_main", "secret"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPostgreSQLDropDatabase(t *testing.T) {
+	server, mock := newMockServer(t, cloudshipv1beta1.DatabaseTypePostgreSQL)
+	mock.ExpectExec("SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = $1 AND pid <> pg_backend_pid()").
+		WithArgs("orders_main").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DROP DATABASE IF EXISTS "orders_main"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DROP ROLE IF EXISTS "orders_main"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := server.DropDatabase(context.Background(), "orders_main", "orders_main"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMySQLEnsureDatabase(t *testing.T) {
+	server, mock := newMockServer(t, cloudshipv1beta1.DatabaseTypeMySQL)
+	mock.ExpectExec("CREATE DATABASE IF NOT EXISTS `orders_main`").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`CREATE USER IF NOT EXISTS 'orders_main'@'%' IDENTIFIED BY 'pa''ss\\'`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER USER 'orders_main'@'%' IDENTIFIED BY 'pa''ss\\'`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("GRANT ALL PRIVILEGES ON `orders_main`.* TO 'orders_main'@'%'").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := server.EnsureDatabase(context.Background(), "orders_main", "orders_main", `pa'ss\`); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMySQLEnsureDatabaseFailure(t *testing.T) {
+	server, mock := newMockServer(t, cloudshipv1beta1.DatabaseTypeMySQL)
+	mock.ExpectExec("CREATE DATABASE IF NOT EXISTS `orders_main`").
+		WillReturnError(errors.New("access denied"))
+
+	if err := server.EnsureDatabase(context.Background(), "orders_main", "orders_main", "secret"); err == nil {
+		t.Fatal("expected the failure of the server to be returned")
+	}
+}
+
+func TestMySQLDropDatabase(t *testing.T) {
+	server, mock := newMockServer(t, cloudshipv1beta1.DatabaseTypeMySQL)
+	mock.ExpectExec("DROP DATABASE IF EXISTS `orders_main`").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DROP USER IF EXISTS 'orders_main'@'%'").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := server.DropDatabase(context.Background(), "orders_main", "orders_main"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	mysqlDriver string = "mysql"
+	// mysqlUserHost is the host part of the accounts of the users, which
+	// connect from any pod
+	mysqlUserHost string = "%"
+)
+
+// mysqlDataSourceName returns the DSN the driver connects with.
+func mysqlDataSourceName(conn Connection) string {
+	config := mysql.NewConfig()
+	config.User = conn.Username
+	config.Passwd = conn.Password
+	config.Net = "tcp"
+	config.Addr = net.JoinHostPort(conn.Hostname, conn.Port)
+	if conn.TLS {
+		config.TLSConfig = "skip-verify"
+	}
+	return config.FormatDSN()
+}
+
+// mysqlServer creates the databases and grants their user every privilege on
+// them, and only on them.
+type mysqlServer struct {
+	db *sql.DB
+}
+
+func (s *mysqlServer) EnsureDatabase(ctx context.Context, database, username, password string) error {
+	// account names and passwords cannot be parameters of the statements
+	account := mysqlAccount(username)
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", mysqlIdentifier(database))); err != nil {
+		return fmt.Errorf("failed to create database %s: %w", database, err)
+	}
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf("CREATE USER IF NOT EXISTS %s IDENTIFIED BY %s", account, mysqlLiteral(password))); err != nil {
+		return fmt.Errorf("failed to create user %s: %w", username, err)
+	}
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf("ALTER USER %s IDENTIFIED BY %s", account, mysqlLiteral(password))); err != nil {
+		return fmt.Errorf("failed to set up user %s: %w", username, err)
+	}
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf("GRANT ALL PRIVILEGES ON %s.* TO %s", mysqlIdentifier(database), account)); err != nil {
+		return fmt.Errorf("failed to grant database %s to user %s: %w", database, username, err)
+	}
+	return nil
+}
+
+func (s *mysqlServer) DropDatabase(ctx context.Context, database, username string) error {
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf("DROP DATABASE IF EXISTS %s", mysqlIdentifier(database))); err != nil {
+		return fmt.Errorf("failed to drop database %s: %w", database, err)
+	}
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf("DROP USER IF EXISTS %s", mysqlAccount(username))); err != nil {
+		return fmt.Errorf("failed to drop user %s: %w", username, err)
+	}
+	return nil
+}
+
+func (s *mysqlServer) Close() error {
+	return s.db.Close()
+}
+
+// mysqlIdentifier quotes a database name.
+func mysqlIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// mysqlLiteral quotes a string literal.
+func mysqlLiteral(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", "''").Replace(value) + "'"
+}
+
+// mysqlAccount returns the quoted account of a user.
+func mysqlAccount(username string) string {
+	return mysqlLiteral(username) + "@" + mysqlLiteral(mysqlUserHost)
+}
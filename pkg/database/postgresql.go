@@ -0,0 +1,103 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/lib/pq"
+)
+
+const (
+	postgresqlDriver string = "postgres"
+	// postgresqlAdminDatabase is the database the administrator connects to
+	postgresqlAdminDatabase string = "postgres"
+)
+
+// postgresqlDataSourceName returns the URL the driver connects with.
+func postgresqlDataSourceName(conn Connection) string {
+	sslMode := "disable"
+	if conn.TLS {
+		sslMode = "require"
+	}
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(conn.Username, conn.Password),
+		Host:     net.JoinHostPort(conn.Hostname, conn.Port),
+		Path:     "/" + postgresqlAdminDatabase,
+		RawQuery: url.Values{"sslmode": []string{sslMode}}.Encode(),
+	}
+	return u.String()
+}
+
+// postgresqlServer creates the databases as owned by their user, and revokes
+// the privileges every user has on them so the other users cannot connect.
+type postgresqlServer struct {
+	db *sql.DB
+}
+
+func (s *postgresqlServer) EnsureDatabase(ctx context.Context, database, username, password string) error {
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)", username).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to look up user %s: %w", username, err)
+	}
+	// the password cannot be a parameter of the statements
+	statement := "CREATE ROLE %s LOGIN PASSWORD %s"
+	if exists {
+		statement = "ALTER ROLE %s WITH LOGIN PASSWORD %s"
+	}
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf(statement, pq.QuoteIdentifier(username), pq.QuoteLiteral(password))); err != nil {
+		return fmt.Errorf("failed to set up user %s: %w", username, err)
+	}
+
+	if err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)", database).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to look up database %s: %w", database, err)
+	}
+	if !exists {
+		if _, err := s.db.ExecContext(ctx, fmt.Sprintf("CREATE DATABASE %s OWNER %s",
+			pq.QuoteIdentifier(database), pq.QuoteIdentifier(username))); err != nil {
+			return fmt.Errorf("failed to create database %s: %w", database, err)
+		}
+	}
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf("REVOKE ALL ON DATABASE %s FROM PUBLIC", pq.QuoteIdentifier(database))); err != nil {
+		return fmt.Errorf("failed to restrict database %s to its user: %w", database, err)
+	}
+	return nil
+}
+
+func (s *postgresqlServer) DropDatabase(ctx context.Context, database, username string) error {
+	// a database cannot be dropped while there are connections to it
+	if _, err := s.db.ExecContext(ctx,
+		"SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = $1 AND pid <> pg_backend_pid()", database); err != nil {
+		return fmt.Errorf("failed to close the connections to database %s: %w", database, err)
+	}
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf("DROP DATABASE IF EXISTS %s", pq.QuoteIdentifier(database))); err != nil {
+		return fmt.Errorf("failed to drop database %s: %w", database, err)
+	}
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf("DROP ROLE IF EXISTS %s", pq.QuoteIdentifier(username))); err != nil {
+		return fmt.Errorf("failed to drop user %s: %w", username, err)
+	}
+	return nil
+}
+
+func (s *postgresqlServer) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chart
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const (
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	// helmChartContentMediaType is the media type of the layer holding the
+	// chart archive.
+	helmChartContentMediaType = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	// helmLegacyChartContentMediaType is the layer media type used by the
+	// experimental OCI support of Helm 3.0 to 3.6.
+	helmLegacyChartContentMediaType = "application/tar+gzip"
+)
+
+// ociFetcher downloads charts stored as OCI artifacts in a registry. The
+// chart <name> is pulled from the repository <path>/<name> with the chart
+// version as tag.
+type ociFetcher struct {
+	url        *url.URL
+	httpClient *http.Client
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+}
+
+type ociManifest struct {
+	Layers []ociDescriptor `json:"layers"`
+}
+
+func newOCIFetcher(u *url.URL, httpClient *http.Client) *ociFetcher {
+	return &ociFetcher{url: u, httpClient: httpClient}
+}
+
+func (f *ociFetcher) String() string {
+	return redactedURL(f.url)
+}
+
+func (f *ociFetcher) Fetch(ctx context.Context, name, version string) ([]byte, error) {
+	repository := strings.TrimPrefix(path.Join(f.url.Path, name), "/")
+	// OCI tags do not allow "+", Helm replaces it with "_"
+	tag := strings.ReplaceAll(version, "+", "_")
+
+	data, err := f.get(ctx, repository, fmt.Sprintf("manifests/%s", tag), ociManifestMediaType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest: %w", err)
+	}
+	manifest := &ociManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	var layer *ociDescriptor
+	for i, l := range manifest.Layers {
+		if l.MediaType == helmChartContentMediaType || l.MediaType == helmLegacyChartContentMediaType {
+			layer = &manifest.Layers[i]
+			break
+		}
+	}
+	if layer == nil {
+		return nil, fmt.Errorf("manifest of %s:%s has no chart content layer", repository, tag)
+	}
+
+	archive, err := f.get(ctx, repository, fmt.Sprintf("blobs/%s", layer.Digest), "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chart content: %w", err)
+	}
+	sum := sha256.Sum256(archive)
+	if digest := "sha256:" + hex.EncodeToString(sum[:]); digest != layer.Digest {
+		return nil, fmt.Errorf("chart digest mismatch: expected %s, got %s", layer.Digest, digest)
+	}
+	return archive, nil
+}
+
+// get performs a GET request against the registry API. When the registry
+// answers with a bearer token challenge, a token is requested and the request
+// is retried with it.
+func (f *ociFetcher) get(ctx context.Context, repository, resource, accept string) ([]byte, error) {
+	endpoint := fmt.Sprintf("https://%s/v2/%s/%s", f.url.Host, repository, resource)
+	resp, err := f.do(ctx, endpoint, accept, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		token, err := f.token(ctx, challenge)
+		if err != nil {
+			return nil, err
+		}
+		if resp, err = f.do(ctx, endpoint, accept, token); err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: unexpected status %s", endpoint, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (f *ociFetcher) do(ctx context.Context, endpoint, accept, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if f.url.User != nil {
+		password, _ := f.url.User.Password()
+		req.SetBasicAuth(f.url.User.Username(), password)
+	}
+	return f.httpClient.Do(req)
+}
+
+// token requests a bearer token for the challenge sent by the registry, as
+// described by the Docker registry token authentication specification.
+func (f *ociFetcher) token(ctx context.Context, challenge string) (string, error) {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return "", fmt.Errorf("unauthorized: unsupported authentication challenge %q", challenge)
+	}
+	params := parseChallenge(strings.TrimPrefix(challenge, "Bearer "))
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("unauthorized: invalid token realm %q", params["realm"])
+	}
+	query := realm.Query()
+	for _, key := range []string{"service", "scope"} {
+		if v, ok := params[key]; ok {
+			query.Set(key, v)
+		}
+	}
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if f.url.User != nil {
+		password, _ := f.url.User.Password()
+		req.SetBasicAuth(f.url.User.Username(), password)
+	}
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get registry token: unexpected status %s", resp.Status)
+	}
+	var tokenResponse struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return "", fmt.Errorf("failed to parse registry token: %w", err)
+	}
+	if tokenResponse.Token != "" {
+		return tokenResponse.Token, nil
+	}
+	return tokenResponse.AccessToken, nil
+}
+
+// parseChallenge parses the comma separated key="value" parameters of an
+// authentication challenge. Commas inside quoted values are kept.
+func parseChallenge(s string) map[string]string {
+	params := map[string]string{}
+	var parts []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	parts = append(parts, current.String())
+
+	for _, part := range parts {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		params[kv[0]] = kv[1]
+	}
+	return params
+}
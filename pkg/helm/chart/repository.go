@@ -0,0 +1,111 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chart
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+)
+
+// repositoryFetcher downloads charts from a Helm chart repository, the
+// location of every chart is resolved through the repository index.yaml.
+type repositoryFetcher struct {
+	url        *url.URL
+	httpClient *http.Client
+}
+
+func newRepositoryFetcher(u *url.URL, httpClient *http.Client) *repositoryFetcher {
+	return &repositoryFetcher{url: u, httpClient: httpClient}
+}
+
+func (f *repositoryFetcher) String() string {
+	return redactedURL(f.url)
+}
+
+func (f *repositoryFetcher) Fetch(ctx context.Context, name, version string) ([]byte, error) {
+	base := strings.TrimSuffix(redactedURL(f.url), "/")
+	data, err := f.get(ctx, base+"/index.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to download repository index: %w", err)
+	}
+	index := &repo.IndexFile{}
+	if err := yaml.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("failed to parse repository index: %w", err)
+	}
+	index.SortEntries()
+
+	cv, err := index.Get(name, version)
+	if err != nil {
+		return nil, err
+	}
+	if len(cv.URLs) == 0 {
+		return nil, fmt.Errorf("chart %s-%s has no downloadable URLs", name, version)
+	}
+	chartURL, err := repo.ResolveReferenceURL(base, cv.URLs[0])
+	if err != nil {
+		return nil, err
+	}
+	archive, err := f.get(ctx, chartURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download chart: %w", err)
+	}
+	if cv.Digest != "" {
+		sum := sha256.Sum256(archive)
+		if digest := hex.EncodeToString(sum[:]); digest != cv.Digest {
+			return nil, fmt.Errorf("chart digest mismatch: expected %s, got %s", cv.Digest, digest)
+		}
+	}
+	return archive, nil
+}
+
+func (f *repositoryFetcher) get(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	// the credentials of the repository are not sent to the hosts its index
+	// points charts at
+	if f.url.User != nil && req.URL.Scheme == f.url.Scheme && req.URL.Host == f.url.Host {
+		password, _ := f.url.User.Password()
+		req.SetBasicAuth(f.url.User.Username(), password)
+	}
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: unexpected status %s", req.URL.Redacted(), resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// redactedURL returns the URL without user information.
+func redactedURL(u *url.URL) string {
+	c := *u
+	c.User = nil
+	return c.String()
+}
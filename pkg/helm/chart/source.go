@@ -0,0 +1,187 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chart
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	helmchart "helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// Source loads Helm charts by name and version.
+type Source interface {
+	// Load returns the chart with the given name and version.
+	Load(ctx context.Context, name, version string) (*helmchart.Chart, error)
+}
+
+// fetcher downloads chart archives from a remote location.
+type fetcher interface {
+	// Fetch returns the archive of the chart with the given name and version.
+	Fetch(ctx context.Context, name, version string) ([]byte, error)
+	// String identifies the remote location, it is used as cache key.
+	String() string
+}
+
+// Option configures a Source created with NewSource.
+type Option func(*options)
+
+type options struct {
+	cacheDir   string
+	httpClient *http.Client
+}
+
+// WithCacheDir sets the directory where remote charts are cached.
+func WithCacheDir(dir string) Option {
+	return func(o *options) {
+		o.cacheDir = dir
+	}
+}
+
+// WithHTTPClient sets the client used to download remote charts.
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = c
+	}
+}
+
+// NewSource returns the Source for a chart location. The location is one of:
+//
+//   - a local directory, as a path or a file:// URL, holding chart archives
+//     named <name>-<version>.tgz or unpacked charts named <name>
+//   - an http:// or https:// URL of a chart repository with an index.yaml
+//   - an oci:// URL of a registry repository holding charts as OCI artifacts
+//
+// Charts from remote locations are cached on disk.
+func NewSource(location string, opts ...Option) (Source, error) {
+	o := &options{
+		cacheDir:   filepath.Join(os.TempDir(), "cloudship-charts"),
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if location == "" {
+		return nil, fmt.Errorf("chart location is empty")
+	}
+	if !strings.Contains(location, "://") {
+		return NewLocalSource(location), nil
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chart location %q: %w", location, err)
+	}
+	var f fetcher
+	switch u.Scheme {
+	case "file":
+		return NewLocalSource(u.Path), nil
+	case "http", "https":
+		f = newRepositoryFetcher(u, o.httpClient)
+	case "oci":
+		f = newOCIFetcher(u, o.httpClient)
+	default:
+		return nil, fmt.Errorf("unsupported chart location scheme %q", u.Scheme)
+	}
+	return &cachedSource{fetcher: f, dir: o.cacheDir}, nil
+}
+
+// localSource loads charts from a local directory.
+type localSource struct {
+	dir string
+}
+
+// NewLocalSource returns a Source that loads charts from dir. A chart is
+// loaded from the archive <dir>/<name>-<version>.tgz if it exists, otherwise
+// from the unpacked chart directory <dir>/<name>.
+func NewLocalSource(dir string) Source {
+	return &localSource{dir: dir}
+}
+
+func (s *localSource) Load(_ context.Context, name, version string) (*helmchart.Chart, error) {
+	archive := filepath.Join(s.dir, fmt.Sprintf("%s-%s.tgz", name, version))
+	if _, err := os.Stat(archive); err == nil {
+		return loader.LoadFile(archive)
+	}
+
+	chartDir := filepath.Join(s.dir, name)
+	if fi, err := os.Stat(chartDir); err != nil || !fi.IsDir() {
+		return nil, fmt.Errorf("chart %s-%s not found in %s", name, version, s.dir)
+	}
+	c, err := loader.LoadDir(chartDir)
+	if err != nil {
+		return nil, err
+	}
+	if version != "" && c.Metadata.Version != version {
+		return nil, fmt.Errorf("chart %s in %s has version %s, expected %s",
+			name, s.dir, c.Metadata.Version, version)
+	}
+	return c, nil
+}
+
+// cachedSource loads charts from a remote location, keeping a copy of every
+// downloaded archive on disk.
+type cachedSource struct {
+	fetcher fetcher
+	dir     string
+}
+
+func (s *cachedSource) Load(ctx context.Context, name, version string) (*helmchart.Chart, error) {
+	path := s.cachePath(name, version)
+	if _, err := os.Stat(path); err == nil {
+		return loader.LoadFile(path)
+	}
+
+	data, err := s.fetcher.Fetch(ctx, name, version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch chart %s-%s from %s: %w", name, version, s.fetcher, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create chart cache: %w", err)
+	}
+	// write to a temporary file first, so a partially written archive is
+	// never picked up from the cache
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".download-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to write chart cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to write chart cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write chart cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, fmt.Errorf("failed to write chart cache: %w", err)
+	}
+	return loader.LoadFile(path)
+}
+
+func (s *cachedSource) cachePath(name, version string) string {
+	location := strings.NewReplacer("://", "_", "/", "_", ":", "_", "@", "_").Replace(s.fetcher.String())
+	return filepath.Join(s.dir, location, fmt.Sprintf("%s-%s.tgz", name, version))
+}
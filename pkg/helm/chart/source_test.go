@@ -0,0 +1,289 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chart
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	helmchart "helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	testChartName    = "memcached"
+	testChartVersion = "5.8.0"
+)
+
+func testChart() *helmchart.Chart {
+	return &helmchart.Chart{
+		Metadata: &helmchart.Metadata{
+			APIVersion: helmchart.APIVersionV2,
+			Name:       testChartName,
+			Version:    testChartVersion,
+		},
+		Templates: []*helmchart.File{
+			{Name: "templates/service.yaml", Data: []byte("kind: Service\n")},
+		},
+	}
+}
+
+// testArchive returns the packaged test chart and its sha256 digest.
+func testArchive(t *testing.T) ([]byte, string) {
+	dir := t.TempDir()
+	path, err := chartutil.Save(testChart(), dir)
+	if err != nil {
+		t.Fatalf("failed to package chart: %v", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read chart: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	return data, hex.EncodeToString(sum[:])
+}
+
+func assertChart(t *testing.T, c *helmchart.Chart, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Name() != testChartName || c.Metadata.Version != testChartVersion {
+		t.Fatalf("loaded chart %s-%s, expected %s-%s", c.Name(), c.Metadata.Version, testChartName, testChartVersion)
+	}
+}
+
+func TestLocalSourceTarball(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := chartutil.Save(testChart(), dir); err != nil {
+		t.Fatal(err)
+	}
+	source, err := NewSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := source.Load(context.Background(), testChartName, testChartVersion)
+	assertChart(t, c, err)
+}
+
+func TestLocalSourceDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := chartutil.SaveDir(testChart(), dir); err != nil {
+		t.Fatal(err)
+	}
+	source, err := NewSource("file://" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := source.Load(context.Background(), testChartName, testChartVersion)
+	assertChart(t, c, err)
+
+	if _, err := source.Load(context.Background(), testChartName, "1.0.0"); err == nil {
+		t.Fatal("expected an error loading a chart directory with another version")
+	}
+}
+
+func TestRepositorySource(t *testing.T) {
+	archive, digest := testArchive(t)
+	index := repo.NewIndexFile()
+	index.Add(testChart().Metadata, fmt.Sprintf("%s-%s.tgz", testChartName, testChartVersion), "", digest)
+	indexYAML, err := yaml.Marshal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/bitnami/index.yaml":
+			w.Write(indexYAML)
+		case fmt.Sprintf("/bitnami/%s-%s.tgz", testChartName, testChartVersion):
+			w.Write(archive)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	source, err := NewSource(server.URL+"/bitnami", WithCacheDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := source.Load(context.Background(), testChartName, testChartVersion)
+	assertChart(t, c, err)
+
+	// the second load is served from the cache
+	c, err = source.Load(context.Background(), testChartName, testChartVersion)
+	assertChart(t, c, err)
+	if requests != 2 {
+		t.Fatalf("expected 2 requests to the repository, got %d", requests)
+	}
+
+	if _, err := source.Load(context.Background(), testChartName, "1.0.0"); err == nil {
+		t.Fatal("expected an error loading a chart version missing from the index")
+	}
+}
+
+func TestRepositorySourceCredentials(t *testing.T) {
+	archive, digest := testArchive(t)
+
+	var chartAuth bool
+	charts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _, chartAuth = r.BasicAuth()
+		w.Write(archive)
+	}))
+	defer charts.Close()
+
+	index := repo.NewIndexFile()
+	index.Add(testChart().Metadata, fmt.Sprintf("%s-%s.tgz", testChartName, testChartVersion), charts.URL, digest)
+	indexYAML, err := yaml.Marshal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write(indexYAML)
+	}))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.User = url.UserPassword("user", "secret")
+	source, err := NewSource(u.String(), WithCacheDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := source.Load(context.Background(), testChartName, testChartVersion)
+	assertChart(t, c, err)
+	if chartAuth {
+		t.Fatal("the credentials of the repository must not be sent to another host")
+	}
+}
+
+func TestRepositorySourceDigestMismatch(t *testing.T) {
+	archive, _ := testArchive(t)
+	index := repo.NewIndexFile()
+	index.Add(testChart().Metadata, fmt.Sprintf("%s-%s.tgz", testChartName, testChartVersion), "", "0000")
+	indexYAML, _ := yaml.Marshal(index)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "index.yaml") {
+			w.Write(indexYAML)
+			return
+		}
+		w.Write(archive)
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	source, _ := NewSource(server.URL, WithCacheDir(cacheDir))
+	if _, err := source.Load(context.Background(), testChartName, testChartVersion); err == nil {
+		t.Fatal("expected a digest mismatch error")
+	}
+	if entries, _ := ioutil.ReadDir(cacheDir); len(entries) != 0 {
+		t.Fatal("a chart with an invalid digest must not be cached")
+	}
+}
+
+func TestOCISource(t *testing.T) {
+	archive, digest := testArchive(t)
+	manifest, _ := json.Marshal(ociManifest{
+		Layers: []ociDescriptor{
+			{MediaType: helmChartContentMediaType, Digest: "sha256:" + digest},
+		},
+	})
+
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.URL.Query().Get("scope") != "repository:charts/memcached:pull" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`{"token":"secret"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+				`Bearer realm="%s/token",service="registry",scope="repository:charts/memcached:pull"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/charts/memcached/manifests/" + testChartVersion:
+			if r.Header.Get("Accept") != ociManifestMediaType {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", ociManifestMediaType)
+			w.Write(manifest)
+		case "/v2/charts/memcached/blobs/sha256:" + digest:
+			w.Write(archive)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	location := "oci://" + strings.TrimPrefix(server.URL, "https://") + "/charts"
+	source, err := NewSource(location, WithCacheDir(cacheDir), WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := source.Load(context.Background(), testChartName, testChartVersion)
+	assertChart(t, c, err)
+
+	// once cached the registry is no longer needed
+	server.Close()
+	c, err = source.Load(context.Background(), testChartName, testChartVersion)
+	assertChart(t, c, err)
+}
+
+func TestNewSourceUnsupportedScheme(t *testing.T) {
+	if _, err := NewSource("ftp://example.com/charts"); err == nil {
+		t.Fatal("expected an error for an unsupported scheme")
+	}
+	if _, err := NewSource(""); err == nil {
+		t.Fatal("expected an error for an empty location")
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	params := parseChallenge(`realm="https://auth.example.com/token",service="registry",scope="repository:a/b:pull,push"`)
+	if params["realm"] != "https://auth.example.com/token" || params["service"] != "registry" ||
+		params["scope"] != "repository:a/b:pull,push" {
+		t.Fatalf("unexpected challenge parameters: %v", params)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	crmanager "sigs.k8s.io/controller-runtime/pkg/manager"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+)
+
+// Catalog resolves the ManagerFactory for a backing service type. Offerings
+// declared with a BackingServiceClass take precedence over the built-in ones.
+type Catalog interface {
+	ManagerFactory(ctx context.Context, category cloudshipv1beta1.BackingServiceCategory, serviceType string) (ManagerFactory, error)
+}
+
+// releasePrefixes are the prefixes of the names of the releases of the
+// backing services of each category
+var releasePrefixes = map[cloudshipv1beta1.BackingServiceCategory]string{
+	cloudshipv1beta1.BackingServiceCategoryCache:       "cache",
+	cloudshipv1beta1.BackingServiceCategoryEventStream: "stream",
+	cloudshipv1beta1.BackingServiceCategoryDatabase:    "db",
+}
+
+// InstanceReleaseName returns the name of the release of the backing service
+// of a category named instance, e.g. cache-sessions-redis for the Redis cache
+// sessions. The type is part of the name, so a backing service replaced by one
+// of another type under the same name gets a release of its own.
+func InstanceReleaseName(category cloudshipv1beta1.BackingServiceCategory, instance, serviceType string) string {
+	prefix, ok := releasePrefixes[category]
+	if !ok {
+		prefix = strings.ToLower(string(category))
+	}
+	return prefix + "-" + instance + "-" + strings.ToLower(serviceType)
+}
+
+// DatabaseReleaseName returns the name of the release of the database named
+// database of a service, e.g. db-orders-main-postgresql for the PostgreSQL
+// database main of the service orders.
+func DatabaseReleaseName(service, database, databaseType string) string {
+	return InstanceReleaseName(cloudshipv1beta1.BackingServiceCategoryDatabase, service+"-"+database, databaseType)
+}
+
+// CacheReleaseName returns the name of the release of a cache of an
+// application, the one it names or else the one derived from it.
+func CacheReleaseName(cache *cloudshipv1beta1.CacheSpec) string {
+	if cache.ReleaseName != "" {
+		return cache.ReleaseName
+	}
+	return InstanceReleaseName(cloudshipv1beta1.BackingServiceCategoryCache, cache.Name, string(cache.Type))
+}
+
+// EventStreamReleaseName returns the name of the release of an event stream
+// of an application, the one it names or else the one derived from it.
+func EventStreamReleaseName(eventStream *cloudshipv1beta1.EventStreamSpec) string {
+	if eventStream.ReleaseName != "" {
+		return eventStream.ReleaseName
+	}
+	return InstanceReleaseName(cloudshipv1beta1.BackingServiceCategoryEventStream, eventStream.Name, string(eventStream.Type))
+}
+
+// ServiceDatabaseReleaseName returns the name of the release of a dedicated
+// database of a service, the one it names or else the one derived from it.
+func ServiceDatabaseReleaseName(service string, database *cloudshipv1beta1.DatabaseSpec) string {
+	if database.ReleaseName != "" {
+		return database.ReleaseName
+	}
+	return DatabaseReleaseName(service, database.Name, string(database.Type))
+}
+
+// SharedDatabaseReleaseName returns the name of the release of the database
+// server of a type shared by the services of an application, e.g.
+// db-shared-postgresql for PostgreSQL.
+func SharedDatabaseReleaseName(databaseType string) string {
+	return InstanceReleaseName(cloudshipv1beta1.BackingServiceCategoryDatabase, "shared", databaseType)
+}
+
+type catalogKey struct {
+	category    cloudshipv1beta1.BackingServiceCategory
+	serviceType string
+}
+
+type catalog struct {
+	mgr      crmanager.Manager
+	builtins map[catalogKey]ManagerFactory
+}
+
+// NewCatalog returns a Catalog with the built-in backing services registered.
+func NewCatalog(mgr crmanager.Manager) Catalog {
+	return &catalog{
+		mgr: mgr,
+		builtins: map[catalogKey]ManagerFactory{
+			{cloudshipv1beta1.BackingServiceCategoryCache, string(cloudshipv1beta1.CacheTypeMemcached)}:            NewMemecachedManagerFactory(mgr),
+			{cloudshipv1beta1.BackingServiceCategoryCache, string(cloudshipv1beta1.CacheTypeRedis)}:                NewRedisManagerFactory(mgr),
+			{cloudshipv1beta1.BackingServiceCategoryEventStream, string(cloudshipv1beta1.EventStreamTypeRabbitMQ)}: NewRabbitMQManagerFactory(mgr),
+			{cloudshipv1beta1.BackingServiceCategoryEventStream, string(cloudshipv1beta1.EventStreamTypeKafka)}:    NewKafkaManagerFactory(mgr),
+			{cloudshipv1beta1.BackingServiceCategoryDatabase, string(cloudshipv1beta1.DatabaseTypeMySQL)}:          NewMySQLManagerFactory(mgr),
+			{cloudshipv1beta1.BackingServiceCategoryDatabase, string(cloudshipv1beta1.DatabaseTypePostgreSQL)}:     NewPostgreSQLManagerFactory(mgr),
+		},
+	}
+}
+
+// ManagerFactory returns the ManagerFactory for the backing service type of
+// the category.
+func (c *catalog) ManagerFactory(ctx context.Context, category cloudshipv1beta1.BackingServiceCategory, serviceType string) (ManagerFactory, error) {
+	var classes cloudshipv1beta1.BackingServiceClassList
+	if err := c.mgr.GetClient().List(ctx, &classes); err != nil {
+		return nil, fmt.Errorf("failed to list backing service classes: %w", err)
+	}
+
+	var matches []cloudshipv1beta1.BackingServiceClass
+	for _, class := range classes.Items {
+		if class.Spec.Category == category && class.Spec.Type == serviceType {
+			matches = append(matches, class)
+		}
+	}
+	switch len(matches) {
+	case 0:
+	case 1:
+		return NewClassManagerFactory(c.mgr, &matches[0])
+	default:
+		return nil, fmt.Errorf("found %d backing service classes for %s %v", len(matches), category, serviceType)
+	}
+
+	if factory, ok := c.builtins[catalogKey{category, serviceType}]; ok {
+		return factory, nil
+	}
+	return nil, fmt.Errorf("No Manager Factory for %v", serviceType)
+}
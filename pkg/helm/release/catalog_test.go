@@ -0,0 +1,50 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"testing"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+)
+
+func TestReleaseNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		actual   string
+		expected string
+	}{
+		{"cache", InstanceReleaseName(cloudshipv1beta1.BackingServiceCategoryCache, "sessions", "Redis"), "cache-sessions-redis"},
+		{"replaced cache", InstanceReleaseName(cloudshipv1beta1.BackingServiceCategoryCache, "sessions", "Memcached"), "cache-sessions-memcached"},
+		{"event stream", InstanceReleaseName(cloudshipv1beta1.BackingServiceCategoryEventStream, "events", "Kafka"), "stream-events-kafka"},
+		{"class category", InstanceReleaseName(cloudshipv1beta1.BackingServiceCategoryObjectStorage, "uploads", "MinIO"), "objectstorage-uploads-minio"},
+		{"database", DatabaseReleaseName("orders", "main", "PostgreSQL"), "db-orders-main-postgresql"},
+		{"shared database server", SharedDatabaseReleaseName("MySQL"), "db-shared-mysql"},
+		{"derived cache release", CacheReleaseName(&cloudshipv1beta1.CacheSpec{Name: "sessions", Type: "Redis"}), "cache-sessions-redis"},
+		{"named cache release", CacheReleaseName(&cloudshipv1beta1.CacheSpec{Name: "redis", Type: "Redis", ReleaseName: "cache-redis"}), "cache-redis"},
+		{"named event stream release", EventStreamReleaseName(&cloudshipv1beta1.EventStreamSpec{Name: "kafka", Type: "Kafka", ReleaseName: "stream-kafka"}), "stream-kafka"},
+		{"derived database release", ServiceDatabaseReleaseName("orders", &cloudshipv1beta1.DatabaseSpec{Name: "main", Type: "MySQL"}), "db-orders-main-mysql"},
+		{"named database release", ServiceDatabaseReleaseName("orders", &cloudshipv1beta1.DatabaseSpec{Name: "postgresql", Type: "PostgreSQL", ReleaseName: "db"}), "db"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.actual != tt.expected {
+				t.Fatalf("expected %s, got %s", tt.expected, tt.actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"helm.sh/helm/v3/pkg/cli"
+	crmanager "sigs.k8s.io/controller-runtime/pkg/manager"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+	"github.com/ToucanSoftware/cloudship-operator/pkg/helm/chart"
+)
+
+// classTemplateData is the data the templates of a BackingServiceClass are
+// rendered with.
+type classTemplateData struct {
+	Category    string
+	Type        string
+	ReleaseName string
+	Namespace   string
+}
+
+type classAction struct {
+	data     classTemplateData
+	values   map[string]interface{}
+	services ConnectionSpec
+	hostname *template.Template
+	port     *template.Template
+	username *template.Template
+	database *template.Template
+	url      *template.Template
+}
+
+func (e classAction) PreInstalacion() map[string]interface{} {
+	return e.values
+}
+
+// Connection renders the connection templates of the class. The hostname and
+// port are taken from the Services of the release when their templates are
+// empty.
+func (e classAction) Connection(rel RenderedRelease) (*cloudshipv1beta1.ConnectionDetails, error) {
+	data := e.data
+	data.ReleaseName = rel.Name
+	data.Namespace = rel.Namespace
+
+	details := &cloudshipv1beta1.ConnectionDetails{}
+	if e.hostname == nil || e.port == nil {
+		fromServices, err := e.services.ConnectionDetails(rel)
+		if err != nil {
+			return nil, err
+		}
+		details.Hostname = fromServices.Hostname
+		details.Port = fromServices.Port
+	}
+	for _, field := range []struct {
+		template *template.Template
+		value    *string
+	}{
+		{e.hostname, &details.Hostname},
+		{e.port, &details.Port},
+		{e.username, &details.Username},
+		{e.database, &details.Database},
+		{e.url, &details.URL},
+	} {
+		if field.template == nil {
+			continue
+		}
+		out, err := renderTemplate(field.template, data)
+		if err != nil {
+			return nil, err
+		}
+		*field.value = out
+	}
+	return details, nil
+}
+
+// CredentialKeys returns no keys, releases of a BackingServiceClass manage
+// their own credentials.
+func (e classAction) CredentialKeys() []string {
+	return nil
+}
+
+func (e classAction) CredentialValues(secretName string) map[string]interface{} {
+	return nil
+}
+
+func (e classAction) PasswordKey() string {
+	return ""
+}
+
+// NewClassManagerFactory returns a new Helm manager factory capable of
+// installing and uninstalling releases of the backing service declared by a
+// BackingServiceClass. Its releases are named by ForRelease after the backing
+// service they are installed for.
+func NewClassManagerFactory(mgr crmanager.Manager, class *cloudshipv1beta1.BackingServiceClass) (ManagerFactory, error) {
+	spec := class.Spec
+	data := classTemplateData{
+		Category:    string(spec.Category),
+		Type:        spec.Type,
+		ReleaseName: strings.ToLower(string(spec.Category)) + "-" + strings.ToLower(spec.Type),
+	}
+
+	values := map[string]interface{}{}
+	if spec.Values != nil && len(spec.Values.Raw) > 0 {
+		if err := json.Unmarshal(spec.Values.Raw, &values); err != nil {
+			return nil, fmt.Errorf("invalid values in backing service class %s: %w", class.GetName(), err)
+		}
+	}
+
+	if spec.Connection.ServicePort == "" && (spec.Connection.Hostname == "" || spec.Connection.Port == "") {
+		return nil, fmt.Errorf("backing service class %s sets neither a service port nor a hostname and port", class.GetName())
+	}
+	action := classAction{
+		data:     data,
+		values:   values,
+		services: ConnectionSpec{PortName: spec.Connection.ServicePort},
+	}
+	for _, field := range []struct {
+		name     string
+		text     string
+		template **template.Template
+	}{
+		{"hostname", spec.Connection.Hostname, &action.hostname},
+		{"port", spec.Connection.Port, &action.port},
+		{"username", spec.Connection.Username, &action.username},
+		{"database", spec.Connection.Database, &action.database},
+		{"url", spec.Connection.URL, &action.url},
+	} {
+		if field.text == "" {
+			continue
+		}
+		t, err := parseClassTemplate(field.name, field.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid connection %s in backing service class %s: %w", field.name, class.GetName(), err)
+		}
+		if _, err := renderTemplate(t, data); err != nil {
+			return nil, fmt.Errorf("invalid connection %s in backing service class %s: %w", field.name, class.GetName(), err)
+		}
+		*field.template = t
+	}
+
+	var chartSource chart.Source
+	if spec.Chart.Source != "" {
+		var err error
+		if chartSource, err = chart.NewSource(spec.Chart.Source, chartSourceOptions()...); err != nil {
+			return nil, fmt.Errorf("invalid chart source in backing service class %s: %w", class.GetName(), err)
+		}
+	}
+
+	return &managerFactory{
+		mgr:          mgr,
+		chartName:    spec.Chart.Name,
+		chartVersion: spec.Chart.Version,
+		chartSource:  chartSource,
+		values:       values,
+		releaseName:  data.ReleaseName,
+		settings:     cli.New(),
+		action:       action,
+	}, nil
+}
+
+func parseClassTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"lower": strings.ToLower}).
+		Parse(text)
+}
+
+func renderTemplate(t *template.Template, data classTemplateData) (string, error) {
+	var out bytes.Buffer
+	if err := t.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+)
+
+func testClass(category cloudshipv1beta1.BackingServiceCategory, serviceType string,
+	connection cloudshipv1beta1.ConnectionMapping) *cloudshipv1beta1.BackingServiceClass {
+	return &cloudshipv1beta1.BackingServiceClass{
+		ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(serviceType)},
+		Spec: cloudshipv1beta1.BackingServiceClassSpec{
+			Category:   category,
+			Type:       serviceType,
+			Chart:      cloudshipv1beta1.ChartReference{Name: strings.ToLower(serviceType), Version: "1.0.0"},
+			Values:     &runtime.RawExtension{Raw: []byte(`{"replicas":1}`)},
+			Connection: connection,
+		},
+	}
+}
+
+func TestClassManagerFactory(t *testing.T) {
+	tests := []struct {
+		name    string
+		class   *cloudshipv1beta1.BackingServiceClass
+		release string
+		details cloudshipv1beta1.ConnectionDetails
+	}{
+		{
+			name: "cache",
+			class: testClass(cloudshipv1beta1.BackingServiceCategoryCache, "KeyDB", cloudshipv1beta1.ConnectionMapping{
+				ServicePort: "keydb",
+				URL:         "redis://{{ .ReleaseName }}.{{ .Namespace }}:6379",
+			}),
+			release: "cache-sessions-keydb",
+			details: cloudshipv1beta1.ConnectionDetails{
+				Hostname: "cache-sessions-keydb.shop.svc.cluster.local",
+				Port:     "6379",
+				URL:      "redis://cache-sessions-keydb.shop:6379",
+			},
+		},
+		{
+			name: "event stream",
+			class: testClass(cloudshipv1beta1.BackingServiceCategoryEventStream, "NATS", cloudshipv1beta1.ConnectionMapping{
+				Hostname: "{{ .ReleaseName }}-client.{{ .Namespace }}.svc",
+				Port:     "4222",
+				URL:      "nats://{{ .ReleaseName }}-client.{{ .Namespace }}.svc:4222",
+			}),
+			release: "stream-events-nats",
+			details: cloudshipv1beta1.ConnectionDetails{
+				Hostname: "stream-events-nats-client.shop.svc",
+				Port:     "4222",
+				URL:      "nats://stream-events-nats-client.shop.svc:4222",
+			},
+		},
+		{
+			name: "database",
+			class: testClass(cloudshipv1beta1.BackingServiceCategoryDatabase, "CockroachDB", cloudshipv1beta1.ConnectionMapping{
+				ServicePort: "grpc",
+				Username:    "root",
+				Database:    "{{ lower .Type }}",
+				URL:         "postgresql://root@{{ .ReleaseName }}-public:26257/{{ lower .Type }}",
+			}),
+			release: "db-web-main-cockroachdb",
+			details: cloudshipv1beta1.ConnectionDetails{
+				Hostname: "db-web-main-cockroachdb.shop.svc.cluster.local",
+				Port:     "26257",
+				Username: "root",
+				Database: "cockroachdb",
+				URL:      "postgresql://root@db-web-main-cockroachdb-public:26257/cockroachdb",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factory, err := NewClassManagerFactory(nil, tt.class)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := factory.(*managerFactory)
+			if f.chartName != tt.class.Spec.Chart.Name || f.chartVersion != "1.0.0" {
+				t.Errorf("expected chart %s-1.0.0, got %s-%s", tt.class.Spec.Chart.Name, f.chartName, f.chartVersion)
+			}
+			if expected := map[string]interface{}{"replicas": float64(1)}; !reflect.DeepEqual(f.values, expected) {
+				t.Errorf("expected values %v, got %v", expected, f.values)
+			}
+			defaultName := strings.ToLower(string(tt.class.Spec.Category) + "-" + tt.class.Spec.Type)
+			if name := factory.ReleaseName(); name != defaultName {
+				t.Errorf("expected release %s, got %s", defaultName, name)
+			}
+
+			named := factory.ForRelease(tt.release)
+			if name := named.ReleaseName(); name != tt.release {
+				t.Errorf("expected release %s, got %s", tt.release, name)
+			}
+			rel := RenderedRelease{
+				Name:      tt.release,
+				Namespace: "shop",
+				Services: []corev1.Service{testService(tt.release, "",
+					corev1.ServicePort{Name: "grpc", Port: 26257},
+					corev1.ServicePort{Name: "keydb", Port: 6379},
+				)},
+			}
+			details, err := named.(*managerFactory).action.Connection(rel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *details != tt.details {
+				t.Errorf("expected connection details %+v, got %+v", tt.details, *details)
+			}
+		})
+	}
+}
+
+func TestClassManagerFactoryErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		connection cloudshipv1beta1.ConnectionMapping
+		values     string
+		err        string
+	}{
+		{
+			name:       "no port",
+			connection: cloudshipv1beta1.ConnectionMapping{Hostname: "{{ .ReleaseName }}"},
+			err:        "sets neither a service port nor a hostname and port",
+		},
+		{
+			name:       "invalid template",
+			connection: cloudshipv1beta1.ConnectionMapping{ServicePort: "keydb", URL: "redis://{{ .ReleaseName"},
+			err:        "invalid connection url",
+		},
+		{
+			name:       "template failing to render",
+			connection: cloudshipv1beta1.ConnectionMapping{ServicePort: "keydb", Username: "{{ .Password }}"},
+			err:        "invalid connection username",
+		},
+		{
+			name:       "invalid values",
+			connection: cloudshipv1beta1.ConnectionMapping{ServicePort: "keydb"},
+			values:     `["replicas"]`,
+			err:        "invalid values",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			class := testClass(cloudshipv1beta1.BackingServiceCategoryCache, "KeyDB", tt.connection)
+			if tt.values != "" {
+				class.Spec.Values.Raw = []byte(tt.values)
+			}
+			_, err := NewClassManagerFactory(nil, class)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestClassConnectionWithoutService(t *testing.T) {
+	factory, err := NewClassManagerFactory(nil, testClass(cloudshipv1beta1.BackingServiceCategoryCache, "KeyDB",
+		cloudshipv1beta1.ConnectionMapping{ServicePort: "keydb"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = factory.(*managerFactory).action.Connection(RenderedRelease{Name: "cache-sessions-keydb", Namespace: "shop"})
+	if err == nil || !strings.Contains(err.Error(), `has no Service with port "keydb"`) {
+		t.Fatalf("expected the connection of a release without Service to fail, got %v", err)
+	}
+}
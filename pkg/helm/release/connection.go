@@ -0,0 +1,197 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/releaseutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+)
+
+// RenderedRelease is a release as rendered by its chart. The connection
+// details of a release are derived from it.
+type RenderedRelease struct {
+	// Name is the name of the release
+	Name string
+	// Namespace is the namespace of the release
+	Namespace string
+	// Services are the Services rendered by the chart
+	Services []corev1.Service
+	// Values are the values the release was rendered with
+	Values map[string]interface{}
+}
+
+// ConnectionSpec describes how the connection details of a release are
+// derived from the Services rendered by its chart and its values.
+type ConnectionSpec struct {
+	// Scheme is the scheme of the URL of the release. No URL is built when
+	// empty.
+	Scheme string
+	// TLSScheme is the scheme of the URL when TLS is enabled
+	TLSScheme string
+	// PortName is the name of the Service port workloads connect to
+	PortName string
+	// TLSPortName is the name of the Service port when TLS is enabled.
+	// Defaults to PortName.
+	TLSPortName string
+	// ServiceSuffix restricts the Services to the ones whose name ends with
+	// it, for charts rendering several Services with the same port
+	ServiceSuffix string
+	// UsernameValue is the dot separated path of the username in the values
+	UsernameValue string
+	// DatabaseValue is the dot separated path of the database in the values
+	DatabaseValue string
+	// TLSValue is the dot separated path of the boolean value enabling TLS
+	TLSValue string
+}
+
+// ConnectionDetails returns the connection details of the release.
+func (s ConnectionSpec) ConnectionDetails(rel RenderedRelease) (*cloudshipv1beta1.ConnectionDetails, error) {
+	tls, _ := lookupValue(rel.Values, s.TLSValue).(bool)
+	portName := s.PortName
+	if tls && s.TLSPortName != "" {
+		portName = s.TLSPortName
+	}
+
+	svc, port, err := findServicePort(rel, portName, s.ServiceSuffix)
+	if err != nil {
+		return nil, err
+	}
+	details := &cloudshipv1beta1.ConnectionDetails{
+		Hostname: serviceHostname(svc, rel.Namespace),
+		Port:     strconv.Itoa(int(port.Port)),
+		TLS:      tls,
+	}
+	details.Username, _ = lookupValue(rel.Values, s.UsernameValue).(string)
+	details.Database, _ = lookupValue(rel.Values, s.DatabaseValue).(string)
+
+	scheme := s.Scheme
+	if tls && s.TLSScheme != "" {
+		scheme = s.TLSScheme
+	}
+	details.URL = connectionURL(scheme, details)
+	return details, nil
+}
+
+// findServicePort returns the Service of the release exposing the port named
+// portName. Headless Services are skipped and, when several Services expose
+// the port, the one with the shortest name is returned, which for the charts
+// in use is the main Service of the release.
+func findServicePort(rel RenderedRelease, portName, suffix string) (*corev1.Service, *corev1.ServicePort, error) {
+	var svc *corev1.Service
+	var port *corev1.ServicePort
+	for i := range rel.Services {
+		candidate := &rel.Services[i]
+		if candidate.Spec.ClusterIP == corev1.ClusterIPNone || !strings.HasSuffix(candidate.GetName(), suffix) {
+			continue
+		}
+		for j := range candidate.Spec.Ports {
+			if portName != "" && candidate.Spec.Ports[j].Name != portName {
+				continue
+			}
+			if svc == nil || len(candidate.GetName()) < len(svc.GetName()) ||
+				(len(candidate.GetName()) == len(svc.GetName()) && candidate.GetName() < svc.GetName()) {
+				svc = candidate
+				port = &candidate.Spec.Ports[j]
+			}
+			break
+		}
+	}
+	if svc == nil {
+		return nil, nil, fmt.Errorf("release %s has no Service with port %q", rel.Name, portName)
+	}
+	return svc, port, nil
+}
+
+func serviceHostname(svc *corev1.Service, namespace string) string {
+	if svc.GetNamespace() != "" {
+		namespace = svc.GetNamespace()
+	}
+	return fmt.Sprintf("%s.%s.svc.cluster.local", svc.GetName(), namespace)
+}
+
+// connectionURL returns the URL of the connection details, without password.
+func connectionURL(scheme string, details *cloudshipv1beta1.ConnectionDetails) string {
+	if scheme == "" {
+		return ""
+	}
+	u := url.URL{
+		Scheme: scheme,
+		Host:   net.JoinHostPort(details.Hostname, details.Port),
+	}
+	if details.Username != "" {
+		u.User = url.User(details.Username)
+	}
+	if details.Database != "" {
+		u.Path = "/" + details.Database
+	}
+	return u.String()
+}
+
+// lookupValue returns the value at the dot separated path, or nil if it is
+// not set.
+func lookupValue(values map[string]interface{}, path string) interface{} {
+	if path == "" {
+		return nil
+	}
+	var current interface{} = values
+	for _, key := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[key]
+	}
+	return current
+}
+
+// renderedServices returns the Services in a release manifest.
+func renderedServices(manifest string) ([]corev1.Service, error) {
+	manifests := releaseutil.SplitManifests(manifest)
+	keys := make([]string, 0, len(manifests))
+	for k := range manifests {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var services []corev1.Service
+	for _, k := range keys {
+		var typeMeta metav1.TypeMeta
+		if err := yaml.Unmarshal([]byte(manifests[k]), &typeMeta); err != nil {
+			return nil, fmt.Errorf("failed to parse release manifest: %w", err)
+		}
+		if typeMeta.Kind != "Service" || typeMeta.APIVersion != corev1.SchemeGroupVersion.String() {
+			continue
+		}
+		var svc corev1.Service
+		if err := yaml.Unmarshal([]byte(manifests[k]), &svc); err != nil {
+			return nil, fmt.Errorf("failed to parse Service in release manifest: %w", err)
+		}
+		services = append(services, svc)
+	}
+	return services, nil
+}
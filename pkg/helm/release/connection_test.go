@@ -0,0 +1,255 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+)
+
+func testService(name, clusterIP string, ports ...corev1.ServicePort) corev1.Service {
+	return corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       corev1.ServiceSpec{ClusterIP: clusterIP, Ports: ports},
+	}
+}
+
+func TestFindServicePort(t *testing.T) {
+	redis := corev1.ServicePort{Name: "tcp-redis", Port: 6379}
+	sentinel := corev1.ServicePort{Name: "tcp-sentinel", Port: 26379}
+	tests := []struct {
+		name     string
+		services []corev1.Service
+		portName string
+		suffix   string
+		service  string
+		port     int32
+	}{
+		{
+			name:     "no Service",
+			portName: "tcp-redis",
+		},
+		{
+			name:     "missing port",
+			services: []corev1.Service{testService("cache-redis-master", "", sentinel)},
+			portName: "tcp-redis",
+		},
+		{
+			name:     "named port",
+			services: []corev1.Service{testService("cache-redis-master", "", sentinel, redis)},
+			portName: "tcp-redis",
+			service:  "cache-redis-master",
+			port:     6379,
+		},
+		{
+			name:     "any port",
+			services: []corev1.Service{testService("cache-memcached", "", corev1.ServicePort{Name: "memcache", Port: 11211})},
+			service:  "cache-memcached",
+			port:     11211,
+		},
+		{
+			name: "shortest name of several Services",
+			services: []corev1.Service{
+				testService("db-postgresql-read", "", corev1.ServicePort{Name: "tcp-postgresql", Port: 5432}),
+				testService("db-postgresql", "", corev1.ServicePort{Name: "tcp-postgresql", Port: 5432}),
+				testService("db-postgresql-headless", corev1.ClusterIPNone, corev1.ServicePort{Name: "tcp-postgresql", Port: 5432}),
+			},
+			portName: "tcp-postgresql",
+			service:  "db-postgresql",
+			port:     5432,
+		},
+		{
+			name: "headless Service only",
+			services: []corev1.Service{
+				testService("db-postgresql-headless", corev1.ClusterIPNone, corev1.ServicePort{Name: "tcp-postgresql", Port: 5432}),
+			},
+			portName: "tcp-postgresql",
+		},
+		{
+			name: "suffix",
+			services: []corev1.Service{
+				testService("cache-redis-master", "", redis),
+				testService("cache-redis-replicas", "", redis),
+			},
+			portName: "tcp-redis",
+			suffix:   "-replicas",
+			service:  "cache-redis-replicas",
+			port:     6379,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rel := RenderedRelease{Name: "cache", Namespace: "shop", Services: tt.services}
+			svc, port, err := findServicePort(rel, tt.portName, tt.suffix)
+			if tt.service == "" {
+				if err == nil {
+					t.Fatalf("expected no Service with port %q, got %s", tt.portName, svc.GetName())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if svc.GetName() != tt.service || port.Port != tt.port {
+				t.Errorf("expected port %d of Service %s, got port %d of Service %s", tt.port, tt.service, port.Port, svc.GetName())
+			}
+		})
+	}
+}
+
+func TestConnectionURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		scheme  string
+		details cloudshipv1beta1.ConnectionDetails
+		url     string
+	}{
+		{
+			name:    "no scheme",
+			details: cloudshipv1beta1.ConnectionDetails{Hostname: "cache-redis-master.shop.svc.cluster.local", Port: "6379"},
+		},
+		{
+			name:    "host",
+			scheme:  "redis",
+			details: cloudshipv1beta1.ConnectionDetails{Hostname: "cache-redis-master.shop.svc.cluster.local", Port: "6379"},
+			url:     "redis://cache-redis-master.shop.svc.cluster.local:6379",
+		},
+		{
+			name:   "username and database",
+			scheme: "postgresql",
+			details: cloudshipv1beta1.ConnectionDetails{
+				Hostname: "db-postgresql.shop.svc.cluster.local",
+				Port:     "5432",
+				Username: "shop",
+				Database: "orders",
+			},
+			url: "postgresql://shop@db-postgresql.shop.svc.cluster.local:5432/orders",
+		},
+		{
+			name:    "escaped username",
+			scheme:  "amqp",
+			details: cloudshipv1beta1.ConnectionDetails{Hostname: "stream-rabbitmq", Port: "5672", Username: "shop@example"},
+			url:     "amqp://shop%40example@stream-rabbitmq:5672",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if url := connectionURL(tt.scheme, &tt.details); url != tt.url {
+				t.Errorf("expected URL %q, got %q", tt.url, url)
+			}
+		})
+	}
+}
+
+func TestRenderedServices(t *testing.T) {
+	manifest := `---
+# Source: redis/templates/headless-svc.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: cache-redis-headless
+spec:
+  clusterIP: None
+  ports:
+  - name: tcp-redis
+    port: 6379
+---
+# Source: redis/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cache-redis
+data:
+  redis.conf: ""
+---
+# Source: redis/templates/redis-master-svc.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: cache-redis-master
+spec:
+  ports:
+  - name: tcp-redis
+    port: 6379
+---
+# Source: redis/templates/serving-svc.yaml
+apiVersion: serving.knative.dev/v1
+kind: Service
+metadata:
+  name: cache-redis-serving
+`
+	services, err := renderedServices(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, svc := range services {
+		names = append(names, svc.GetName())
+	}
+	if len(names) != 2 || names[0] != "cache-redis-headless" || names[1] != "cache-redis-master" {
+		t.Fatalf("expected Services cache-redis-headless and cache-redis-master, got %v", names)
+	}
+	if services[1].Spec.Ports[0].Port != 6379 {
+		t.Errorf("expected Service cache-redis-master to expose port 6379, got %v", services[1].Spec.Ports)
+	}
+
+	if _, err := renderedServices("kind: [Service"); err == nil {
+		t.Error("expected an invalid manifest to fail")
+	}
+}
+
+func TestConnectionDetails(t *testing.T) {
+	spec := ConnectionSpec{
+		Scheme:        "postgresql",
+		PortName:      "tcp-postgresql",
+		UsernameValue: "auth.username",
+		DatabaseValue: "auth.database",
+	}
+	rel := RenderedRelease{
+		Name:      "db-web-main-postgresql",
+		Namespace: "shop",
+		Services: []corev1.Service{
+			testService("db-web-main-postgresql", "", corev1.ServicePort{Name: "tcp-postgresql", Port: 5432}),
+		},
+		Values: map[string]interface{}{
+			"auth": map[string]interface{}{"username": "web", "database": "main"},
+		},
+	}
+	details, err := spec.ConnectionDetails(rel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := cloudshipv1beta1.ConnectionDetails{
+		Hostname: "db-web-main-postgresql.shop.svc.cluster.local",
+		Port:     "5432",
+		Username: "web",
+		Database: "main",
+		URL:      "postgresql://web@db-web-main-postgresql.shop.svc.cluster.local:5432/main",
+	}
+	if *details != expected {
+		t.Errorf("expected connection details %+v, got %+v", expected, *details)
+	}
+
+	rel.Services = nil
+	if _, err := spec.ConnectionDetails(rel); err == nil {
+		t.Error("expected a release without Service to have no connection details")
+	}
+}
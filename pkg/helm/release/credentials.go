@@ -0,0 +1,147 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// credentialsSecretSuffix is appended to the release name to name the
+	// Secret with the credentials of the release
+	credentialsSecretSuffix string = "-credentials"
+
+	passwordLength   int    = 24
+	passwordAlphabet string = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// credentialsSecretName returns the name of the Secret with the credentials of
+// the release.
+func credentialsSecretName(releaseName string) string {
+	return releaseName + credentialsSecretSuffix
+}
+
+// CredentialsSecretName returns the name of the Secret with the credentials
+// of the release, or an empty string if the release has no credentials.
+func (m manager) CredentialsSecretName() string {
+	if len(m.action.CredentialKeys()) == 0 {
+		return ""
+	}
+	return credentialsSecretName(m.releaseName)
+}
+
+// PasswordSecretRef returns the reference to the password workloads use to
+// connect to the release, or nil if the release has no credentials.
+func (m manager) PasswordSecretRef() *corev1.SecretKeySelector {
+	name := m.CredentialsSecretName()
+	if name == "" || m.action.PasswordKey() == "" {
+		return nil
+	}
+	return &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: name},
+		Key:                  m.action.PasswordKey(),
+	}
+}
+
+// ensureCredentials creates the Secret with the credentials of the release,
+// owned by the owner of the release. Passwords already in the Secret are kept,
+// missing ones are generated.
+func (m manager) ensureCredentials(ctx context.Context) error {
+	name := m.CredentialsSecretName()
+	if name == "" {
+		return nil
+	}
+
+	secret := &corev1.Secret{}
+	err := m.client.Get(ctx, k8stypes.NamespacedName{Namespace: m.namespace, Name: name}, secret)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get credentials secret: %w", err)
+	}
+	exists := err == nil
+	if !exists {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: m.namespace,
+			},
+			Type: corev1.SecretTypeOpaque,
+		}
+		if m.owner != nil {
+			if err := controllerutil.SetControllerReference(m.owner, secret, m.scheme); err != nil {
+				return fmt.Errorf("failed to set owner of credentials secret: %w", err)
+			}
+		}
+	}
+
+	changed := false
+	for _, key := range m.action.CredentialKeys() {
+		if len(secret.Data[key]) > 0 {
+			continue
+		}
+		password, err := randomPassword(passwordLength)
+		if err != nil {
+			return fmt.Errorf("failed to generate password: %w", err)
+		}
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		secret.Data[key] = []byte(password)
+		changed = true
+	}
+
+	if !exists {
+		if err := m.client.Create(ctx, secret); err != nil {
+			return fmt.Errorf("failed to create credentials secret: %w", err)
+		}
+		return nil
+	}
+	if changed {
+		if err := m.client.Update(ctx, secret); err != nil {
+			return fmt.Errorf("failed to update credentials secret: %w", err)
+		}
+	}
+	return nil
+}
+
+// NewPassword returns a random password, as the ones generated for the
+// credentials of the releases.
+func NewPassword() (string, error) {
+	return randomPassword(passwordLength)
+}
+
+// randomPassword returns a random alphanumeric password of length n.
+func randomPassword(n int) (string, error) {
+	max := big.NewInt(int64(len(passwordAlphabet)))
+	out := make([]byte, n)
+	for i := range out {
+		idx, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		out[i] = passwordAlphabet[idx.Int64()]
+	}
+	return string(out), nil
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+)
+
+func TestEnsureCredentials(t *testing.T) {
+	owner := &cloudshipv1beta1.AppService{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop", UID: "web-uid"}}
+	key := k8stypes.NamespacedName{Namespace: "shop", Name: "db-web-main-postgresql-credentials"}
+	credentials := func(t *testing.T, m manager) map[string][]byte {
+		t.Helper()
+		var secret corev1.Secret
+		if err := m.client.Get(context.Background(), key, &secret); err != nil {
+			t.Fatal(err)
+		}
+		if !metav1.IsControlledBy(&secret, owner) {
+			t.Errorf("expected Secret %s to be owned by service web, got %v", key, secret.GetOwnerReferences())
+		}
+		return secret.Data
+	}
+	newManager := func(t *testing.T, objs ...client.Object) manager {
+		t.Helper()
+		c := testClient(t, objs...)
+		return manager{
+			client:      c,
+			scheme:      c.Scheme(),
+			owner:       owner,
+			releaseName: "db-web-main-postgresql",
+			namespace:   "shop",
+			action:      postgresqlAction{},
+		}
+	}
+
+	t.Run("generated once", func(t *testing.T) {
+		m := newManager(t)
+		if err := m.ensureCredentials(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		generated := credentials(t, m)
+		for _, k := range []string{postgresqlPasswordKey, postgresqlPostgresPasswordKey} {
+			if len(generated[k]) != passwordLength {
+				t.Errorf("expected a password of %d characters in key %s, got %q", passwordLength, k, generated[k])
+			}
+		}
+		if string(generated[postgresqlPasswordKey]) == string(generated[postgresqlPostgresPasswordKey]) {
+			t.Errorf("expected different passwords, got %q twice", generated[postgresqlPasswordKey])
+		}
+
+		for i := 0; i < 3; i++ {
+			if err := m.ensureCredentials(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		kept := credentials(t, m)
+		for k, password := range generated {
+			if string(kept[k]) != string(password) {
+				t.Errorf("expected the password in key %s to stay %q across reconciles, got %q", k, password, kept[k])
+			}
+		}
+	})
+
+	t.Run("missing password", func(t *testing.T) {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Data:       map[string][]byte{postgresqlPasswordKey: []byte("s3cr3t")},
+		}
+		if err := controllerutil.SetControllerReference(owner, secret, testClient(t).Scheme()); err != nil {
+			t.Fatal(err)
+		}
+		m := newManager(t, secret)
+		if err := m.ensureCredentials(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		data := credentials(t, m)
+		if string(data[postgresqlPasswordKey]) != "s3cr3t" {
+			t.Errorf("expected the password set by the user to be kept, got %q", data[postgresqlPasswordKey])
+		}
+		if len(data[postgresqlPostgresPasswordKey]) != passwordLength {
+			t.Errorf("expected the missing password to be generated, got %q", data[postgresqlPostgresPasswordKey])
+		}
+	})
+
+	t.Run("no credentials", func(t *testing.T) {
+		m := newManager(t)
+		m.releaseName = "cache-sessions-memcached"
+		m.action = memcachedActions{}
+		if err := m.ensureCredentials(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		var secrets corev1.SecretList
+		if err := m.client.List(context.Background(), &secrets); err != nil {
+			t.Fatal(err)
+		}
+		if len(secrets.Items) != 0 {
+			t.Errorf("expected no credentials Secret, got %v", secrets.Items)
+		}
+	})
+}
+
+func TestRandomPassword(t *testing.T) {
+	seen := map[string]bool{}
+	for _, n := range []int{1, 8, passwordLength, 64} {
+		password, err := randomPassword(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(password) != n {
+			t.Errorf("expected a password of %d characters, got %q", n, password)
+		}
+		if strings.IndexFunc(password, func(r rune) bool { return !strings.ContainsRune(passwordAlphabet, r) }) >= 0 {
+			t.Errorf("expected an alphanumeric password, got %q", password)
+		}
+		if n > 1 && seen[password] {
+			t.Errorf("expected random passwords, got %q twice", password)
+		}
+		seen[password] = true
+	}
+}
@@ -17,9 +17,8 @@ limitations under the License.
 package release
 
 import (
-	cloudshipv1alpha1 "github.com/ToucanSoftware/cloudship-operator/api/v1alpha1"
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
 	"helm.sh/helm/v3/pkg/cli"
-	corev1 "k8s.io/api/core/v1"
 	crmanager "sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
@@ -30,21 +29,29 @@ const (
 
 var kafkaValues map[string]interface{} = map[string]interface{}{}
 
+var kafkaConnection = ConnectionSpec{
+	PortName: "tcp-client",
+}
+
 type kafkaActions struct{}
 
 func (e kafkaActions) PreInstalacion() map[string]interface{} {
 	return kafkaValues
 }
 
-func (e kafkaActions) EnvVars(as *cloudshipv1alpha1.Application) []corev1.EnvVar {
+func (e kafkaActions) Connection(rel RenderedRelease) (*cloudshipv1beta1.ConnectionDetails, error) {
+	return kafkaConnection.ConnectionDetails(rel)
+}
+
+func (e kafkaActions) CredentialKeys() []string {
 	return nil
 }
 
-func (e kafkaActions) Port() string {
-	return ""
+func (e kafkaActions) CredentialValues(secretName string) map[string]interface{} {
+	return nil
 }
 
-func (e kafkaActions) Hostname(as *cloudshipv1alpha1.Application) string {
+func (e kafkaActions) PasswordKey() string {
 	return ""
 }
 
@@ -17,24 +17,28 @@ limitations under the License.
 package release
 
 import (
+	"context"
 	"fmt"
 	"os"
 
 	"helm.sh/helm/v3/pkg/action"
-	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/cli"
 	"helm.sh/helm/v3/pkg/kube"
 	helmrelease "helm.sh/helm/v3/pkg/release"
 	"helm.sh/helm/v3/pkg/storage"
 	"helm.sh/helm/v3/pkg/storage/driver"
 
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/helm/pkg/strvals"
 
 	ctrl "sigs.k8s.io/controller-runtime"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	crmanager "sigs.k8s.io/controller-runtime/pkg/manager"
 
 	"github.com/ToucanSoftware/cloudship-operator/internal/helm/client"
+	"github.com/ToucanSoftware/cloudship-operator/pkg/helm/chart"
 )
 
 // ManagerFactory creates Managers that are specific to custom resources. It is
@@ -42,13 +46,19 @@ import (
 // improves decoupling between reconciliation logic and the Helm backend
 // components used to manage releases.
 type ManagerFactory interface {
-	NewManager(namespace string, overrideValues map[string]string) (Manager, error)
+	NewManager(ctx context.Context, owner crclient.Object, namespace string, values map[string]interface{}, overrideValues map[string]string) (Manager, error)
+	// ReleaseName returns the name of the releases of the managers.
+	ReleaseName() string
+	// ForRelease returns a ManagerFactory of the same backing service whose
+	// managers install the release named name.
+	ForRelease(name string) ManagerFactory
 }
 
 type managerFactory struct {
 	mgr          crmanager.Manager
 	chartName    string
 	chartVersion string
+	chartSource  chart.Source
 	releaseName  string
 	values       map[string]interface{}
 	settings     *cli.EnvSettings
@@ -60,7 +70,11 @@ const (
 	defaultChartPathPrefix string = "/charts"
 )
 
-func (f managerFactory) NewManager(namespace string, overrideValues map[string]string) (Manager, error) {
+// NewManager returns a Manager for the release in namespace. The resources
+// rendered by the chart are owned by owner, so they are garbage collected
+// together with it. values are merged over the defaults of the factory, and
+// overrideValues, in strvals format, over both. The chart is loaded with ctx.
+func (f managerFactory) NewManager(ctx context.Context, owner crclient.Object, namespace string, values map[string]interface{}, overrideValues map[string]string) (Manager, error) {
 	var log = ctrl.Log.WithName("helm").WithName("manager_factory")
 
 	// Get both v2 and v3 storage backends
@@ -79,7 +93,11 @@ func (f managerFactory) NewManager(namespace string, overrideValues map[string]s
 
 	kubeClient := kube.New(rcg)
 	restMapper := f.mgr.GetRESTMapper()
-	ownerRefClient, err := client.NewOwnerRefInjectingClient(*kubeClient, restMapper, nil)
+	ownerRef, err := f.ownerReference(owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get owner of release: %w", err)
+	}
+	ownerRefClient, err := client.NewOwnerRefInjectingClient(*kubeClient, restMapper, ownerRef)
 	if err != nil {
 		return nil, fmt.Errorf("failed to inject owner references: %w", err)
 	}
@@ -87,10 +105,13 @@ func (f managerFactory) NewManager(namespace string, overrideValues map[string]s
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse override values: %w", err)
 	}
-	values := mergeMaps(f.values, expOverrides)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse override values: %w", err)
+	// the chart reads the generated credentials from the credentials secret,
+	// unless the user values point it somewhere else
+	credentialValues := map[string]interface{}{}
+	if len(f.action.CredentialKeys()) > 0 {
+		credentialValues = f.action.CredentialValues(credentialsSecretName(f.releaseName))
 	}
+	values = mergeMaps(mergeMaps(mergeMaps(f.values, credentialValues), values), expOverrides)
 	actionConfig := &action.Configuration{
 		RESTClientGetter: rcg,
 		Releases:         storageBackend,
@@ -98,12 +119,17 @@ func (f managerFactory) NewManager(namespace string, overrideValues map[string]s
 		Log:              func(_ string, _ ...interface{}) {},
 	}
 
-	var cp = f.buildChartPath()
+	chartSource := f.chartSource
+	if chartSource == nil {
+		if chartSource, err = defaultChartSource(); err != nil {
+			return nil, fmt.Errorf("failed to get chart source: %w", err)
+		}
+	}
 
-	log.Info(fmt.Sprintf("Loading Chart: %s", cp))
-	crChart, err := loader.Load(cp)
+	log.Info(fmt.Sprintf("Loading Chart: %s-%s", f.chartName, f.chartVersion))
+	crChart, err := chartSource.Load(ctx, f.chartName, f.chartVersion)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load chart dir: %w", err)
+		return nil, fmt.Errorf("failed to load chart: %w", err)
 	}
 	releaseName, err := getReleaseName(storageBackend, crChart.Name(), f.releaseName)
 	if err != nil {
@@ -113,6 +139,9 @@ func (f managerFactory) NewManager(namespace string, overrideValues map[string]s
 		actionConfig:   actionConfig,
 		storageBackend: storageBackend,
 		kubeClient:     ownerRefClient,
+		client:         f.mgr.GetClient(),
+		scheme:         f.mgr.GetScheme(),
+		owner:          owner,
 
 		releaseName: releaseName,
 		namespace:   namespace,
@@ -124,6 +153,40 @@ func (f managerFactory) NewManager(namespace string, overrideValues map[string]s
 	}, nil
 }
 
+// ReleaseName returns the name of the releases of the managers.
+func (f managerFactory) ReleaseName() string {
+	return f.releaseName
+}
+
+// ForRelease returns a copy of the factory whose managers install the
+// release named name.
+func (f managerFactory) ForRelease(name string) ManagerFactory {
+	f.releaseName = name
+	if action, ok := f.action.(classAction); ok {
+		action.data.ReleaseName = name
+		f.action = action
+	}
+	return &f
+}
+
+// ownerReference returns the minimal unstructured representation of owner
+// needed to build owner references and annotations.
+func (f managerFactory) ownerReference(owner crclient.Object) (*unstructured.Unstructured, error) {
+	if owner == nil {
+		return nil, nil
+	}
+	gvk, err := apiutil.GVKForObject(owner, f.mgr.GetScheme())
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(gvk)
+	u.SetNamespace(owner.GetNamespace())
+	u.SetName(owner.GetName())
+	u.SetUID(owner.GetUID())
+	return u, nil
+}
+
 // getReleaseName returns a release name for the CR.
 //
 // getReleaseName searches for a release using the CR name. If a release
@@ -135,11 +198,8 @@ func (f managerFactory) NewManager(namespace string, overrideValues map[string]s
 // because Kubernetes allows instances of different types to have the same name
 // in the same namespace.
 //
-// TODO(jlanford): As noted above, using the CR name as the release name raises
-//   the possibility of collision. We should move this logic to a validating
-//   admission webhook so that the CR owner receives immediate feedback of the
-//   collision. As is, the only indication of collision will be in the CR status
-//   and operator logs.
+// The validating admission webhooks report the collision when the resource is
+// created, so this only catches releases installed afterwards.
 func getReleaseName(storageBackend *storage.Storage, crChartName string,
 	extectedReleaseName string) (string, error) {
 
@@ -208,12 +268,28 @@ func mergeMaps(a, b map[string]interface{}) map[string]interface{} {
 	return out
 }
 
-func (f managerFactory) buildChartPath() string {
+// defaultChartSource returns the chart source configured for the operator.
+// CHART_SOURCE accepts any location supported by chart.NewSource, and remote
+// charts are cached in CHART_CACHE_DIR. Without CHART_SOURCE, chart archives
+// are loaded from CHART_PATH_PREFIX, which defaults to the charts bundled in
+// the docker image.
+func defaultChartSource() (chart.Source, error) {
+	if location := os.Getenv("CHART_SOURCE"); location != "" {
+		return chart.NewSource(location, chartSourceOptions()...)
+	}
 	// using a chart path prefix we can use it for debuging
 	var chartPathPrefix = os.Getenv("CHART_PATH_PREFIX")
-	var chartFileName = fmt.Sprintf("%s-%s.tgz", f.chartName, f.chartVersion)
 	if chartPathPrefix == "" {
 		chartPathPrefix = defaultChartPathPrefix
 	}
-	return fmt.Sprintf("%s/%s", chartPathPrefix, chartFileName)
+	return chart.NewLocalSource(chartPathPrefix), nil
+}
+
+// chartSourceOptions returns the options of remote chart sources.
+func chartSourceOptions() []chart.Option {
+	var opts []chart.Option
+	if cacheDir := os.Getenv("CHART_CACHE_DIR"); cacheDir != "" {
+		opts = append(opts, chart.WithCacheDir(cacheDir))
+	}
+	return opts
 }
@@ -17,38 +17,72 @@ limitations under the License.
 package release
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
 	"strings"
 
+	jsonpatch "gomodules.xyz/jsonpatch/v2"
 	"helm.sh/helm/v3/pkg/action"
 	cpb "helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/kube"
 	rpb "helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
 	"helm.sh/helm/v3/pkg/storage"
 	"helm.sh/helm/v3/pkg/storage/driver"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/cli-runtime/pkg/resource"
 
 	ctrl "sigs.k8s.io/controller-runtime"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
 
-	cloudshipv1alpha1 "github.com/ToucanSoftware/cloudship-operator/api/v1alpha1"
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 )
 
 // InstallOption are the options for the install command
 type InstallOption func(*action.Install) error
 
+// UpgradeOption are the options for the upgrade command
+type UpgradeOption func(*action.Upgrade) error
+
 // UninstallOption are the options for the uninstall command
 type UninstallOption func(*action.Uninstall) error
 
 type ManagerAction interface {
 	PreInstalacion() map[string]interface{}
-	EnvVars(as *cloudshipv1alpha1.Application) []corev1.EnvVar
 
-	// Hostname of the installed application
-	Hostname(as *cloudshipv1alpha1.Application) string
-	// Port of the installed application
-	Port() string
+	// Connection returns the details workloads use to connect to the
+	// rendered release
+	Connection(rel RenderedRelease) (*cloudshipv1beta1.ConnectionDetails, error)
+	// CredentialKeys are the keys of the Secret with the credentials of the
+	// release, each one holds a random password. The release has no
+	// credentials Secret when empty.
+	CredentialKeys() []string
+	// CredentialValues are the values that make the chart read its
+	// credentials from the Secret
+	CredentialValues(secretName string) map[string]interface{}
+	// PasswordKey is the key of the Secret with the password workloads use to
+	// connect to the release
+	PasswordKey() string
+}
+
+// AdminAction is implemented by the actions of database servers the operator
+// creates databases and users on, as the administrator of the server
+type AdminAction interface {
+	// AdminUsername is the name of the administrator of the server
+	AdminUsername() string
+	// AdminPasswordKey is the key of the Secret with the credentials of the
+	// release holding the password of the administrator
+	AdminPasswordKey() string
 }
 
 // Manager manages a Helm release. It can install, upgrade, reconcile,
@@ -56,19 +90,28 @@ type ManagerAction interface {
 type Manager interface {
 	ManagerAction
 	ReleaseName() string
+	ConnectionDetails() (*cloudshipv1beta1.ConnectionDetails, error)
+	AdminConnectionDetails() (*cloudshipv1beta1.ConnectionDetails, error)
+	CredentialsSecretName() string
+	PasswordSecretRef() *corev1.SecretKeySelector
 	IsInstalled() bool
 	IsUpgradeRequired() bool
+	IsReady(context.Context) (bool, string, error)
 	Sync(context.Context) error
 	InstallRelease(context.Context, ...InstallOption) (*rpb.Release, error)
-	// UpgradeRelease(context.Context, ...UpgradeOption) (*rpb.Release, *rpb.Release, error)
-	// ReconcileRelease(context.Context) (*rpb.Release, error)
+	UpgradeRelease(context.Context, ...UpgradeOption) (*rpb.Release, *rpb.Release, error)
+	ReconcileRelease(context.Context) (*rpb.Release, error)
 	UninstallRelease(context.Context, ...UninstallOption) (*rpb.Release, error)
+	IsUninstalled(context.Context) (bool, error)
 }
 
 type manager struct {
 	actionConfig   *action.Configuration
 	storageBackend *storage.Storage
 	kubeClient     kube.Interface
+	client         crclient.Client
+	scheme         *runtime.Scheme
+	owner          crclient.Object
 
 	releaseName string
 	namespace   string
@@ -87,16 +130,71 @@ func (m manager) PreInstalacion() map[string]interface{} {
 	return m.action.PreInstalacion()
 }
 
-func (m manager) EnvVars(as *cloudshipv1alpha1.Application) []corev1.EnvVar {
-	return m.action.EnvVars(as)
+func (m manager) Connection(rel RenderedRelease) (*cloudshipv1beta1.ConnectionDetails, error) {
+	return m.action.Connection(rel)
+}
+
+// ConnectionDetails returns the details workloads use to connect to the
+// deployed release. They are derived from the Services in the manifest of the
+// release and the values it was installed with.
+func (m manager) ConnectionDetails() (*cloudshipv1beta1.ConnectionDetails, error) {
+	deployedRelease, err := m.getDeployedRelease()
+	if err != nil {
+		return nil, err
+	}
+	services, err := renderedServices(deployedRelease.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	details, err := m.action.Connection(RenderedRelease{
+		Name:      m.releaseName,
+		Namespace: m.namespace,
+		Services:  services,
+		Values:    deployedRelease.Config,
+	})
+	if err != nil {
+		return nil, err
+	}
+	details.PasswordSecretRef = m.PasswordSecretRef()
+	return details, nil
+}
+
+// AdminConnectionDetails returns the details the operator uses to connect to
+// the deployed release as the administrator of its server. They have no
+// database and fail for releases without an administrator.
+func (m manager) AdminConnectionDetails() (*cloudshipv1beta1.ConnectionDetails, error) {
+	admin, ok := m.action.(AdminAction)
+	if !ok || m.CredentialsSecretName() == "" {
+		return nil, fmt.Errorf("release %s has no administrator", m.releaseName)
+	}
+	details, err := m.ConnectionDetails()
+	if err != nil {
+		return nil, err
+	}
+	details.Username = admin.AdminUsername()
+	details.Database = ""
+	details.PasswordSecretRef = &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: m.CredentialsSecretName()},
+		Key:                  admin.AdminPasswordKey(),
+	}
+	if details.URL != "" {
+		if u, err := url.Parse(details.URL); err == nil {
+			details.URL = connectionURL(u.Scheme, details)
+		}
+	}
+	return details, nil
+}
+
+func (m manager) CredentialKeys() []string {
+	return m.action.CredentialKeys()
 }
 
-func (m manager) Hostname(as *cloudshipv1alpha1.Application) string {
-	return m.action.Hostname(as)
+func (m manager) CredentialValues(secretName string) map[string]interface{} {
+	return m.action.CredentialValues(secretName)
 }
 
-func (m manager) Port() string {
-	return m.action.Port()
+func (m manager) PasswordKey() string {
+	return m.action.PasswordKey()
 }
 
 // ReleaseName returns the name of the release.
@@ -123,13 +221,19 @@ func (m *manager) Sync(ctx context.Context) error {
 
 	// Cleanup non-deployed release versions. If all release versions are
 	// non-deployed, this will ensure that failed installations are correctly
-	// retried.
+	// retried. The history of an uninstalled release is kept, IsUninstalled
+	// reads it until the resources of the release are gone.
 	for _, rel := range releases {
-		if rel.Info != nil && rel.Info.Status != rpb.StatusDeployed {
-			_, err := m.storageBackend.Delete(rel.Name, rel.Version)
-			if err != nil && !notFoundErr(err) {
-				return fmt.Errorf("failed to delete stale release version: %w", err)
-			}
+		if rel.Info == nil {
+			continue
+		}
+		switch rel.Info.Status {
+		case rpb.StatusDeployed, rpb.StatusUninstalled, rpb.StatusUninstalling:
+			continue
+		}
+		_, err := m.storageBackend.Delete(rel.Name, rel.Version)
+		if err != nil && !notFoundErr(err) {
+			return fmt.Errorf("failed to delete stale release version: %w", err)
 		}
 	}
 
@@ -149,7 +253,7 @@ func (m *manager) Sync(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to get candidate release: %w", err)
 	}
-	if deployedRelease.Manifest != candidateRelease.Manifest {
+	if deployedRelease.Manifest != candidateRelease.Manifest || !valuesEqual(deployedRelease.Config, m.values) {
 		m.isUpgradeRequired = true
 	}
 
@@ -186,6 +290,11 @@ func (m manager) InstallRelease(ctx context.Context, opts ...InstallOption) (*rp
 	install := action.NewInstall(m.actionConfig)
 	install.ReleaseName = m.releaseName
 	install.Namespace = m.namespace
+	// Sync keeps the history of an uninstalled release, which Helm refuses to
+	// install over unless it replaces it
+	if last, err := m.storageBackend.Last(m.releaseName); err == nil && last.Info != nil && last.Info.Status == rpb.StatusUninstalled {
+		install.Replace = true
+	}
 	for _, o := range opts {
 		if err := o(install); err != nil {
 			log.Error(err, "failed to apply install option")
@@ -193,6 +302,10 @@ func (m manager) InstallRelease(ctx context.Context, opts ...InstallOption) (*rp
 		}
 	}
 
+	if err := m.ensureCredentials(ctx); err != nil {
+		return nil, err
+	}
+
 	log.Info("Invoking Install Helm Command")
 	installedRelease, err := install.Run(m.chart, m.values)
 	if err != nil {
@@ -219,17 +332,247 @@ func (m manager) InstallRelease(ctx context.Context, opts ...InstallOption) (*rp
 	return installedRelease, nil
 }
 
+// UpgradeRelease performs a Helm release upgrade. It returns the previously
+// deployed release and the upgraded one. If the upgrade fails after the new
+// release has been recorded, the release is rolled back to the previous
+// revision.
+func (m manager) UpgradeRelease(ctx context.Context, opts ...UpgradeOption) (*rpb.Release, *rpb.Release, error) {
+	var log = ctrl.Log.WithName("helm").WithName("manager")
+
+	upgrade := action.NewUpgrade(m.actionConfig)
+	upgrade.Namespace = m.namespace
+	for _, o := range opts {
+		if err := o(upgrade); err != nil {
+			log.Error(err, "failed to apply upgrade option")
+			return nil, nil, fmt.Errorf("failed to apply upgrade option: %w", err)
+		}
+	}
+
+	if err := m.ensureCredentials(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	log.Info("Invoking Upgrade Helm Command")
+	upgradedRelease, err := upgrade.Run(m.releaseName, m.chart, m.values)
+	if err != nil {
+		// Workaround for helm/helm#3338
+		if upgradedRelease != nil {
+			rollback := action.NewRollback(m.actionConfig)
+			rollback.Force = true
+
+			// If the upgrade returns a non-nil release, the release was also
+			// recorded in the release store, so the rollback must be performed.
+			// Any rollback error here would be unexpected, so always return
+			// both the upgrade and rollback errors.
+			if rollbackErr := rollback.Run(m.releaseName); rollbackErr != nil {
+				return nil, nil, fmt.Errorf("failed upgrade (%s) and failed rollback: %w", err, rollbackErr)
+			}
+		}
+		return nil, nil, fmt.Errorf("failed to upgrade release: %w", err)
+	}
+	log.Info("Release upgraded")
+	return m.deployedRelease, upgradedRelease, nil
+}
+
+// ReconcileRelease creates or patches resources as necessary to match the
+// deployed release's manifest. Resources that were deleted are created again
+// and resources that were edited are patched back to the rendered state.
+func (m manager) ReconcileRelease(ctx context.Context) (*rpb.Release, error) {
+	if m.deployedRelease == nil {
+		return nil, driver.ErrReleaseNotFound
+	}
+	if err := m.ensureCredentials(ctx); err != nil {
+		return m.deployedRelease, err
+	}
+	err := reconcileRelease(ctx, m.kubeClient, m.deployedRelease.Manifest)
+	return m.deployedRelease, err
+}
+
+func reconcileRelease(_ context.Context, kubeClient kube.Interface, expectedManifest string) error {
+	var log = ctrl.Log.WithName("helm").WithName("manager")
+
+	expectedInfos, err := kubeClient.Build(bytes.NewBufferString(expectedManifest), false)
+	if err != nil {
+		return err
+	}
+	return expectedInfos.Visit(func(expected *resource.Info, err error) error {
+		if err != nil {
+			return fmt.Errorf("visit error: %w", err)
+		}
+
+		helper := resource.NewHelper(expected.Client, expected.Mapping)
+		existing, err := helper.Get(expected.Namespace, expected.Name)
+		if apierrors.IsNotFound(err) {
+			log.Info(fmt.Sprintf("Recreating missing %s %s/%s",
+				expected.Mapping.GroupVersionKind.Kind, expected.Namespace, expected.Name))
+			if _, err := helper.Create(expected.Namespace, true, expected.Object); err != nil {
+				return fmt.Errorf("create error: %w", err)
+			}
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("could not get object: %w", err)
+		}
+
+		patch, patchType, err := createPatch(existing, expected)
+		if err != nil {
+			return fmt.Errorf("error creating patch: %w", err)
+		}
+		if patch == nil {
+			// nothing to do
+			return nil
+		}
+
+		log.Info(fmt.Sprintf("Patching drifted %s %s/%s",
+			expected.Mapping.GroupVersionKind.Kind, expected.Namespace, expected.Name))
+		_, err = helper.Patch(expected.Namespace, expected.Name, patchType, patch, &metav1.PatchOptions{})
+		if err != nil {
+			return fmt.Errorf("patch error: %w", err)
+		}
+		return nil
+	})
+}
+
+// createPatch replicates the patch creation done by Helm: a three-way
+// strategic merge patch for native Kubernetes objects, and a JSON patch for
+// unstructured objects.
+func createPatch(existing runtime.Object, expected *resource.Info) ([]byte, apitypes.PatchType, error) {
+	existingJSON, err := json.Marshal(existing)
+	if err != nil {
+		return nil, "", err
+	}
+	expectedJSON, err := json.Marshal(expected.Object)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Unstructured objects, such as CRDs, do not support strategic merge
+	// patches, so fall back to a generic JSON patch.
+	versionedObject := kube.AsVersioned(expected)
+	if _, isUnstructured := versionedObject.(runtime.Unstructured); isUnstructured {
+		patch, err := createJSONPatch(existingJSON, expectedJSON)
+		return patch, apitypes.JSONPatchType, err
+	}
+
+	patchMeta, err := strategicpatch.NewPatchMetaFromStruct(versionedObject)
+	if err != nil {
+		return nil, "", err
+	}
+	patch, err := strategicpatch.CreateThreeWayMergePatch(expectedJSON, expectedJSON, existingJSON, patchMeta, true)
+	if err != nil {
+		return nil, "", err
+	}
+	// An empty patch could be in the form of "{}", filter it out to avoid
+	// sending empty patch requests to the API server.
+	if len(patch) == 0 || bytes.Equal(patch, []byte("{}")) {
+		return nil, apitypes.StrategicMergePatchType, nil
+	}
+	return patch, apitypes.StrategicMergePatchType, nil
+}
+
+// createJSONPatch creates a JSON patch that only adds or replaces fields.
+// Remove operations are ignored, because they belong to fields added by
+// Kubernetes or by users after the release resource was applied.
+func createJSONPatch(existingJSON, expectedJSON []byte) ([]byte, error) {
+	ops, err := jsonpatch.CreatePatch(existingJSON, expectedJSON)
+	if err != nil {
+		return nil, err
+	}
+	patchOps := make([]jsonpatch.JsonPatchOperation, 0)
+	for _, op := range ops {
+		if op.Operation != "remove" && !(op.Operation == "add" && op.Value == nil) {
+			patchOps = append(patchOps, op)
+		}
+	}
+	if len(patchOps) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(patchOps)
+}
+
 // UninstallRelease performs a Helm release uninstall.
+//
+// The history of the release is kept until IsUninstalled finds its resources
+// deleted, so uninstalling an already uninstalled release returns it without
+// error. A release that was never installed returns driver.ErrReleaseNotFound.
 func (m manager) UninstallRelease(ctx context.Context, opts ...UninstallOption) (*rpb.Release, error) {
 	uninstall := action.NewUninstall(m.actionConfig)
+	uninstall.KeepHistory = true
 	for _, o := range opts {
 		if err := o(uninstall); err != nil {
 			return nil, fmt.Errorf("failed to apply uninstall option: %w", err)
 		}
 	}
+
+	latest, err := m.latestRelease()
+	if err != nil {
+		return nil, err
+	}
+	if latest.Info != nil && latest.Info.Status == rpb.StatusUninstalled {
+		return latest, nil
+	}
+
 	uninstallResponse, err := uninstall.Run(m.releaseName)
 	if uninstallResponse == nil {
 		return nil, err
 	}
 	return uninstallResponse.Release, err
 }
+
+// IsUninstalled reports whether the release is uninstalled and all of its
+// resources are deleted. Resources annotated to be kept by Helm are not
+// waited for. Once the resources are gone the history of the release is
+// purged.
+func (m manager) IsUninstalled(ctx context.Context) (bool, error) {
+	latest, err := m.latestRelease()
+	if errors.Is(err, driver.ErrReleaseNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if latest.Info == nil || latest.Info.Status != rpb.StatusUninstalled {
+		return false, nil
+	}
+
+	resources, err := m.kubeClient.Build(bytes.NewBufferString(latest.Manifest), false)
+	if err != nil {
+		return false, fmt.Errorf("failed to build resources of uninstalled release: %w", err)
+	}
+	for _, info := range resources {
+		if accessor, err := meta.Accessor(info.Object); err == nil &&
+			accessor.GetAnnotations()[kube.ResourcePolicyAnno] == kube.KeepPolicy {
+			continue
+		}
+		helper := resource.NewHelper(info.Client, info.Mapping)
+		if _, err := helper.Get(info.Namespace, info.Name); err == nil {
+			return false, nil
+		} else if !apierrors.IsNotFound(err) {
+			return false, fmt.Errorf("failed to get resource of uninstalled release: %w", err)
+		}
+	}
+
+	history, err := m.storageBackend.History(m.releaseName)
+	if err != nil && !notFoundErr(err) {
+		return false, fmt.Errorf("failed to retrieve release history: %w", err)
+	}
+	for _, rel := range history {
+		if _, err := m.storageBackend.Delete(rel.Name, rel.Version); err != nil && !notFoundErr(err) {
+			return false, fmt.Errorf("failed to purge release history: %w", err)
+		}
+	}
+	return true, nil
+}
+
+// latestRelease returns the most recent revision of the release, whatever its
+// status.
+func (m manager) latestRelease() (*rpb.Release, error) {
+	history, err := m.storageBackend.History(m.releaseName)
+	if err != nil && !notFoundErr(err) {
+		return nil, fmt.Errorf("failed to retrieve release history: %w", err)
+	}
+	if len(history) == 0 {
+		return nil, driver.ErrReleaseNotFound
+	}
+	releaseutil.Reverse(history, releaseutil.SortByRevision)
+	return history[0], nil
+}
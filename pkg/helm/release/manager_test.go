@@ -0,0 +1,400 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/action"
+	cpb "helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/kube"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	rpb "helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// failingKubeClient fails the first updates of resources.
+type failingKubeClient struct {
+	kubefake.PrintingKubeClient
+	failures int
+}
+
+func (c *failingKubeClient) Update(original, target kube.ResourceList, force bool) (*kube.Result, error) {
+	if c.failures > 0 {
+		c.failures--
+		return &kube.Result{}, errors.New("update failed")
+	}
+	return c.PrintingKubeClient.Update(original, target, force)
+}
+
+// testManager returns a manager of a deployed release of a memcached chart,
+// whose resources are updated with kubeClient.
+func testManager(t *testing.T, kubeClient kube.Interface) manager {
+	t.Helper()
+	storageBackend := storage.Init(driver.NewMemory())
+	chart := &cpb.Chart{
+		Metadata: &cpb.Metadata{APIVersion: cpb.APIVersionV2, Name: "memcached", Version: "5.3.0"},
+		Templates: []*cpb.File{{
+			Name: "templates/configmap.yaml",
+			Data: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .Release.Name }}\n" +
+				"data:\n  memory: {{ .Values.memory | quote }}\n"),
+		}},
+	}
+	deployed := &rpb.Release{
+		Name:      "cache-sessions-memcached",
+		Namespace: "shop",
+		Version:   1,
+		Chart:     chart,
+		Config:    map[string]interface{}{"memory": "64"},
+		Info:      &rpb.Info{Status: rpb.StatusDeployed},
+	}
+	if err := storageBackend.Create(deployed); err != nil {
+		t.Fatal(err)
+	}
+	return manager{
+		actionConfig: &action.Configuration{
+			Releases:     storageBackend,
+			KubeClient:   kubeClient,
+			Capabilities: chartutil.DefaultCapabilities,
+			Log:          func(_ string, _ ...interface{}) {},
+		},
+		storageBackend:  storageBackend,
+		releaseName:     deployed.Name,
+		namespace:       deployed.Namespace,
+		values:          map[string]interface{}{"memory": "128"},
+		isInstalled:     true,
+		deployedRelease: deployed,
+		chart:           chart,
+		action:          memcachedActions{},
+	}
+}
+
+func TestSyncKeepsUninstalledHistory(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []rpb.Status
+		kept     []int
+	}{
+		{name: "failed", statuses: []rpb.Status{rpb.StatusFailed, rpb.StatusPendingInstall}},
+		{name: "uninstalled", statuses: []rpb.Status{rpb.StatusFailed, rpb.StatusUninstalled}, kept: []int{2}},
+		{name: "uninstalling", statuses: []rpb.Status{rpb.StatusUninstalling}, kept: []int{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := manager{storageBackend: storage.Init(driver.NewMemory()), releaseName: "cache-sessions-redis"}
+			for i, status := range tt.statuses {
+				rel := &rpb.Release{Name: m.releaseName, Version: i + 1, Info: &rpb.Info{Status: status}}
+				if err := m.storageBackend.Create(rel); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := m.Sync(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			history, err := m.storageBackend.History(m.releaseName)
+			if err != nil && !notFoundErr(err) {
+				t.Fatal(err)
+			}
+			var kept []int
+			for _, rel := range history {
+				kept = append(kept, rel.Version)
+			}
+			if !reflect.DeepEqual(kept, tt.kept) {
+				t.Errorf("expected revisions %v to be kept, got %v", tt.kept, kept)
+			}
+			if m.isInstalled {
+				t.Errorf("expected release %s not to be installed", m.releaseName)
+			}
+		})
+	}
+}
+
+func TestInstallReleaseAfterUninstall(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   rpb.Status
+		err      string
+		statuses []rpb.Status
+	}{
+		{
+			name:     "uninstalled",
+			status:   rpb.StatusUninstalled,
+			statuses: []rpb.Status{rpb.StatusSuperseded, rpb.StatusDeployed},
+		},
+		{
+			name:     "deployed",
+			status:   rpb.StatusDeployed,
+			err:      "cannot re-use a name that is still in use",
+			statuses: []rpb.Status{rpb.StatusDeployed},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := testManager(t, &kubefake.PrintingKubeClient{Out: ioutil.Discard})
+			m.deployedRelease.Info.Status = tt.status
+			if err := m.storageBackend.Update(m.deployedRelease); err != nil {
+				t.Fatal(err)
+			}
+
+			installed, err := m.InstallRelease(context.Background())
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if installed.Version != 2 {
+					t.Errorf("expected the release to be reinstalled as revision 2, got %d", installed.Version)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected the installation to fail with %q, got %v", tt.err, err)
+			}
+
+			history, err := m.storageBackend.History(m.releaseName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			releaseutil.SortByRevision(history)
+			var statuses []rpb.Status
+			for _, rel := range history {
+				statuses = append(statuses, rel.Info.Status)
+			}
+			if !reflect.DeepEqual(statuses, tt.statuses) {
+				t.Errorf("expected the revisions of the release to be %v, got %v", tt.statuses, statuses)
+			}
+		})
+	}
+}
+
+func TestUpgradeRelease(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		err      string
+		statuses []rpb.Status
+	}{
+		{
+			name:     "upgraded",
+			statuses: []rpb.Status{rpb.StatusSuperseded, rpb.StatusDeployed},
+		},
+		{
+			name:     "rolled back",
+			failures: 1,
+			err:      "failed to upgrade release",
+			statuses: []rpb.Status{rpb.StatusSuperseded, rpb.StatusFailed, rpb.StatusDeployed},
+		},
+		{
+			name:     "failed rollback",
+			failures: 2,
+			err:      "failed rollback",
+			statuses: []rpb.Status{rpb.StatusDeployed, rpb.StatusSuperseded, rpb.StatusFailed},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubeClient := &failingKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: ioutil.Discard}, failures: tt.failures}
+			m := testManager(t, kubeClient)
+
+			previous, upgraded, err := m.UpgradeRelease(context.Background())
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if previous.Version != 1 || upgraded.Version != 2 {
+					t.Errorf("expected an upgrade from revision 1 to 2, got %d to %d", previous.Version, upgraded.Version)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected the upgrade to fail with %q, got %v", tt.err, err)
+			}
+
+			history, err := m.storageBackend.History(m.releaseName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			releaseutil.SortByRevision(history)
+			var statuses []rpb.Status
+			for _, rel := range history {
+				statuses = append(statuses, rel.Info.Status)
+			}
+			if !reflect.DeepEqual(statuses, tt.statuses) {
+				t.Errorf("expected the revisions of the release to be %v, got %v", tt.statuses, statuses)
+			}
+		})
+	}
+}
+
+func TestCreateJSONPatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		expected string
+		patch    string
+	}{
+		{
+			name:     "unchanged",
+			existing: `{"spec":{"size":1}}`,
+			expected: `{"spec":{"size":1}}`,
+		},
+		{
+			name:     "replaced",
+			existing: `{"spec":{"size":1}}`,
+			expected: `{"spec":{"size":3}}`,
+			patch:    `[{"op":"replace","path":"/spec/size","value":3}]`,
+		},
+		{
+			name:     "added",
+			existing: `{"spec":{"size":1}}`,
+			expected: `{"spec":{"size":1,"storage":"1Gi"}}`,
+			patch:    `[{"op":"add","path":"/spec/storage","value":"1Gi"}]`,
+		},
+		{
+			name:     "removed",
+			existing: `{"spec":{"size":1},"status":{"ready":true}}`,
+			expected: `{"spec":{"size":1}}`,
+		},
+		{
+			name:     "added without value",
+			existing: `{"metadata":{"name":"widget"}}`,
+			expected: `{"metadata":{"name":"widget","creationTimestamp":null}}`,
+		},
+		{
+			name:     "replaced and removed",
+			existing: `{"metadata":{"labels":{"team":"shop"}},"spec":{"size":1}}`,
+			expected: `{"metadata":{"creationTimestamp":null},"spec":{"size":3}}`,
+			patch:    `[{"op":"replace","path":"/spec/size","value":3}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := createJSONPatch([]byte(tt.existing), []byte(tt.expected))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertPatch(t, patch, tt.patch)
+		})
+	}
+}
+
+func TestCreatePatch(t *testing.T) {
+	replicas := func(n int32) *int32 { return &n }
+	deployment := func(n int32, annotations map[string]string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+			ObjectMeta: metav1.ObjectMeta{Name: "cache-sessions-memcached", Namespace: "shop", Annotations: annotations},
+			Spec:       appsv1.DeploymentSpec{Replicas: replicas(n)},
+		}
+	}
+	deploymentMapping := &meta.RESTMapping{GroupVersionKind: appsv1.SchemeGroupVersion.WithKind("Deployment")}
+	widget := func(size int64, status map[string]interface{}) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "example.com/v1",
+			"kind":       "Widget",
+			"metadata":   map[string]interface{}{"name": "cache-sessions-widget", "namespace": "shop"},
+			"spec":       map[string]interface{}{"size": size},
+		}}
+		if status != nil {
+			obj.Object["status"] = status
+		}
+		return obj
+	}
+	widgetMapping := &meta.RESTMapping{GroupVersionKind: widget(1, nil).GroupVersionKind()}
+
+	tests := []struct {
+		name      string
+		existing  runtime.Object
+		expected  *resource.Info
+		patch     string
+		patchType apitypes.PatchType
+	}{
+		{
+			name:      "unchanged Deployment",
+			existing:  deployment(1, map[string]string{"deployment.kubernetes.io/revision": "1"}),
+			expected:  &resource.Info{Object: deployment(1, nil), Mapping: deploymentMapping},
+			patchType: apitypes.StrategicMergePatchType,
+		},
+		{
+			name:      "drifted Deployment",
+			existing:  deployment(0, map[string]string{"deployment.kubernetes.io/revision": "1"}),
+			expected:  &resource.Info{Object: deployment(1, nil), Mapping: deploymentMapping},
+			patch:     `{"spec":{"replicas":1}}`,
+			patchType: apitypes.StrategicMergePatchType,
+		},
+		{
+			name:      "unchanged custom resource",
+			existing:  widget(1, map[string]interface{}{"ready": true}),
+			expected:  &resource.Info{Object: widget(1, nil), Mapping: widgetMapping},
+			patchType: apitypes.JSONPatchType,
+		},
+		{
+			name:      "drifted custom resource",
+			existing:  widget(3, map[string]interface{}{"ready": true}),
+			expected:  &resource.Info{Object: widget(1, nil), Mapping: widgetMapping},
+			patch:     `[{"op":"replace","path":"/spec/size","value":1}]`,
+			patchType: apitypes.JSONPatchType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, patchType, err := createPatch(tt.existing, tt.expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if patchType != tt.patchType {
+				t.Errorf("expected a patch of type %s, got %s", tt.patchType, patchType)
+			}
+			assertPatch(t, patch, tt.patch)
+		})
+	}
+}
+
+// assertPatch checks that patch is the JSON document expected, or nil when
+// expected is empty.
+func assertPatch(t *testing.T, patch []byte, expected string) {
+	t.Helper()
+	if expected == "" {
+		if patch != nil {
+			t.Fatalf("expected no patch, got %s", patch)
+		}
+		return
+	}
+	var actualDoc, expectedDoc interface{}
+	if err := json.Unmarshal(patch, &actualDoc); err != nil {
+		t.Fatalf("expected patch %s, got %s: %v", expected, patch, err)
+	}
+	if err := json.Unmarshal([]byte(expected), &expectedDoc); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actualDoc, expectedDoc) {
+		t.Fatalf("expected patch %s, got %s", expected, patch)
+	}
+}
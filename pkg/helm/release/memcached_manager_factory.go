@@ -17,11 +17,8 @@ limitations under the License.
 package release
 
 import (
-	"fmt"
-
-	cloudshipv1alpha1 "github.com/ToucanSoftware/cloudship-operator/api/v1alpha1"
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
 	"helm.sh/helm/v3/pkg/cli"
-	corev1 "k8s.io/api/core/v1"
 	crmanager "sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
@@ -32,22 +29,31 @@ const (
 
 var memcachedValues map[string]interface{} = map[string]interface{}{}
 
+var memcachedConnection = ConnectionSpec{
+	Scheme:   "memcached",
+	PortName: "memcache",
+}
+
 type memcachedActions struct{}
 
 func (e memcachedActions) PreInstalacion() map[string]interface{} {
 	return memcachedValues
 }
 
-func (e memcachedActions) EnvVars(as *cloudshipv1alpha1.Application) []corev1.EnvVar {
+func (e memcachedActions) Connection(rel RenderedRelease) (*cloudshipv1beta1.ConnectionDetails, error) {
+	return memcachedConnection.ConnectionDetails(rel)
+}
+
+func (e memcachedActions) CredentialKeys() []string {
 	return nil
 }
 
-func (e memcachedActions) Port() string {
-	return "11211"
+func (e memcachedActions) CredentialValues(secretName string) map[string]interface{} {
+	return nil
 }
 
-func (e memcachedActions) Hostname(as *cloudshipv1alpha1.Application) string {
-	return fmt.Sprintf("cache-memcached.%s.svc.cluster.local", as.GetName())
+func (e memcachedActions) PasswordKey() string {
+	return ""
 }
 
 // NewMemecachedManagerFactory returns a new Helm manager factory capable of installing and uninstalling Memcached releases.
@@ -17,9 +17,8 @@ limitations under the License.
 package release
 
 import (
-	cloudshipv1alpha1 "github.com/ToucanSoftware/cloudship-operator/api/v1alpha1"
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
 	"helm.sh/helm/v3/pkg/cli"
-	corev1 "k8s.io/api/core/v1"
 
 	crmanager "sigs.k8s.io/controller-runtime/pkg/manager"
 )
@@ -27,9 +26,25 @@ import (
 const (
 	mysqlChartName    string = "mysql"
 	mysqlChartVersion string = "8.5.1"
+
+	mysqlRootPasswordKey        string = "mysql-root-password"
+	mysqlPasswordKey            string = "mysql-password"
+	mysqlReplicationPasswordKey string = "mysql-replication-password"
 )
 
-var mysqlValues map[string]interface{} = map[string]interface{}{}
+var mysqlValues map[string]interface{} = map[string]interface{}{
+	"auth": map[string]interface{}{
+		"database": "cloudship",
+		"username": "cloudship",
+	},
+}
+
+var mysqlConnection = ConnectionSpec{
+	Scheme:        "mysql",
+	PortName:      "mysql",
+	UsernameValue: "auth.username",
+	DatabaseValue: "auth.database",
+}
 
 type mysqlAction struct{}
 
@@ -37,16 +52,32 @@ func (e mysqlAction) PreInstalacion() map[string]interface{} {
 	return mysqlValues
 }
 
-func (e mysqlAction) EnvVars(as *cloudshipv1alpha1.Application) []corev1.EnvVar {
-	return nil
+func (e mysqlAction) Connection(rel RenderedRelease) (*cloudshipv1beta1.ConnectionDetails, error) {
+	return mysqlConnection.ConnectionDetails(rel)
+}
+
+func (e mysqlAction) CredentialKeys() []string {
+	return []string{mysqlRootPasswordKey, mysqlPasswordKey, mysqlReplicationPasswordKey}
+}
+
+func (e mysqlAction) CredentialValues(secretName string) map[string]interface{} {
+	return map[string]interface{}{
+		"auth": map[string]interface{}{
+			"existingSecret": secretName,
+		},
+	}
+}
+
+func (e mysqlAction) PasswordKey() string {
+	return mysqlPasswordKey
 }
 
-func (e mysqlAction) Port() string {
-	return ""
+func (e mysqlAction) AdminUsername() string {
+	return "root"
 }
 
-func (e mysqlAction) Hostname(as *cloudshipv1alpha1.Application) string {
-	return ""
+func (e mysqlAction) AdminPasswordKey() string {
+	return mysqlRootPasswordKey
 }
 
 // NewMySQLManagerFactory returns a new Helm manager factory capable of installing and uninstalling MySQL releases.
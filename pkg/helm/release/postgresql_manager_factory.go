@@ -17,11 +17,8 @@ limitations under the License.
 package release
 
 import (
-	"fmt"
-
-	cloudshipv1alpha1 "github.com/ToucanSoftware/cloudship-operator/api/v1alpha1"
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
 	"helm.sh/helm/v3/pkg/cli"
-	corev1 "k8s.io/api/core/v1"
 
 	crmanager "sigs.k8s.io/controller-runtime/pkg/manager"
 )
@@ -29,47 +26,54 @@ import (
 const (
 	postgresqlChartName    string = "postgresql"
 	postgresqlChartVersion string = "10.3.13"
+
+	postgresqlPasswordKey         string = "postgresql-password"
+	postgresqlPostgresPasswordKey string = "postgresql-postgres-password"
 )
 
 var postgresqlValues map[string]interface{} = map[string]interface{}{
-	"postgresqlPassword": "123456",
 	"postgresqlDatabase": "cloudship",
 	"postgresqlUsername": "cloudship",
 }
 
+var postgresqlConnection = ConnectionSpec{
+	Scheme:        "postgresql",
+	PortName:      "tcp-postgresql",
+	UsernameValue: "postgresqlUsername",
+	DatabaseValue: "postgresqlDatabase",
+	TLSValue:      "tls.enabled",
+}
+
 type postgresqlAction struct{}
 
 func (e postgresqlAction) PreInstalacion() map[string]interface{} {
 	return postgresqlValues
 }
 
-func (e postgresqlAction) EnvVars(as *cloudshipv1alpha1.Application) []corev1.EnvVar {
-	return []corev1.EnvVar{
-		{
-			Name:  "DATABASE_NAME",
-			Value: "cloudship",
-		},
-		{
-			Name:  "DATABASE_HOST",
-			Value: e.Hostname(as),
-		},
-		{
-			Name:  "DATABASE_PORT",
-			Value: e.Port(),
-		},
-		{
-			Name:  "DATABASE_USERNAME",
-			Value: "cloudship",
-		},
+func (e postgresqlAction) Connection(rel RenderedRelease) (*cloudshipv1beta1.ConnectionDetails, error) {
+	return postgresqlConnection.ConnectionDetails(rel)
+}
+
+func (e postgresqlAction) CredentialKeys() []string {
+	return []string{postgresqlPasswordKey, postgresqlPostgresPasswordKey}
+}
+
+func (e postgresqlAction) CredentialValues(secretName string) map[string]interface{} {
+	return map[string]interface{}{
+		"existingSecret": secretName,
 	}
 }
 
-func (e postgresqlAction) Port() string {
-	return "5432"
+func (e postgresqlAction) PasswordKey() string {
+	return postgresqlPasswordKey
+}
+
+func (e postgresqlAction) AdminUsername() string {
+	return "postgres"
 }
 
-func (e postgresqlAction) Hostname(as *cloudshipv1alpha1.Application) string {
-	return fmt.Sprintf("db-postgresql-headless.%s.svc.cluster.local", as.GetName())
+func (e postgresqlAction) AdminPasswordKey() string {
+	return postgresqlPostgresPasswordKey
 }
 
 // NewPostgreSQLManagerFactory returns a new Helm manager factory capable of installing and uninstalling PostgreSQL releases.
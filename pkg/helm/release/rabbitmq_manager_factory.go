@@ -17,11 +17,8 @@ limitations under the License.
 package release
 
 import (
-	"fmt"
-
-	cloudshipv1alpha1 "github.com/ToucanSoftware/cloudship-operator/api/v1alpha1"
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
 	"helm.sh/helm/v3/pkg/cli"
-	corev1 "k8s.io/api/core/v1"
 
 	crmanager "sigs.k8s.io/controller-runtime/pkg/manager"
 )
@@ -29,32 +26,51 @@ import (
 const (
 	rabbitMQChartName    string = "rabbitmq"
 	rabbitMQChartVersion string = "8.11.4"
+
+	rabbitMQPasswordKey     string = "rabbitmq-password"
+	rabbitMQErlangCookieKey string = "rabbitmq-erlang-cookie"
 )
 
 var rabbitMQValues map[string]interface{} = map[string]interface{}{
 	"auth": map[string]interface{}{
-		"username":     "user",
-		"password":     "clouldship",
-		"erlangCookie": "1234567890",
+		"username": "user",
 	},
 }
 
+var rabbitMQConnection = ConnectionSpec{
+	Scheme:        "amqp",
+	TLSScheme:     "amqps",
+	PortName:      "amqp",
+	TLSPortName:   "amqp-ssl",
+	UsernameValue: "auth.username",
+	TLSValue:      "auth.tls.enabled",
+}
+
 type rabbitAction struct{}
 
 func (e rabbitAction) PreInstalacion() map[string]interface{} {
 	return rabbitMQValues
 }
 
-func (e rabbitAction) EnvVars(as *cloudshipv1alpha1.Application) []corev1.EnvVar {
-	return nil
+func (e rabbitAction) Connection(rel RenderedRelease) (*cloudshipv1beta1.ConnectionDetails, error) {
+	return rabbitMQConnection.ConnectionDetails(rel)
 }
 
-func (e rabbitAction) Port() string {
-	return ""
+func (e rabbitAction) CredentialKeys() []string {
+	return []string{rabbitMQPasswordKey, rabbitMQErlangCookieKey}
+}
+
+func (e rabbitAction) CredentialValues(secretName string) map[string]interface{} {
+	return map[string]interface{}{
+		"auth": map[string]interface{}{
+			"existingPasswordSecret": secretName,
+			"existingErlangSecret":   secretName,
+		},
+	}
 }
 
-func (e rabbitAction) Hostname(as *cloudshipv1alpha1.Application) string {
-	return fmt.Sprintf("stream-rabbitmq-headless.%s.svc.cluster.local", as.GetName())
+func (e rabbitAction) PasswordKey() string {
+	return rabbitMQPasswordKey
 }
 
 // NewRabbitMQManagerFactory returns a new Helm manager factory capable of installing and uninstalling Memcached releases.
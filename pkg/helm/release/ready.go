@@ -0,0 +1,106 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// IsReady reports whether the workloads of the deployed release are ready.
+// When they are not, the message names the first workload that is not ready.
+func (m manager) IsReady(ctx context.Context) (bool, string, error) {
+	deployedRelease, err := m.getDeployedRelease()
+	if err != nil {
+		return false, "", err
+	}
+	resources, err := m.kubeClient.Build(bytes.NewBufferString(deployedRelease.Manifest), false)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to build release resources: %w", err)
+	}
+	for _, info := range resources {
+		kind := info.Mapping.GroupVersionKind.Kind
+		if info.Mapping.GroupVersionKind.Group != appsv1.GroupName ||
+			(kind != "Deployment" && kind != "StatefulSet" && kind != "DaemonSet") {
+			continue
+		}
+		helper := resource.NewHelper(info.Client, info.Mapping)
+		obj, err := helper.Get(info.Namespace, info.Name)
+		if apierrors.IsNotFound(err) {
+			return false, fmt.Sprintf("%s %s not found", kind, info.Name), nil
+		}
+		if err != nil {
+			return false, "", fmt.Errorf("failed to get %s %s: %w", kind, info.Name, err)
+		}
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		ready, err := workloadReady(kind, u)
+		if err != nil {
+			return false, "", err
+		}
+		if !ready {
+			return false, fmt.Sprintf("%s %s is not ready", kind, info.Name), nil
+		}
+	}
+	return true, "", nil
+}
+
+// workloadReady reports whether all the replicas of a workload are updated
+// and ready.
+func workloadReady(kind string, u *unstructured.Unstructured) (bool, error) {
+	switch kind {
+	case "Deployment":
+		var d appsv1.Deployment
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &d); err != nil {
+			return false, err
+		}
+		replicas := replicasOrDefault(d.Spec.Replicas)
+		return d.Status.ObservedGeneration >= d.Generation &&
+			d.Status.UpdatedReplicas >= replicas && d.Status.AvailableReplicas >= replicas, nil
+	case "StatefulSet":
+		var s appsv1.StatefulSet
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &s); err != nil {
+			return false, err
+		}
+		replicas := replicasOrDefault(s.Spec.Replicas)
+		return s.Status.ObservedGeneration >= s.Generation && s.Status.ReadyReplicas >= replicas, nil
+	case "DaemonSet":
+		var ds appsv1.DaemonSet
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &ds); err != nil {
+			return false, err
+		}
+		return ds.Status.ObservedGeneration >= ds.Generation &&
+			ds.Status.NumberReady >= ds.Status.DesiredNumberScheduled, nil
+	}
+	return true, nil
+}
+
+func replicasOrDefault(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
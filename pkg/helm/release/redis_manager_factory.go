@@ -17,11 +17,8 @@ limitations under the License.
 package release
 
 import (
-	"fmt"
-
-	cloudshipv1alpha1 "github.com/ToucanSoftware/cloudship-operator/api/v1alpha1"
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
 	"helm.sh/helm/v3/pkg/cli"
-	corev1 "k8s.io/api/core/v1"
 
 	crmanager "sigs.k8s.io/controller-runtime/pkg/manager"
 )
@@ -31,26 +28,44 @@ const (
 	redisRepositoryName string = "bitnami"
 	redisChartName      string = "redis"
 	redisChartVersion   string = "12.8.3"
+
+	redisPasswordKey string = "redis-password"
 )
 
 var redisValues map[string]interface{} = map[string]interface{}{}
 
+var redisConnection = ConnectionSpec{
+	Scheme:        "redis",
+	TLSScheme:     "rediss",
+	PortName:      "redis",
+	ServiceSuffix: "-master",
+	TLSValue:      "tls.enabled",
+}
+
 type redisAction struct{}
 
 func (e redisAction) PreInstalacion() map[string]interface{} {
 	return redisValues
 }
 
-func (e redisAction) EnvVars(as *cloudshipv1alpha1.Application) []corev1.EnvVar {
-	return nil
+func (e redisAction) Connection(rel RenderedRelease) (*cloudshipv1beta1.ConnectionDetails, error) {
+	return redisConnection.ConnectionDetails(rel)
 }
 
-func (e redisAction) Port() string {
-	return ""
+func (e redisAction) CredentialKeys() []string {
+	return []string{redisPasswordKey}
+}
+
+func (e redisAction) CredentialValues(secretName string) map[string]interface{} {
+	return map[string]interface{}{
+		"usePassword":               true,
+		"existingSecret":            secretName,
+		"existingSecretPasswordKey": redisPasswordKey,
+	}
 }
 
-func (e redisAction) Hostname(as *cloudshipv1alpha1.Application) string {
-	return fmt.Sprintf(" .%s.svc.cluster.local", as.GetName())
+func (e redisAction) PasswordKey() string {
+	return redisPasswordKey
 }
 
 // NewRedisManagerFactory returns a new Helm manager factory capable of installing and uninstalling Redis releases.
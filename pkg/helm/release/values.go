@@ -0,0 +1,148 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+)
+
+const (
+	// defaultValuesKey is the data key read from ConfigMaps and Secrets when
+	// a values reference does not set one
+	defaultValuesKey string = "values.yaml"
+)
+
+// ResolveValues returns the values set by the user for a backing service.
+// The references in ValuesFrom are read from namespace and merged in order,
+// then the inline Values are merged over them.
+func ResolveValues(ctx context.Context, reader crclient.Reader, namespace string, spec cloudshipv1beta1.HelmValues) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	for _, ref := range spec.ValuesFrom {
+		data, found, err := valuesData(ctx, reader, namespace, ref)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			if ref.Optional {
+				continue
+			}
+			return nil, fmt.Errorf("values key %q not found in %s %s/%s", valuesKey(ref), ref.Kind, namespace, ref.Name)
+		}
+
+		refValues := map[string]interface{}{}
+		if ref.TargetPath == "" {
+			if err := yaml.Unmarshal(data, &refValues); err != nil {
+				return nil, fmt.Errorf("failed to parse values of %s %s/%s: %w", ref.Kind, namespace, ref.Name, err)
+			}
+		} else if refValues, err = valueAtPath(ref.TargetPath, string(data)); err != nil {
+			return nil, fmt.Errorf("invalid target path of %s %s/%s: %w", ref.Kind, namespace, ref.Name, err)
+		}
+		values = mergeMaps(values, refValues)
+	}
+
+	if spec.Values != nil && len(spec.Values.Raw) > 0 {
+		inline := map[string]interface{}{}
+		if err := json.Unmarshal(spec.Values.Raw, &inline); err != nil {
+			return nil, fmt.Errorf("failed to parse values: %w", err)
+		}
+		values = mergeMaps(values, inline)
+	}
+	return values, nil
+}
+
+// valuesData returns the content of the key of the referenced ConfigMap or
+// Secret, and whether it was found.
+func valuesData(ctx context.Context, reader crclient.Reader, namespace string, ref cloudshipv1beta1.ValuesReference) ([]byte, bool, error) {
+	key := k8stypes.NamespacedName{Namespace: namespace, Name: ref.Name}
+	switch ref.Kind {
+	case cloudshipv1beta1.ValuesSourceKindConfigMap:
+		var cm corev1.ConfigMap
+		if err := reader.Get(ctx, key, &cm); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, false, nil
+			}
+			return nil, false, fmt.Errorf("failed to get ConfigMap %s: %w", key, err)
+		}
+		if data, ok := cm.Data[valuesKey(ref)]; ok {
+			return []byte(data), true, nil
+		}
+		data, ok := cm.BinaryData[valuesKey(ref)]
+		return data, ok, nil
+	case cloudshipv1beta1.ValuesSourceKindSecret:
+		var secret corev1.Secret
+		if err := reader.Get(ctx, key, &secret); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, false, nil
+			}
+			return nil, false, fmt.Errorf("failed to get Secret %s: %w", key, err)
+		}
+		data, ok := secret.Data[valuesKey(ref)]
+		return data, ok, nil
+	default:
+		return nil, false, fmt.Errorf("unsupported values kind %q", ref.Kind)
+	}
+}
+
+func valuesKey(ref cloudshipv1beta1.ValuesReference) string {
+	if ref.ValuesKey == "" {
+		return defaultValuesKey
+	}
+	return ref.ValuesKey
+}
+
+// valueAtPath returns the values with value set at the dot separated path.
+func valueAtPath(path string, value string) (map[string]interface{}, error) {
+	keys := strings.Split(path, ".")
+	var out interface{} = value
+	for i := len(keys) - 1; i >= 0; i-- {
+		if keys[i] == "" {
+			return nil, fmt.Errorf("empty key in path %q", path)
+		}
+		out = map[string]interface{}{keys[i]: out}
+	}
+	return out.(map[string]interface{}), nil
+}
+
+// valuesEqual reports whether two sets of values are the same once
+// serialized, so values decoded from the release storage compare equal to
+// the ones built in code.
+func valuesEqual(a, b map[string]interface{}) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	aJSON, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bJSON, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(aJSON, bJSON)
+}
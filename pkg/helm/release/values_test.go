@@ -0,0 +1,194 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+)
+
+// testClient returns a fake client holding objs.
+func testClient(t *testing.T, objs ...client.Object) client.Client {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := cloudshipv1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+func TestResolveValues(t *testing.T) {
+	reader := testClient(t,
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "cache-values", Namespace: "shop"},
+			Data: map[string]string{
+				"values.yaml": "architecture: replication\nmaster:\n  persistence:\n    size: 8Gi\n",
+				"small.yaml":  "master:\n  persistence:\n    size: 1Gi\n",
+				"invalid":     "master: [",
+			},
+			BinaryData: map[string][]byte{"binary.yaml": []byte("metrics:\n  enabled: true\n")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "cache-auth", Namespace: "shop"},
+			Data:       map[string][]byte{"password": []byte("s3cr3t")},
+		},
+	)
+	configMap := func(name, key string) cloudshipv1beta1.ValuesReference {
+		return cloudshipv1beta1.ValuesReference{Kind: cloudshipv1beta1.ValuesSourceKindConfigMap, Name: name, ValuesKey: key}
+	}
+
+	tests := []struct {
+		name   string
+		spec   cloudshipv1beta1.HelmValues
+		values map[string]interface{}
+		err    string
+	}{
+		{
+			name:   "none",
+			values: map[string]interface{}{},
+		},
+		{
+			name: "ConfigMap",
+			spec: cloudshipv1beta1.HelmValues{ValuesFrom: []cloudshipv1beta1.ValuesReference{configMap("cache-values", "")}},
+			values: map[string]interface{}{
+				"architecture": "replication",
+				"master":       map[string]interface{}{"persistence": map[string]interface{}{"size": "8Gi"}},
+			},
+		},
+		{
+			name: "merged in order",
+			spec: cloudshipv1beta1.HelmValues{
+				ValuesFrom: []cloudshipv1beta1.ValuesReference{
+					configMap("cache-values", ""),
+					configMap("cache-values", "small.yaml"),
+					configMap("cache-values", "binary.yaml"),
+					{
+						Kind:       cloudshipv1beta1.ValuesSourceKindSecret,
+						Name:       "cache-auth",
+						ValuesKey:  "password",
+						TargetPath: "auth.password",
+					},
+				},
+				Values: &runtime.RawExtension{Raw: []byte(`{"architecture":"standalone","auth":{"enabled":true}}`)},
+			},
+			values: map[string]interface{}{
+				"architecture": "standalone",
+				"master":       map[string]interface{}{"persistence": map[string]interface{}{"size": "1Gi"}},
+				"metrics":      map[string]interface{}{"enabled": true},
+				"auth":         map[string]interface{}{"enabled": true, "password": "s3cr3t"},
+			},
+		},
+		{
+			name: "optional",
+			spec: cloudshipv1beta1.HelmValues{ValuesFrom: []cloudshipv1beta1.ValuesReference{
+				{Kind: cloudshipv1beta1.ValuesSourceKindSecret, Name: "missing", Optional: true},
+				{Kind: cloudshipv1beta1.ValuesSourceKindConfigMap, Name: "cache-values", ValuesKey: "missing.yaml", Optional: true},
+			}},
+			values: map[string]interface{}{},
+		},
+		{
+			name: "missing object",
+			spec: cloudshipv1beta1.HelmValues{ValuesFrom: []cloudshipv1beta1.ValuesReference{configMap("missing", "")}},
+			err:  `values key "values.yaml" not found in ConfigMap shop/missing`,
+		},
+		{
+			name: "missing key",
+			spec: cloudshipv1beta1.HelmValues{ValuesFrom: []cloudshipv1beta1.ValuesReference{configMap("cache-values", "missing.yaml")}},
+			err:  `values key "missing.yaml" not found in ConfigMap shop/cache-values`,
+		},
+		{
+			name: "invalid document",
+			spec: cloudshipv1beta1.HelmValues{ValuesFrom: []cloudshipv1beta1.ValuesReference{configMap("cache-values", "invalid")}},
+			err:  "failed to parse values of ConfigMap shop/cache-values",
+		},
+		{
+			name: "invalid target path",
+			spec: cloudshipv1beta1.HelmValues{ValuesFrom: []cloudshipv1beta1.ValuesReference{
+				{Kind: cloudshipv1beta1.ValuesSourceKindSecret, Name: "cache-auth", ValuesKey: "password", TargetPath: "auth..password"},
+			}},
+			err: "invalid target path of Secret shop/cache-auth",
+		},
+		{
+			name: "unsupported kind",
+			spec: cloudshipv1beta1.HelmValues{ValuesFrom: []cloudshipv1beta1.ValuesReference{{Kind: "Volume", Name: "cache-values"}}},
+			err:  `unsupported values kind "Volume"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := ResolveValues(context.Background(), reader, "shop", tt.spec)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(values, tt.values) {
+				t.Errorf("expected values %v, got %v", tt.values, values)
+			}
+		})
+	}
+}
+
+func TestValueAtPath(t *testing.T) {
+	tests := []struct {
+		path   string
+		values map[string]interface{}
+	}{
+		{path: "password", values: map[string]interface{}{"password": "s3cr3t"}},
+		{path: "auth.password", values: map[string]interface{}{"auth": map[string]interface{}{"password": "s3cr3t"}}},
+		{path: "a.b.c", values: map[string]interface{}{"a": map[string]interface{}{"b": map[string]interface{}{"c": "s3cr3t"}}}},
+		{path: ""},
+		{path: ".password"},
+		{path: "auth."},
+		{path: "auth..password"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			values, err := valueAtPath(tt.path, "s3cr3t")
+			if tt.values == nil {
+				if err == nil {
+					t.Fatalf("expected path %q to be invalid, got %v", tt.path, values)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(values, tt.values) {
+				t.Errorf("expected values %v, got %v", tt.values, values)
+			}
+		})
+	}
+}
@@ -17,10 +17,11 @@ limitations under the License.
 package types
 
 import (
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 
-	cloudshipv1alpha1 "github.com/ToucanSoftware/cloudship-operator/api/v1alpha1"
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
 )
 
 // An Object is a Kubernetes object.
@@ -30,6 +31,19 @@ type Object interface {
 }
 
 // StatusFor safely returns a typed status block from an application.
-func StatusFor(app *cloudshipv1alpha1.Application) *cloudshipv1alpha1.ApplicationStatus {
-	return &cloudshipv1alpha1.ApplicationStatus{}
+func StatusFor(app *cloudshipv1beta1.Application) *cloudshipv1beta1.ApplicationStatus {
+	return &app.Status
+}
+
+// SetCondition sets a condition in conditions, observed for the current
+// generation of obj. The transition time only changes with the status.
+func SetCondition(conditions *[]metav1.Condition, obj metav1.Object, conditionType string,
+	status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: obj.GetGeneration(),
+		Reason:             reason,
+		Message:            message,
+	})
 }
@@ -0,0 +1,84 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+)
+
+// +kubebuilder:webhook:path=/validate-cloudship-toucansoft-io-v1beta1-application,mutating=false,failurePolicy=fail,sideEffects=None,groups=cloudship.toucansoft.io,resources=applications,verbs=create;update,versions=v1beta1,name=vapplication.cloudship.toucansoft.io,admissionReviewVersions={v1,v1beta1}
+
+// applicationValidator rejects applications with an unsupported cache or
+// event stream, changing the type of one while it keeps its release, and
+// applications whose releases collide with each other or with another
+// release in their namespace.
+type applicationValidator struct {
+	validator
+	decoder *admission.Decoder
+}
+
+// Handle validates the Application of the request.
+func (v *applicationValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	var app cloudshipv1beta1.Application
+	if err := v.decoder.Decode(req, &app); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	// the releases the application installed before the update
+	owned := map[string]bool{}
+	var errs field.ErrorList
+	if req.Operation == admissionv1.Update {
+		if !app.GetDeletionTimestamp().IsZero() {
+			return admission.Allowed("")
+		}
+		var old cloudshipv1beta1.Application
+		if err := v.decoder.DecodeRaw(req.OldObject, &old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		for _, rel := range old.Status.Releases {
+			owned[rel.Name] = true
+		}
+		for _, service := range applicationBackingServices(&old) {
+			owned[service.release] = true
+		}
+		errs = validateChanges(applicationBackingServices(&old), applicationBackingServices(&app))
+	}
+
+	claims, err := v.claimedReleases(ctx, &app, &app)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	for _, service := range applicationBackingServices(&app) {
+		if err := v.validateType(ctx, service.path.Child("type"), service.category, service.serviceType); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := v.validateRelease(ctx, service.releasePath, app.GetName(), service.release, claims, owned[service.release]); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		claims[service.release] = fmt.Sprintf("the %s %s of the application", service.category, service.name)
+	}
+	return response(errs)
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+)
+
+// +kubebuilder:webhook:path=/validate-cloudship-toucansoft-io-v1beta1-resource,mutating=false,failurePolicy=fail,sideEffects=None,groups=cloudship.toucansoft.io,resources=resources,verbs=create;update,versions=v1beta1,name=vresource.cloudship.toucansoft.io,admissionReviewVersions={v1,v1beta1}
+
+// appResourceValidator rejects resources outside the namespace of an
+// application, of an unsupported type, changing their category or type, or
+// whose release is installed by something else.
+type appResourceValidator struct {
+	validator
+	decoder *admission.Decoder
+}
+
+// Handle validates the AppResource of the request.
+func (v *appResourceValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	var appResource cloudshipv1beta1.AppResource
+	if err := v.decoder.Decode(req, &appResource); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	var old *cloudshipv1beta1.AppResource
+	if req.Operation == admissionv1.Update {
+		old = &cloudshipv1beta1.AppResource{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		// let a resource being deleted go, its finalizer must be removed
+		if !appResource.GetDeletionTimestamp().IsZero() {
+			return admission.Allowed("")
+		}
+	}
+
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+	if old != nil {
+		if appResource.Spec.Category != old.Spec.Category {
+			errs = append(errs, field.Forbidden(specPath.Child("category"), "the category of a resource cannot change"))
+		}
+		if appResource.Spec.Type != old.Spec.Type {
+			errs = append(errs, field.Forbidden(specPath.Child("type"), "the type of a resource cannot change"))
+		}
+	}
+	if err := v.validateType(ctx, specPath.Child("type"), appResource.Spec.Category, appResource.Spec.Type); err != nil {
+		errs = append(errs, err)
+	}
+
+	app, err := v.validateApplication(ctx, appResource.GetNamespace())
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if app == nil || old != nil {
+		return response(errs)
+	}
+	// the release is named after the resource
+	claims, claimsErr := v.claimedReleases(ctx, app, &appResource)
+	if claimsErr != nil {
+		return admission.Errored(http.StatusInternalServerError, claimsErr)
+	}
+	if err := v.validateRelease(ctx, field.NewPath("metadata", "name"), appResource.GetNamespace(),
+		appResource.GetName(), claims, false); err != nil {
+		errs = append(errs, err)
+	}
+	return response(errs)
+}
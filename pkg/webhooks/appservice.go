@@ -0,0 +1,242 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+	sqldb "github.com/ToucanSoftware/cloudship-operator/pkg/database"
+)
+
+// +kubebuilder:webhook:path=/mutate-cloudship-toucansoft-io-v1beta1-service,mutating=true,failurePolicy=fail,sideEffects=None,groups=cloudship.toucansoft.io,resources=services,verbs=create;update,versions=v1beta1,name=mservice.cloudship.toucansoft.io,admissionReviewVersions={v1,v1beta1}
+
+// appServiceDefaulter fills in the protocols and names of the ports of the
+// containers, and the port an exposed service routes traffic to.
+type appServiceDefaulter struct {
+	decoder *admission.Decoder
+}
+
+// Handle defaults the AppService of the request.
+func (d *appServiceDefaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	var appService cloudshipv1beta1.AppService
+	if err := d.decoder.Decode(req, &appService); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	defaultAppService(&appService)
+	marshaled, err := json.Marshal(&appService)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// defaultAppService sets the defaults of a service. Ports are named after
+// their protocol and number, as the Service exposing them would name them.
+func defaultAppService(appService *cloudshipv1beta1.AppService) {
+	for i := range appService.Spec.Containers {
+		ports := appService.Spec.Containers[i].Ports
+		for j := range ports {
+			if ports[j].Protocol == nil {
+				protocol := cloudshipv1beta1.TransportProtocolTCP
+				ports[j].Protocol = &protocol
+			}
+			if ports[j].Name == "" {
+				ports[j].Name = fmt.Sprintf("%s-%d", strings.ToLower(string(*ports[j].Protocol)), ports[j].Port)
+			}
+		}
+	}
+	if expose := appService.Spec.Expose; expose != nil && expose.Port == 0 {
+		for _, c := range appService.Spec.Containers {
+			if len(c.Ports) > 0 {
+				expose.Port = c.Ports[0].Port
+				break
+			}
+		}
+	}
+}
+
+// +kubebuilder:webhook:path=/validate-cloudship-toucansoft-io-v1beta1-service,mutating=false,failurePolicy=fail,sideEffects=None,groups=cloudship.toucansoft.io,resources=services,verbs=create;update,versions=v1beta1,name=vservice.cloudship.toucansoft.io,admissionReviewVersions={v1,v1beta1}
+
+// appServiceValidator rejects services with duplicated container or port
+// names, invalid images or an unsupported database, shared databases of a
+// type that cannot be shared or with values or a release name, services
+// changing the isolation of a database, or its type while it keeps its
+// release, or outside the namespace of an application, and
+// services whose database releases collide with another release in the
+// namespace.
+type appServiceValidator struct {
+	validator
+	decoder *admission.Decoder
+}
+
+// Handle validates the AppService of the request.
+func (v *appServiceValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	var appService cloudshipv1beta1.AppService
+	if err := v.decoder.Decode(req, &appService); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	var old *cloudshipv1beta1.AppService
+	if req.Operation == admissionv1.Update {
+		old = &cloudshipv1beta1.AppService{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		// let a service being deleted go, its finalizer must be removed
+		if !appService.GetDeletionTimestamp().IsZero() {
+			return admission.Allowed("")
+		}
+	}
+
+	errs := validateContainers(appService.Spec.Containers, field.NewPath("spec", "containers"))
+	errs = append(errs, validateSharedDatabases(appService.Spec.Databases, field.NewPath("spec", "databases"))...)
+
+	app, err := v.validateApplication(ctx, appService.GetNamespace())
+	if err != nil {
+		errs = append(errs, err)
+	}
+	owned := map[string]bool{}
+	if old != nil {
+		for _, rel := range old.Status.Releases {
+			owned[rel.Name] = true
+		}
+		for _, database := range serviceDatabases(old) {
+			owned[database.release] = true
+		}
+		errs = append(errs, validateChanges(serviceDatabases(old), serviceDatabases(&appService))...)
+	}
+	var databases []backingService
+	for _, database := range serviceDatabases(&appService) {
+		if err := v.validateType(ctx, database.path.Child("type"), database.category, database.serviceType); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		databases = append(databases, database)
+	}
+	if app == nil || len(databases) == 0 {
+		return response(errs)
+	}
+	claims, claimsErr := v.claimedReleases(ctx, app, &appService)
+	if claimsErr != nil {
+		return admission.Errored(http.StatusInternalServerError, claimsErr)
+	}
+	for _, database := range databases {
+		// several databases share the server, which the application installs
+		if database.shared {
+			if releaseRecorded(app.Status.Releases, database.release) {
+				continue
+			}
+			if err := v.validateRelease(ctx, database.releasePath, appService.GetNamespace(), database.release, claims, owned[database.release]); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if err := v.validateRelease(ctx, database.releasePath, appService.GetNamespace(), database.release, claims, owned[database.release]); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		claims[database.release] = fmt.Sprintf("the database %s of the service", database.name)
+	}
+	return response(errs)
+}
+
+// validateSharedDatabases checks that the shared databases are of a type
+// whose databases the operator can create, and have no values or release
+// name as the shared servers are installed by the application with the
+// default values.
+func validateSharedDatabases(databases []cloudshipv1beta1.DatabaseSpec, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	for i, database := range databases {
+		if database.Isolation != cloudshipv1beta1.DatabaseIsolationShared {
+			continue
+		}
+		if !sqldb.Supported(database.Type) {
+			errs = append(errs, field.Invalid(path.Index(i).Child("isolation"), database.Isolation,
+				fmt.Sprintf("databases of type %s cannot be shared", database.Type)))
+		}
+		if database.Values != nil {
+			errs = append(errs, field.Forbidden(path.Index(i).Child("values"), "the values of a shared database server cannot be set"))
+		}
+		if len(database.ValuesFrom) > 0 {
+			errs = append(errs, field.Forbidden(path.Index(i).Child("valuesFrom"), "the values of a shared database server cannot be set"))
+		}
+		if database.ReleaseName != "" {
+			errs = append(errs, field.Forbidden(path.Index(i).Child("releaseName"), "the release of a shared database server cannot be named"))
+		}
+	}
+	return errs
+}
+
+// releaseRecorded reports whether a release named name is recorded in
+// releases.
+func releaseRecorded(releases []cloudshipv1beta1.ReleaseStatus, name string) bool {
+	for _, rel := range releases {
+		if rel.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validateContainers checks that the names of the containers and of their
+// ports are unique, as all ports are exposed by the same Service, and that
+// their images are valid references.
+func validateContainers(containers []cloudshipv1beta1.Container, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	names := map[string]bool{}
+	portNames := map[string]bool{}
+	ports := map[string]bool{}
+	for i, c := range containers {
+		if names[c.Name] {
+			errs = append(errs, field.Duplicate(path.Index(i).Child("name"), c.Name))
+		}
+		names[c.Name] = true
+
+		if _, err := reference.ParseNormalizedNamed(c.Image); err != nil {
+			errs = append(errs, field.Invalid(path.Index(i).Child("image"), c.Image, err.Error()))
+		}
+
+		for j, p := range c.Ports {
+			portPath := path.Index(i).Child("ports").Index(j)
+			if p.Name != "" {
+				if portNames[p.Name] {
+					errs = append(errs, field.Duplicate(portPath.Child("name"), p.Name))
+				}
+				portNames[p.Name] = true
+			}
+			protocol := cloudshipv1beta1.TransportProtocolTCP
+			if p.Protocol != nil {
+				protocol = *p.Protocol
+			}
+			port := fmt.Sprintf("%d/%s", p.Port, protocol)
+			if ports[port] {
+				errs = append(errs, field.Duplicate(portPath.Child("port"), port))
+			}
+			ports[port] = true
+		}
+	}
+	return errs
+}
@@ -0,0 +1,310 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+)
+
+func TestDefaultAppService(t *testing.T) {
+	udp := cloudshipv1beta1.TransportProtocolUDP
+	tcp := cloudshipv1beta1.TransportProtocolTCP
+	appService := testAppService("web")
+	appService.Spec.Containers = []cloudshipv1beta1.Container{
+		{Name: "proxy", Image: "envoyproxy/envoy:v1.17.0"},
+		{Name: "web", Image: "nginx:1.19", Ports: []cloudshipv1beta1.Service{
+			{Port: 8080},
+			{Port: 5353, Protocol: &udp},
+			{Name: "metrics", Port: 9090},
+		}},
+	}
+	appService.Spec.Expose = &cloudshipv1beta1.Expose{Hosts: []string{"shop.example.com"}}
+
+	defaultAppService(appService)
+
+	expected := []cloudshipv1beta1.Service{
+		{Name: "tcp-8080", Port: 8080, Protocol: &tcp},
+		{Name: "udp-5353", Port: 5353, Protocol: &udp},
+		{Name: "metrics", Port: 9090, Protocol: &tcp},
+	}
+	if ports := appService.Spec.Containers[1].Ports; !reflect.DeepEqual(ports, expected) {
+		t.Errorf("expected ports %v, got %v", expected, ports)
+	}
+	if port := appService.Spec.Expose.Port; port != 8080 {
+		t.Errorf("expected the exposed port to default to 8080, got %d", port)
+	}
+
+	appService.Spec.Expose.Port = 9090
+	defaultAppService(appService)
+	if port := appService.Spec.Expose.Port; port != 9090 {
+		t.Errorf("expected the exposed port to stay 9090, got %d", port)
+	}
+}
+
+func TestValidateContainers(t *testing.T) {
+	udp := cloudshipv1beta1.TransportProtocolUDP
+	tests := []struct {
+		name       string
+		containers []cloudshipv1beta1.Container
+		fields     []string
+	}{
+		{
+			name: "valid",
+			containers: []cloudshipv1beta1.Container{
+				{Name: "web", Image: "nginx:1.19", Ports: []cloudshipv1beta1.Service{{Name: "http", Port: 80}}},
+				{Name: "dns", Image: "registry.example.com:5000/coredns/coredns@sha256:" +
+					"4a6e0769130686518325b21b0c1d0688b54e7c79244d48e1b15634e98e40c6ef",
+					Ports: []cloudshipv1beta1.Service{{Name: "dns", Port: 80, Protocol: &udp}}},
+			},
+		},
+		{
+			name: "duplicate container name",
+			containers: []cloudshipv1beta1.Container{
+				{Name: "web", Image: "nginx:1.19"},
+				{Name: "web", Image: "nginx:1.19"},
+			},
+			fields: []string{"spec.containers[1].name"},
+		},
+		{
+			name:       "invalid image",
+			containers: []cloudshipv1beta1.Container{{Name: "web", Image: "Nginx:latest"}},
+			fields:     []string{"spec.containers[0].image"},
+		},
+		{
+			name: "duplicate port name",
+			containers: []cloudshipv1beta1.Container{
+				{Name: "web", Image: "nginx:1.19", Ports: []cloudshipv1beta1.Service{{Name: "http", Port: 80}}},
+				{Name: "api", Image: "nginx:1.19", Ports: []cloudshipv1beta1.Service{{Name: "http", Port: 8080}}},
+			},
+			fields: []string{"spec.containers[1].ports[0].name"},
+		},
+		{
+			name: "duplicate port",
+			containers: []cloudshipv1beta1.Container{
+				{Name: "web", Image: "nginx:1.19", Ports: []cloudshipv1beta1.Service{
+					{Name: "http", Port: 80},
+					{Name: "www", Port: 80},
+				}},
+			},
+			fields: []string{"spec.containers[0].ports[1].port"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertFields(t, validateContainers(tt.containers, field.NewPath("spec", "containers")), tt.fields)
+		})
+	}
+}
+
+func TestValidateSharedDatabases(t *testing.T) {
+	shared := cloudshipv1beta1.DatabaseIsolationShared
+	tests := []struct {
+		name     string
+		database cloudshipv1beta1.DatabaseSpec
+		fields   []string
+	}{
+		{
+			name:     "shared",
+			database: cloudshipv1beta1.DatabaseSpec{Name: "main", Type: cloudshipv1beta1.DatabaseTypeMySQL, Isolation: shared},
+		},
+		{
+			name: "dedicated",
+			database: cloudshipv1beta1.DatabaseSpec{
+				Name:        "main",
+				Type:        "MongoDB",
+				ReleaseName: "db",
+				HelmValues:  cloudshipv1beta1.HelmValues{Values: &runtime.RawExtension{Raw: []byte(`{}`)}},
+			},
+		},
+		{
+			name:     "unsupported type",
+			database: cloudshipv1beta1.DatabaseSpec{Name: "main", Type: "MongoDB", Isolation: shared},
+			fields:   []string{"spec.databases[0].isolation"},
+		},
+		{
+			name: "values",
+			database: cloudshipv1beta1.DatabaseSpec{
+				Name:      "main",
+				Type:      cloudshipv1beta1.DatabaseTypePostgreSQL,
+				Isolation: shared,
+				HelmValues: cloudshipv1beta1.HelmValues{
+					Values: &runtime.RawExtension{Raw: []byte(`{}`)},
+					ValuesFrom: []cloudshipv1beta1.ValuesReference{
+						{Kind: cloudshipv1beta1.ValuesSourceKindSecret, Name: "db-values"},
+					},
+				},
+			},
+			fields: []string{"spec.databases[0].values", "spec.databases[0].valuesFrom"},
+		},
+		{
+			name: "release name",
+			database: cloudshipv1beta1.DatabaseSpec{
+				Name:        "main",
+				Type:        cloudshipv1beta1.DatabaseTypePostgreSQL,
+				Isolation:   shared,
+				ReleaseName: "db",
+			},
+			fields: []string{"spec.databases[0].releaseName"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validateSharedDatabases([]cloudshipv1beta1.DatabaseSpec{tt.database}, field.NewPath("spec", "databases"))
+			assertFields(t, errs, tt.fields)
+		})
+	}
+}
+
+func TestAppServiceValidator(t *testing.T) {
+	shared := cloudshipv1beta1.DatabaseSpec{
+		Name:      "main",
+		Type:      cloudshipv1beta1.DatabaseTypePostgreSQL,
+		Isolation: cloudshipv1beta1.DatabaseIsolationShared,
+	}
+	app := testApplication()
+	app.Status.Releases = []cloudshipv1beta1.ReleaseStatus{
+		{Name: "db-shared-postgresql", Category: cloudshipv1beta1.BackingServiceCategoryDatabase, Type: "PostgreSQL"},
+	}
+	web := testAppService("web", shared)
+	api := testAppService("api", cloudshipv1beta1.DatabaseSpec{Name: "main", Type: cloudshipv1beta1.DatabaseTypeMySQL})
+
+	tests := []struct {
+		name       string
+		app        *cloudshipv1beta1.Application
+		appService *cloudshipv1beta1.AppService
+		old        *cloudshipv1beta1.AppService
+		allowed    bool
+		reason     string
+	}{
+		{
+			name:       "no database",
+			app:        app,
+			appService: testAppService("reports"),
+			allowed:    true,
+		},
+		{
+			name:       "namespace without application",
+			app:        app,
+			appService: &cloudshipv1beta1.AppService{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "blog"}},
+			reason:     "there is no application blog for the namespace",
+		},
+		{
+			name:       "shared server installed for another service",
+			app:        app,
+			appService: testAppService("reports", shared),
+			allowed:    true,
+		},
+		{
+			name:       "shared server not installed yet",
+			app:        testApplication(),
+			appService: testAppService("reports", shared),
+			allowed:    true,
+		},
+		{
+			name: "shared server released by something else",
+			app:  testApplication(),
+			appService: testAppService("reports", cloudshipv1beta1.DatabaseSpec{
+				Name:      "main",
+				Type:      cloudshipv1beta1.DatabaseTypeMySQL,
+				Isolation: cloudshipv1beta1.DatabaseIsolationShared,
+			}),
+			reason: "spec.databases[0].isolation",
+		},
+		{
+			name: "release installed by something else",
+			app:  app,
+			appService: testAppService("reports", cloudshipv1beta1.DatabaseSpec{
+				Name: "main",
+				Type: cloudshipv1beta1.DatabaseTypePostgreSQL,
+			}),
+			reason: "release db-reports-main-postgresql is already installed in namespace shop",
+		},
+		{
+			name: "dedicated database named after another service's release",
+			app:  app,
+			appService: testAppService("reports", cloudshipv1beta1.DatabaseSpec{
+				Name:        "main",
+				Type:        cloudshipv1beta1.DatabaseTypeMySQL,
+				ReleaseName: "db-api-main-mysql",
+			}),
+			reason: "spec.databases[0].releaseName",
+		},
+		{
+			name:       "unsupported database",
+			app:        app,
+			appService: testAppService("reports", cloudshipv1beta1.DatabaseSpec{Name: "main", Type: "MongoDB"}),
+			reason:     "spec.databases[0].type",
+		},
+		{
+			name: "releases colliding in the service",
+			app:  app,
+			appService: testAppService("reports",
+				cloudshipv1beta1.DatabaseSpec{Name: "main", Type: cloudshipv1beta1.DatabaseTypeMySQL},
+				cloudshipv1beta1.DatabaseSpec{Name: "main", Type: cloudshipv1beta1.DatabaseTypeMySQL},
+			),
+			reason: "spec.databases[1].name",
+		},
+		{
+			name:       "update keeping its own release",
+			app:        app,
+			appService: api.DeepCopy(),
+			old:        api.DeepCopy(),
+			allowed:    true,
+		},
+		{
+			name:       "database replaced by another type",
+			app:        app,
+			appService: testAppService("api", cloudshipv1beta1.DatabaseSpec{Name: "main", Type: cloudshipv1beta1.DatabaseTypePostgreSQL}),
+			old:        api.DeepCopy(),
+			allowed:    true,
+		},
+		{
+			name: "isolation changed",
+			app:  app,
+			appService: testAppService("api", cloudshipv1beta1.DatabaseSpec{
+				Name:      "main",
+				Type:      cloudshipv1beta1.DatabaseTypeMySQL,
+				Isolation: cloudshipv1beta1.DatabaseIsolationShared,
+			}),
+			old:    api.DeepCopy(),
+			reason: "the isolation of Database main cannot change",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &appServiceValidator{
+				validator: testValidator(t, tt.app.DeepCopy(), web.DeepCopy(), api.DeepCopy(),
+					helmRelease("shop", "db-shared-mysql"), helmRelease("shop", "db-reports-main-postgresql")),
+				decoder: testDecoder(t),
+			}
+			req := admissionRequest(t, tt.appService, nil)
+			if tt.old != nil {
+				req = admissionRequest(t, tt.appService, tt.old)
+			}
+			resp := v.Handle(context.Background(), req)
+			assertAllowed(t, resp, tt.allowed, tt.reason)
+		})
+	}
+}
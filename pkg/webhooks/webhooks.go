@@ -0,0 +1,284 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package webhooks implements the admission and conversion webhooks of the
+// cloudship resources. The admission webhooks default AppServices and reject
+// resources the operator would fail to reconcile, so that users find the
+// problem when they apply the resource instead of in the operator logs.
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+	"github.com/ToucanSoftware/cloudship-operator/pkg/helm/release"
+)
+
+const (
+	mutateAppServicePath    = "/mutate-cloudship-toucansoft-io-v1beta1-service"
+	validateAppServicePath  = "/validate-cloudship-toucansoft-io-v1beta1-service"
+	validateApplicationPath = "/validate-cloudship-toucansoft-io-v1beta1-application"
+	validateAppResourcePath = "/validate-cloudship-toucansoft-io-v1beta1-resource"
+	helmReleaseOwnerLabel   = "owner"
+	helmReleaseOwner        = "helm"
+	helmReleaseNameLabel    = "name"
+)
+
+// SetupWithManager registers the admission and conversion webhooks with the
+// webhook server of the manager.
+func SetupWithManager(mgr ctrl.Manager, catalog release.Catalog) error {
+	decoder, err := admission.NewDecoder(mgr.GetScheme())
+	if err != nil {
+		return err
+	}
+	v := validator{Client: mgr.GetClient(), Catalog: catalog}
+
+	// v1alpha1 objects are converted to and from v1beta1, the storage version
+	for _, hub := range []client.Object{
+		&cloudshipv1beta1.Application{},
+		&cloudshipv1beta1.AppService{},
+		&cloudshipv1beta1.AppResource{},
+		&cloudshipv1beta1.BackingServiceClass{},
+	} {
+		if err := ctrl.NewWebhookManagedBy(mgr).For(hub).Complete(); err != nil {
+			return err
+		}
+	}
+
+	server := mgr.GetWebhookServer()
+	server.Register(mutateAppServicePath, &webhook.Admission{Handler: &appServiceDefaulter{decoder: decoder}})
+	server.Register(validateAppServicePath, &webhook.Admission{Handler: &appServiceValidator{validator: v, decoder: decoder}})
+	server.Register(validateApplicationPath, &webhook.Admission{Handler: &applicationValidator{validator: v, decoder: decoder}})
+	server.Register(validateAppResourcePath, &webhook.Admission{Handler: &appResourceValidator{validator: v, decoder: decoder}})
+	return nil
+}
+
+// validator holds the checks shared by the validating webhooks.
+type validator struct {
+	client.Client
+	Catalog release.Catalog
+}
+
+// validateApplication checks that the namespace belongs to an application.
+func (v validator) validateApplication(ctx context.Context, namespace string) (*cloudshipv1beta1.Application, *field.Error) {
+	var app cloudshipv1beta1.Application
+	if err := v.Get(ctx, client.ObjectKey{Name: namespace}, &app); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, field.Invalid(field.NewPath("metadata", "namespace"), namespace,
+				fmt.Sprintf("there is no application %s for the namespace", namespace))
+		}
+		return nil, field.InternalError(field.NewPath("metadata", "namespace"), err)
+	}
+	return &app, nil
+}
+
+// validateType checks that the type of a backing service is supported.
+func (v validator) validateType(ctx context.Context, path *field.Path, category cloudshipv1beta1.BackingServiceCategory,
+	serviceType string) *field.Error {
+	if _, err := v.Catalog.ManagerFactory(ctx, category, serviceType); err != nil {
+		return field.Invalid(path, serviceType, err.Error())
+	}
+	return nil
+}
+
+// claimedReleases returns the releases the application and the services and
+// resources in its namespace install, keyed by name, with a description of
+// the resource installing them. skip leaves a resource out, the one being
+// validated.
+func (v validator) claimedReleases(ctx context.Context, app *cloudshipv1beta1.Application, skip client.Object) (map[string]string, error) {
+	claims := map[string]string{}
+	if !isSameObject(app, skip) {
+		for _, rel := range app.Status.Releases {
+			claims[rel.Name] = fmt.Sprintf("application %s", app.GetName())
+		}
+		for _, service := range applicationBackingServices(app) {
+			claims[service.release] = fmt.Sprintf("the %s %s of application %s", service.category, service.name, app.GetName())
+		}
+	}
+
+	var appServices cloudshipv1beta1.AppServiceList
+	if err := v.List(ctx, &appServices, client.InNamespace(app.GetName())); err != nil {
+		return nil, err
+	}
+	for i := range appServices.Items {
+		appService := &appServices.Items[i]
+		if isSameObject(appService, skip) {
+			continue
+		}
+		for _, rel := range appService.Status.Releases {
+			claims[rel.Name] = fmt.Sprintf("service %s", appService.GetName())
+		}
+		for _, database := range serviceDatabases(appService) {
+			if database.shared {
+				continue
+			}
+			claims[database.release] = fmt.Sprintf("the database %s of service %s", database.name, appService.GetName())
+		}
+	}
+
+	var appResources cloudshipv1beta1.AppResourceList
+	if err := v.List(ctx, &appResources, client.InNamespace(app.GetName())); err != nil {
+		return nil, err
+	}
+	for i := range appResources.Items {
+		appResource := &appResources.Items[i]
+		if isSameObject(appResource, skip) {
+			continue
+		}
+		claims[appResource.GetName()] = fmt.Sprintf("resource %s", appResource.GetName())
+	}
+	return claims, nil
+}
+
+// validateRelease checks that no other resource installs a release with the
+// same name in the namespace, and that there is no release of that name
+// installed by something else than cloudship. owned is set when the resource
+// being validated already installed the release.
+func (v validator) validateRelease(ctx context.Context, path *field.Path, namespace, name string,
+	claims map[string]string, owned bool) *field.Error {
+	if claim, ok := claims[name]; ok {
+		return field.Invalid(path, name, fmt.Sprintf("release %s is already installed for %s", name, claim))
+	}
+	if owned {
+		return nil
+	}
+	var secrets corev1.SecretList
+	if err := v.List(ctx, &secrets, client.InNamespace(namespace),
+		client.MatchingLabels{helmReleaseOwnerLabel: helmReleaseOwner, helmReleaseNameLabel: name}); err != nil {
+		return field.InternalError(path, err)
+	}
+	if len(secrets.Items) > 0 {
+		return field.Invalid(path, name, fmt.Sprintf("release %s is already installed in namespace %s", name, namespace))
+	}
+	return nil
+}
+
+// backingService is a named cache, event stream or database of an
+// application or a service. The release of a shared database is the shared
+// server the application installs. releasePath is the field the name of the
+// release comes from.
+type backingService struct {
+	path        *field.Path
+	releasePath *field.Path
+	name        string
+	category    cloudshipv1beta1.BackingServiceCategory
+	serviceType string
+	release     string
+	shared      bool
+}
+
+// newBackingService returns the backing service at path. Its release is
+// named in releaseName, or else derived from its name.
+func newBackingService(path *field.Path, name string, category cloudshipv1beta1.BackingServiceCategory,
+	serviceType, releaseName, release string) backingService {
+	releasePath := path.Child("name")
+	if releaseName != "" {
+		releasePath = path.Child("releaseName")
+	}
+	return backingService{
+		path:        path,
+		releasePath: releasePath,
+		name:        name,
+		category:    category,
+		serviceType: serviceType,
+		release:     release,
+	}
+}
+
+func applicationBackingServices(app *cloudshipv1beta1.Application) []backingService {
+	var services []backingService
+	for i := range app.Spec.Caches {
+		cache := &app.Spec.Caches[i]
+		services = append(services, newBackingService(field.NewPath("spec", "caches").Index(i), cache.Name,
+			cloudshipv1beta1.BackingServiceCategoryCache, string(cache.Type), cache.ReleaseName, release.CacheReleaseName(cache)))
+	}
+	for i := range app.Spec.EventStreams {
+		eventStream := &app.Spec.EventStreams[i]
+		services = append(services, newBackingService(field.NewPath("spec", "eventStreams").Index(i), eventStream.Name,
+			cloudshipv1beta1.BackingServiceCategoryEventStream, string(eventStream.Type), eventStream.ReleaseName,
+			release.EventStreamReleaseName(eventStream)))
+	}
+	return services
+}
+
+func serviceDatabases(appService *cloudshipv1beta1.AppService) []backingService {
+	var databases []backingService
+	for i := range appService.Spec.Databases {
+		database := &appService.Spec.Databases[i]
+		path := field.NewPath("spec", "databases").Index(i)
+		if database.Isolation == cloudshipv1beta1.DatabaseIsolationShared {
+			shared := newBackingService(path, database.Name, cloudshipv1beta1.BackingServiceCategoryDatabase,
+				string(database.Type), "", release.SharedDatabaseReleaseName(string(database.Type)))
+			shared.releasePath = path.Child("isolation")
+			shared.shared = true
+			databases = append(databases, shared)
+			continue
+		}
+		databases = append(databases, newBackingService(path, database.Name, cloudshipv1beta1.BackingServiceCategoryDatabase,
+			string(database.Type), database.ReleaseName, release.ServiceDatabaseReleaseName(appService.GetName(), database)))
+	}
+	return databases
+}
+
+// validateChanges rejects databases whose isolation changed, as the data of
+// a database does not move between a dedicated and a shared server, and
+// backing services whose type changed while they keep their release. A
+// derived release is named after the type, so a backing service of a new
+// type gets a release of its own, but a release named in releaseName cannot
+// be installed for another chart.
+func validateChanges(old, current []backingService) field.ErrorList {
+	var errs field.ErrorList
+	for _, service := range current {
+		for _, previous := range old {
+			if previous.category != service.category || previous.name != service.name {
+				continue
+			}
+			if previous.serviceType != service.serviceType && previous.release == service.release {
+				errs = append(errs, field.Forbidden(service.path.Child("type"),
+					fmt.Sprintf("the type of %s %s cannot change while it keeps release %s, change its release name to replace it",
+						service.category, service.name, service.release)))
+			}
+			if previous.shared != service.shared {
+				errs = append(errs, field.Forbidden(service.path.Child("isolation"),
+					fmt.Sprintf("the isolation of %s %s cannot change, add one with another name to replace it", service.category, service.name)))
+			}
+		}
+	}
+	return errs
+}
+
+func isSameObject(a, b client.Object) bool {
+	return b != nil && reflect.TypeOf(a) == reflect.TypeOf(b) &&
+		a.GetNamespace() == b.GetNamespace() && a.GetName() == b.GetName()
+}
+
+// response turns the result of a validation into an admission response.
+func response(errs field.ErrorList) admission.Response {
+	if len(errs) == 0 {
+		return admission.Allowed("")
+	}
+	return admission.Denied(errs.ToAggregate().Error())
+}
@@ -0,0 +1,490 @@
+/*
+Copyright 2021 ToucanSoftware.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	cloudshipv1beta1 "github.com/ToucanSoftware/cloudship-operator/api/v1beta1"
+	"github.com/ToucanSoftware/cloudship-operator/pkg/helm/release"
+)
+
+// fakeCatalog knows the built-in backing service types only.
+type fakeCatalog struct{}
+
+func (fakeCatalog) ManagerFactory(_ context.Context, category cloudshipv1beta1.BackingServiceCategory, serviceType string) (release.ManagerFactory, error) {
+	switch serviceType {
+	case "Redis", "Memcached", "Kafka", "RabbitMQ", "PostgreSQL", "MySQL":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("No Manager Factory for %v", serviceType)
+}
+
+func testScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := cloudshipv1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return scheme
+}
+
+// testValidator returns a validator whose client holds objs.
+func testValidator(t *testing.T, objs ...client.Object) validator {
+	t.Helper()
+	return validator{
+		Client:  fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(objs...).Build(),
+		Catalog: fakeCatalog{},
+	}
+}
+
+func testApplication() *cloudshipv1beta1.Application {
+	return &cloudshipv1beta1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: "shop"},
+		Spec: cloudshipv1beta1.ApplicationSpec{
+			Caches:       []cloudshipv1beta1.CacheSpec{{Name: "sessions", Type: cloudshipv1beta1.CacheTypeRedis}},
+			EventStreams: []cloudshipv1beta1.EventStreamSpec{{Name: "events", Type: cloudshipv1beta1.EventStreamTypeKafka}},
+		},
+	}
+}
+
+func testAppService(name string, databases ...cloudshipv1beta1.DatabaseSpec) *cloudshipv1beta1.AppService {
+	return &cloudshipv1beta1.AppService{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "shop"},
+		Spec: cloudshipv1beta1.AppServiceSpec{
+			Containers: []cloudshipv1beta1.Container{{Name: name, Image: "nginx:1.19"}},
+			Databases:  databases,
+		},
+	}
+}
+
+// helmRelease returns the Secret Helm records a release in.
+func helmRelease(namespace, name string) *corev1.Secret {
+	return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Name:      "sh.helm.release.v1." + name + ".v1",
+		Namespace: namespace,
+		Labels:    map[string]string{helmReleaseOwnerLabel: helmReleaseOwner, helmReleaseNameLabel: name},
+	}}
+}
+
+// admissionRequest returns a request to validate obj, replacing old when
+// old is set.
+func admissionRequest(t *testing.T, obj, old client.Object) admission.Request {
+	t.Helper()
+	raw := func(obj client.Object) runtime.RawExtension {
+		gvk, err := apiutil.GVKForObject(obj, testScheme(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		obj.GetObjectKind().SetGroupVersionKind(gvk)
+		data, err := json.Marshal(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return runtime.RawExtension{Raw: data}
+	}
+	req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: admissionv1.Create,
+		Object:    raw(obj),
+	}}
+	if old != nil {
+		req.Operation = admissionv1.Update
+		req.OldObject = raw(old)
+	}
+	return req
+}
+
+func testDecoder(t *testing.T) *admission.Decoder {
+	t.Helper()
+	decoder, err := admission.NewDecoder(testScheme(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoder
+}
+
+// assertAllowed checks whether resp allows the request, and that a denied
+// request names the reason.
+func assertAllowed(t *testing.T, resp admission.Response, allowed bool, reason string) {
+	t.Helper()
+	if resp.Allowed != allowed {
+		t.Fatalf("expected allowed to be %v, got %v: %v", allowed, resp.Allowed, resp.Result)
+	}
+	if !allowed && !strings.Contains(string(resp.Result.Reason), reason) {
+		t.Fatalf("expected the request to be denied because of %q, got %q", reason, resp.Result.Reason)
+	}
+}
+
+func TestClaimedReleases(t *testing.T) {
+	app := testApplication()
+	app.Status.Releases = []cloudshipv1beta1.ReleaseStatus{
+		{Name: "cache-pages-memcached", Category: cloudshipv1beta1.BackingServiceCategoryCache, Type: "Memcached", Retained: true},
+	}
+	web := testAppService("web", cloudshipv1beta1.DatabaseSpec{Name: "main", Type: cloudshipv1beta1.DatabaseTypePostgreSQL})
+	web.Status.Releases = []cloudshipv1beta1.ReleaseStatus{
+		{Name: "db-web-old-mysql", Category: cloudshipv1beta1.BackingServiceCategoryDatabase, Type: "MySQL"},
+	}
+	reports := testAppService("reports", cloudshipv1beta1.DatabaseSpec{
+		Name:      "main",
+		Type:      cloudshipv1beta1.DatabaseTypePostgreSQL,
+		Isolation: cloudshipv1beta1.DatabaseIsolationShared,
+	})
+	bucket := &cloudshipv1beta1.AppResource{ObjectMeta: metav1.ObjectMeta{Name: "bucket", Namespace: "shop"}}
+	other := testAppService("api", cloudshipv1beta1.DatabaseSpec{Name: "main", Type: cloudshipv1beta1.DatabaseTypeMySQL})
+	other.Namespace = "blog"
+	v := testValidator(t, app, web, reports, bucket, other)
+
+	tests := []struct {
+		name       string
+		skip       client.Object
+		claimed    []string
+		notClaimed []string
+	}{
+		{
+			name: "all",
+			claimed: []string{"cache-sessions-redis", "stream-events-kafka", "cache-pages-memcached",
+				"db-web-main-postgresql", "db-web-old-mysql", "bucket"},
+			notClaimed: []string{"db-shared-postgresql", "db-api-main-mysql"},
+		},
+		{
+			name:       "skip application",
+			skip:       app,
+			claimed:    []string{"db-web-main-postgresql", "bucket"},
+			notClaimed: []string{"cache-sessions-redis", "stream-events-kafka", "cache-pages-memcached"},
+		},
+		{
+			name:       "skip service",
+			skip:       web,
+			claimed:    []string{"cache-sessions-redis", "bucket"},
+			notClaimed: []string{"db-web-main-postgresql", "db-web-old-mysql"},
+		},
+		{
+			name:       "skip resource",
+			skip:       bucket,
+			claimed:    []string{"db-web-main-postgresql"},
+			notClaimed: []string{"bucket"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.claimedReleases(context.Background(), app, tt.skip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range tt.claimed {
+				if _, ok := claims[name]; !ok {
+					t.Errorf("expected release %s to be claimed, got %v", name, claims)
+				}
+			}
+			for _, name := range tt.notClaimed {
+				if claim, ok := claims[name]; ok {
+					t.Errorf("expected release %s not to be claimed, got it claimed by %s", name, claim)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateRelease(t *testing.T) {
+	v := testValidator(t, helmRelease("shop", "cache-legacy"), helmRelease("blog", "cache-blog"))
+	claims := map[string]string{"db-web-main-postgresql": "the database main of service web"}
+	path := field.NewPath("spec", "caches").Index(0).Child("name")
+
+	tests := []struct {
+		name    string
+		release string
+		owned   bool
+		reason  string
+	}{
+		{name: "free", release: "cache-sessions-redis"},
+		{name: "claimed", release: "db-web-main-postgresql", reason: "is already installed for the database main of service web"},
+		{name: "claimed and owned", release: "db-web-main-postgresql", owned: true, reason: "is already installed for the database main of service web"},
+		{name: "installed by something else", release: "cache-legacy", reason: "is already installed in namespace shop"},
+		{name: "owned", release: "cache-legacy", owned: true},
+		{name: "installed in another namespace", release: "cache-blog"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.validateRelease(context.Background(), path, "shop", tt.release, claims, tt.owned)
+			if tt.reason == "" {
+				if err != nil {
+					t.Fatalf("expected release %s to be accepted, got %v", tt.release, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.reason) {
+				t.Fatalf("expected release %s to be rejected because it %s, got %v", tt.release, tt.reason, err)
+			}
+		})
+	}
+}
+
+func TestValidateChanges(t *testing.T) {
+	database := func(databaseType cloudshipv1beta1.DatabaseType, isolation cloudshipv1beta1.DatabaseIsolation,
+		releaseName string) *cloudshipv1beta1.AppService {
+		return testAppService("web", cloudshipv1beta1.DatabaseSpec{
+			Name:        "main",
+			Type:        databaseType,
+			Isolation:   isolation,
+			ReleaseName: releaseName,
+		})
+	}
+	dedicated := cloudshipv1beta1.DatabaseIsolationDedicated
+	shared := cloudshipv1beta1.DatabaseIsolationShared
+
+	tests := []struct {
+		name    string
+		old     *cloudshipv1beta1.AppService
+		current *cloudshipv1beta1.AppService
+		fields  []string
+	}{
+		{
+			name:    "unchanged",
+			old:     database("PostgreSQL", dedicated, ""),
+			current: database("PostgreSQL", "", ""),
+		},
+		{
+			name:    "type of derived release",
+			old:     database("PostgreSQL", dedicated, ""),
+			current: database("MySQL", dedicated, ""),
+		},
+		{
+			name:    "type of named release",
+			old:     database("PostgreSQL", dedicated, "db"),
+			current: database("MySQL", dedicated, "db"),
+			fields:  []string{"spec.databases[0].type"},
+		},
+		{
+			name:    "type and release name",
+			old:     database("PostgreSQL", dedicated, "db"),
+			current: database("MySQL", dedicated, ""),
+		},
+		{
+			name:    "isolation",
+			old:     database("PostgreSQL", dedicated, ""),
+			current: database("PostgreSQL", shared, ""),
+			fields:  []string{"spec.databases[0].isolation"},
+		},
+		{
+			name:    "type of shared database",
+			old:     database("PostgreSQL", shared, ""),
+			current: database("MySQL", shared, ""),
+		},
+		{
+			name:    "renamed",
+			old:     database("PostgreSQL", dedicated, ""),
+			current: testAppService("web", cloudshipv1beta1.DatabaseSpec{Name: "orders", Type: "PostgreSQL", Isolation: shared}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validateChanges(serviceDatabases(tt.old), serviceDatabases(tt.current))
+			assertFields(t, errs, tt.fields)
+		})
+	}
+
+	t.Run("cache", func(t *testing.T) {
+		old := testApplication()
+		old.Spec.Caches[0].ReleaseName = "cache-redis"
+		current := old.DeepCopy()
+		current.Spec.Caches[0].Type = cloudshipv1beta1.CacheTypeMemcached
+		assertFields(t, validateChanges(applicationBackingServices(old), applicationBackingServices(current)),
+			[]string{"spec.caches[0].type"})
+	})
+}
+
+// assertFields checks that errs are the errors of fields.
+func assertFields(t *testing.T, errs field.ErrorList, fields []string) {
+	t.Helper()
+	if len(errs) != len(fields) {
+		t.Fatalf("expected errors for %v, got %v", fields, errs)
+	}
+	for i, err := range errs {
+		if err.Field != fields[i] {
+			t.Fatalf("expected an error for %s, got %v", fields[i], err)
+		}
+	}
+}
+
+func TestApplicationValidator(t *testing.T) {
+	old := testApplication()
+	old.Spec.Caches[0].Type = cloudshipv1beta1.CacheTypeMemcached
+	old.Status.Releases = []cloudshipv1beta1.ReleaseStatus{
+		{Name: "cache-sessions-memcached", Category: cloudshipv1beta1.BackingServiceCategoryCache, Type: "Memcached"},
+	}
+	web := testAppService("web", cloudshipv1beta1.DatabaseSpec{Name: "main", Type: cloudshipv1beta1.DatabaseTypePostgreSQL})
+	v := &applicationValidator{
+		validator: testValidator(t, old, web, helmRelease("shop", "stream-legacy-kafka")),
+		decoder:   testDecoder(t),
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(app *cloudshipv1beta1.Application)
+		allowed bool
+		reason  string
+	}{
+		{
+			name:    "unchanged",
+			mutate:  func(app *cloudshipv1beta1.Application) {},
+			allowed: true,
+		},
+		{
+			name: "cache added",
+			mutate: func(app *cloudshipv1beta1.Application) {
+				app.Spec.Caches = append(app.Spec.Caches, cloudshipv1beta1.CacheSpec{Name: "pages", Type: cloudshipv1beta1.CacheTypeRedis})
+			},
+			allowed: true,
+		},
+		{
+			name:    "cache replaced by another type",
+			mutate:  func(app *cloudshipv1beta1.Application) { app.Spec.Caches[0].Type = cloudshipv1beta1.CacheTypeRedis },
+			allowed: true,
+		},
+		{
+			name: "unsupported type",
+			mutate: func(app *cloudshipv1beta1.Application) {
+				app.Spec.Caches = append(app.Spec.Caches, cloudshipv1beta1.CacheSpec{Name: "pages", Type: "Hazelcast"})
+			},
+			reason: "No Manager Factory for Hazelcast",
+		},
+		{
+			name: "release of a service",
+			mutate: func(app *cloudshipv1beta1.Application) {
+				app.Spec.Caches[0].ReleaseName = "db-web-main-postgresql"
+			},
+			reason: "spec.caches[0].releaseName",
+		},
+		{
+			name: "release installed by something else",
+			mutate: func(app *cloudshipv1beta1.Application) {
+				app.Spec.EventStreams[0].Name = "legacy"
+			},
+			reason: "spec.eventStreams[0].name",
+		},
+		{
+			name: "releases colliding in the application",
+			mutate: func(app *cloudshipv1beta1.Application) {
+				app.Spec.Caches = append(app.Spec.Caches, cloudshipv1beta1.CacheSpec{
+					Name:        "pages",
+					Type:        cloudshipv1beta1.CacheTypeMemcached,
+					ReleaseName: "cache-sessions-memcached",
+				})
+			},
+			reason: "spec.caches[1].releaseName",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := old.DeepCopy()
+			tt.mutate(app)
+			resp := v.Handle(context.Background(), admissionRequest(t, app, old.DeepCopy()))
+			assertAllowed(t, resp, tt.allowed, tt.reason)
+		})
+	}
+}
+
+func TestAppResourceValidator(t *testing.T) {
+	resource := func(namespace, name string, category cloudshipv1beta1.BackingServiceCategory,
+		serviceType string) *cloudshipv1beta1.AppResource {
+		return &cloudshipv1beta1.AppResource{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       cloudshipv1beta1.AppResourceSpec{Category: category, Type: serviceType},
+		}
+	}
+	cache := cloudshipv1beta1.BackingServiceCategoryCache
+	bucket := resource("shop", "bucket", cache, "Redis")
+	v := &appResourceValidator{
+		validator: testValidator(t, testApplication(), bucket.DeepCopy(), helmRelease("shop", "legacy")),
+		decoder:   testDecoder(t),
+	}
+
+	tests := []struct {
+		name        string
+		appResource *cloudshipv1beta1.AppResource
+		old         *cloudshipv1beta1.AppResource
+		allowed     bool
+		reason      string
+	}{
+		{
+			name:        "valid",
+			appResource: resource("shop", "sessions", cache, "Redis"),
+			allowed:     true,
+		},
+		{
+			name:        "namespace without application",
+			appResource: resource("blog", "sessions", cache, "Redis"),
+			reason:      "there is no application blog for the namespace",
+		},
+		{
+			name:        "unsupported type",
+			appResource: resource("shop", "sessions", cache, "Hazelcast"),
+			reason:      "spec.type",
+		},
+		{
+			name:        "release installed by something else",
+			appResource: resource("shop", "legacy", cache, "Redis"),
+			reason:      "release legacy is already installed in namespace shop",
+		},
+		{
+			name:        "update keeping its own release",
+			appResource: bucket.DeepCopy(),
+			old:         bucket.DeepCopy(),
+			allowed:     true,
+		},
+		{
+			name:        "type changed",
+			appResource: resource("shop", "bucket", cache, "Memcached"),
+			old:         bucket.DeepCopy(),
+			reason:      "the type of a resource cannot change",
+		},
+		{
+			name:        "category changed",
+			appResource: resource("shop", "bucket", cloudshipv1beta1.BackingServiceCategoryDatabase, "Redis"),
+			old:         bucket.DeepCopy(),
+			reason:      "the category of a resource cannot change",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := admissionRequest(t, tt.appResource, nil)
+			if tt.old != nil {
+				req = admissionRequest(t, tt.appResource, tt.old)
+			}
+			resp := v.Handle(context.Background(), req)
+			assertAllowed(t, resp, tt.allowed, tt.reason)
+		})
+	}
+}